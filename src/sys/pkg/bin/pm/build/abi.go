@@ -0,0 +1,89 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package build
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"strconv"
+)
+
+// ErrABIRevisionNotAllowed is returned by Validate when a package declares an
+// ABI revision that is not in the configured allowlist.
+type ErrABIRevisionNotAllowed struct {
+	ABIRevision uint64
+}
+
+func (e ErrABIRevisionNotAllowed) Error() string {
+	return fmt.Sprintf("pkg: ABI revision 0x%X is not in the allowed ABI revisions", e.ABIRevision)
+}
+
+// versionHistoryJSON is the subset of the SDK's version_history.json needed to
+// determine the allowed ABI revisions.
+type versionHistoryJSON struct {
+	Data struct {
+		APILevels map[string]struct {
+			ABIRevision string `json:"abi_revision"`
+			Status      string `json:"status"`
+		} `json:"api_levels"`
+	} `json:"data"`
+}
+
+// LoadAllowedABIRevisions reads the ABI revisions of every API level in the
+// version_history.json at path. API levels with status "unsupported" are
+// retired, and their ABI revisions are not allowed.
+func LoadAllowedABIRevisions(path string) (map[uint64]struct{}, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var history versionHistoryJSON
+	if err := json.Unmarshal(b, &history); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal %s: %w", path, err)
+	}
+
+	allowed := make(map[uint64]struct{}, len(history.Data.APILevels))
+	for level, v := range history.Data.APILevels {
+		if v.Status == "unsupported" {
+			continue
+		}
+		abiRevision, err := strconv.ParseUint(v.ABIRevision, 0, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid ABI revision for API level %s: %w", path, level, err)
+		}
+		allowed[abiRevision] = struct{}{}
+	}
+	return allowed, nil
+}
+
+// checkABIRevision checks the ABI revision file at path against the
+// configured allowlist. A revision that is not allowed is only logged if the
+// config downgrades the check to a warning.
+func (c *Config) checkABIRevision(path string) error {
+	if c.AllowedABIRevisions == nil {
+		return nil
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("pkg: reading ABI revision: %w", err)
+	}
+	if len(b) != 8 {
+		return fmt.Errorf("pkg: ABI revision file %s must be 8 bytes, got %d", path, len(b))
+	}
+	abiRevision := binary.LittleEndian.Uint64(b)
+	if _, ok := c.AllowedABIRevisions[abiRevision]; ok {
+		return nil
+	}
+
+	err = ErrABIRevisionNotAllowed{ABIRevision: abiRevision}
+	if c.ABIRevisionWarnOnly {
+		log.Printf("WARNING: %s", err)
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,88 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package build
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const testVersionHistory = `{
+  "data": {
+    "name": "Platform version map",
+    "type": "version_history",
+    "api_levels": {
+      "4": {"abi_revision": "0x601665C5B1A89C7F", "status": "unsupported"},
+      "5": {"abi_revision": "0x72F0A2C4D1EA2FF9"},
+      "6": {"abi_revision": "0xE9CACD17EA11859D", "status": "supported"}
+    }
+  },
+  "schema_id": "https://fuchsia.dev/schema/version_history-ef02ef45.json"
+}`
+
+func writeTestVersionHistory(t *testing.T) string {
+	path := filepath.Join(t.TempDir(), "version_history.json")
+	if err := ioutil.WriteFile(path, []byte(testVersionHistory), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadAllowedABIRevisions(t *testing.T) {
+	allowed, err := LoadAllowedABIRevisions(writeTestVersionHistory(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[uint64]struct{}{
+		0x72F0A2C4D1EA2FF9: {},
+		0xE9CACD17EA11859D: {},
+	}
+	if d := cmp.Diff(want, allowed); d != "" {
+		t.Errorf("allowed ABI revisions (-want +got):\n%s", d)
+	}
+}
+
+func TestValidateABIRevision(t *testing.T) {
+	allowed, err := LoadAllowedABIRevisions(writeTestVersionHistory(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name        string
+		abiRevision uint64
+		warnOnly    bool
+		wantErr     bool
+	}{
+		{name: "allowed", abiRevision: 0xE9CACD17EA11859D},
+		{name: "retired", abiRevision: 0x601665C5B1A89C7F, wantErr: true},
+		{name: "retired warn only", abiRevision: 0x601665C5B1A89C7F, warnOnly: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := TestConfig()
+			defer os.RemoveAll(filepath.Dir(cfg.TempDir))
+			cfg.PkgABIRevision = tc.abiRevision
+			BuildTestPackage(cfg)
+
+			cfg.AllowedABIRevisions = allowed
+			cfg.ABIRevisionWarnOnly = tc.warnOnly
+			err := Validate(cfg)
+
+			var notAllowed ErrABIRevisionNotAllowed
+			if tc.wantErr {
+				if !errors.As(err, &notAllowed) || notAllowed.ABIRevision != tc.abiRevision {
+					t.Fatalf("got error %v, want ErrABIRevisionNotAllowed{0x%X}", err, tc.abiRevision)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
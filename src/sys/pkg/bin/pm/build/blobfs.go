@@ -0,0 +1,89 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package build
+
+import "math"
+
+const (
+	// BlobfsBlockSize is the size in bytes of a blobfs block.
+	BlobfsBlockSize = 8192
+
+	// merkleDigestSize is the size in bytes of a single merkle tree digest.
+	merkleDigestSize = 32
+)
+
+// BlobfsSizeOptions control how EstimateBlobfsSize accounts for blob storage.
+type BlobfsSizeOptions struct {
+	// CompressionRatio is the expected ratio of compressed to uncompressed
+	// blob size, in (0, 1]. A zero value assumes blobs are stored
+	// uncompressed.
+	CompressionRatio float64
+}
+
+// BlobfsSize is an estimate of the space a set of blobs will consume on
+// blobfs.
+type BlobfsSize struct {
+	// Blobs is the number of unique blobs.
+	Blobs int
+	// ContentBytes is the sum of the uncompressed sizes of the unique blobs.
+	ContentBytes uint64
+	// DataBytes is the block-aligned space used by the (possibly compressed)
+	// blob data.
+	DataBytes uint64
+	// MerkleBytes is the block-aligned space used by stored merkle trees.
+	MerkleBytes uint64
+}
+
+// TotalBytes is the total blobfs space consumed.
+func (s BlobfsSize) TotalBytes() uint64 {
+	return s.DataBytes + s.MerkleBytes
+}
+
+// EstimateBlobfsSize computes the blobfs space that the blobs of the given
+// package manifest will consume. Blobs that share a merkle root are counted
+// once, as blobfs deduplicates them. Merkle trees are accounted for in the
+// padded format, so the estimate is an upper bound for blobfs configurations
+// using the compact format.
+func EstimateBlobfsSize(m *PackageManifest, opts BlobfsSizeOptions) BlobfsSize {
+	var size BlobfsSize
+	seen := make(map[MerkleRoot]struct{}, len(m.Blobs))
+	for _, blob := range m.Blobs {
+		if _, ok := seen[blob.Merkle]; ok {
+			continue
+		}
+		seen[blob.Merkle] = struct{}{}
+
+		size.Blobs++
+		size.ContentBytes += blob.Size
+		size.DataBytes += blobfsDataBytes(blob.Size, opts.CompressionRatio)
+		size.MerkleBytes += blobfsMerkleBytes(blob.Size)
+	}
+	return size
+}
+
+// blobfsDataBytes returns the block-aligned size of a blob's stored data.
+func blobfsDataBytes(size uint64, ratio float64) uint64 {
+	if ratio > 0 && ratio < 1 {
+		size = uint64(math.Ceil(float64(size) * ratio))
+	}
+	return alignToBlock(size)
+}
+
+// blobfsMerkleBytes returns the block-aligned size of the merkle tree that
+// blobfs stores for a blob of the given size. Blobs that fit in a single
+// block have no stored tree, since the tree consists of only the root.
+func blobfsMerkleBytes(size uint64) uint64 {
+	var total uint64
+	for size > BlobfsBlockSize {
+		nodes := (size + BlobfsBlockSize - 1) / BlobfsBlockSize
+		size = alignToBlock(nodes * merkleDigestSize)
+		total += size
+	}
+	return total
+}
+
+func alignToBlock(n uint64) uint64 {
+	return (n + BlobfsBlockSize - 1) / BlobfsBlockSize * BlobfsBlockSize
+}
@@ -0,0 +1,60 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package build
+
+import (
+	"testing"
+)
+
+func TestBlobfsMerkleBytes(t *testing.T) {
+	for _, tc := range []struct {
+		size uint64
+		want uint64
+	}{
+		{0, 0},
+		{1, 0},
+		{BlobfsBlockSize, 0},
+		{BlobfsBlockSize + 1, BlobfsBlockSize},
+		// 256 digests fill exactly one block.
+		{256 * BlobfsBlockSize, BlobfsBlockSize},
+		// 257 digests need two blocks, plus a level above them.
+		{257 * BlobfsBlockSize, 3 * BlobfsBlockSize},
+	} {
+		if got := blobfsMerkleBytes(tc.size); got != tc.want {
+			t.Errorf("blobfsMerkleBytes(%d) = %d, want %d", tc.size, got, tc.want)
+		}
+	}
+}
+
+func TestEstimateBlobfsSize(t *testing.T) {
+	m := &PackageManifest{
+		Blobs: []PackageBlobInfo{
+			{Path: "meta/", Merkle: MerkleRoot{1}, Size: 100},
+			{Path: "a", Merkle: MerkleRoot{2}, Size: 3 * BlobfsBlockSize},
+			// Duplicate content is stored once.
+			{Path: "b", Merkle: MerkleRoot{2}, Size: 3 * BlobfsBlockSize},
+			{Path: "empty", Merkle: MerkleRoot{3}, Size: 0},
+		},
+	}
+
+	got := EstimateBlobfsSize(m, BlobfsSizeOptions{})
+	want := BlobfsSize{
+		Blobs:        3,
+		ContentBytes: 100 + 3*BlobfsBlockSize,
+		DataBytes:    4 * BlobfsBlockSize,
+		MerkleBytes:  BlobfsBlockSize,
+	}
+	if got != want {
+		t.Errorf("EstimateBlobfsSize() = %+v, want %+v", got, want)
+	}
+	if got.TotalBytes() != 5*BlobfsBlockSize {
+		t.Errorf("TotalBytes() = %d, want %d", got.TotalBytes(), 5*BlobfsBlockSize)
+	}
+
+	got = EstimateBlobfsSize(m, BlobfsSizeOptions{CompressionRatio: 0.5})
+	if want := uint64(3 * BlobfsBlockSize); got.DataBytes != want {
+		t.Errorf("compressed DataBytes = %d, want %d", got.DataBytes, want)
+	}
+}
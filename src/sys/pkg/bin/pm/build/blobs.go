@@ -5,9 +5,19 @@
 package build
 
 import (
+	"bufio"
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	far "go.fuchsia.dev/fuchsia/src/sys/pkg/lib/far/go"
+	"go.fuchsia.dev/fuchsia/src/sys/pkg/lib/merkle"
 )
 
 // PackageBlobInfo contains metadata for a single blob in a package
@@ -23,6 +33,9 @@ type PackageBlobInfo struct {
 
 	// Size of blob, in bytes
 	Size uint64 `json:"size"`
+
+	// Delivery blobs generated for the blob, at most one of each type
+	DeliveryBlobs []DeliveryBlobInfo `json:"delivery_blobs,omitempty"`
 }
 
 // LoadBlobs attempts to read and parse a blobs manifest from the given path
@@ -49,3 +62,237 @@ func LoadBlobs(path string) ([]PackageBlobInfo, error) {
 
 	return members, nil
 }
+
+// BlobsJSONEntry is a single entry of an aggregated blobs.json listing, which
+// describes a blob independently of the packages and paths that contain it.
+type BlobsJSONEntry struct {
+	// The path of the blob relative to the output directory
+	SourcePath string `json:"source_path"`
+
+	// Merkle root for the blob
+	Merkle MerkleRoot `json:"merkle"`
+
+	// Size of blob, in bytes
+	Size uint64 `json:"size"`
+
+	// Delivery blobs generated for the blob, at most one of each type
+	DeliveryBlobs []DeliveryBlobInfo `json:"delivery_blobs,omitempty"`
+}
+
+// AggregateBlobs returns the unique blobs of the given package manifests,
+// sorted by merkle root. When the same blob is provided by more than one
+// source, the lexically first source path is used so that the result does not
+// depend on the order of the manifests. Delivery blobs recorded by any of the
+// manifests are merged, sorted by type.
+func AggregateBlobs(manifests ...*PackageManifest) ([]BlobsJSONEntry, error) {
+	byMerkle := make(map[MerkleRoot]BlobsJSONEntry)
+	for _, m := range manifests {
+		for _, blob := range m.Blobs {
+			entry, ok := byMerkle[blob.Merkle]
+			if !ok {
+				entry = BlobsJSONEntry{
+					SourcePath: blob.SourcePath,
+					Merkle:     blob.Merkle,
+					Size:       blob.Size,
+				}
+				if err := mergeDeliveryBlobs(&entry, blob.DeliveryBlobs); err != nil {
+					return nil, err
+				}
+				byMerkle[blob.Merkle] = entry
+				continue
+			}
+			if entry.Size != blob.Size {
+				return nil, fmt.Errorf("blob %s has conflicting sizes %d (%s) and %d (%s)",
+					blob.Merkle, entry.Size, entry.SourcePath, blob.Size, blob.SourcePath)
+			}
+			if blob.SourcePath < entry.SourcePath {
+				entry.SourcePath = blob.SourcePath
+			}
+			if err := mergeDeliveryBlobs(&entry, blob.DeliveryBlobs); err != nil {
+				return nil, err
+			}
+			byMerkle[blob.Merkle] = entry
+		}
+	}
+
+	entries := make([]BlobsJSONEntry, 0, len(byMerkle))
+	for _, entry := range byMerkle {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Merkle.LessThan(entries[j].Merkle)
+	})
+	return entries, nil
+}
+
+// mergeDeliveryBlobs adds the given delivery blobs to the entry, keeping them
+// sorted by type. Delivery blobs of the same type must have the same hash.
+func mergeDeliveryBlobs(entry *BlobsJSONEntry, blobs []DeliveryBlobInfo) error {
+	for _, d := range blobs {
+		i := sort.Search(len(entry.DeliveryBlobs), func(i int) bool {
+			return entry.DeliveryBlobs[i].Type >= d.Type
+		})
+		if i < len(entry.DeliveryBlobs) && entry.DeliveryBlobs[i].Type == d.Type {
+			existing := entry.DeliveryBlobs[i]
+			if existing.Hash != d.Hash || existing.Size != d.Size {
+				return fmt.Errorf("blob %s has conflicting type %d delivery blobs %s and %s",
+					entry.Merkle, d.Type, existing.Hash, d.Hash)
+			}
+			if d.SourcePath != "" && (existing.SourcePath == "" || d.SourcePath < existing.SourcePath) {
+				entry.DeliveryBlobs[i].SourcePath = d.SourcePath
+			}
+			continue
+		}
+		entry.DeliveryBlobs = append(entry.DeliveryBlobs, DeliveryBlobInfo{})
+		copy(entry.DeliveryBlobs[i+1:], entry.DeliveryBlobs[i:])
+		entry.DeliveryBlobs[i] = d
+	}
+	return nil
+}
+
+// WriteBlobsJSON writes the aggregated blobs of the given package manifests to
+// w in the blobs.json format.
+func WriteBlobsJSON(w io.Writer, manifests ...*PackageManifest) error {
+	entries, err := AggregateBlobs(manifests...)
+	if err != nil {
+		return err
+	}
+	content, err := json.MarshalIndent(entries, "", "    ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(content)
+	return err
+}
+
+var (
+	// ErrBlobTruncated means a blob is shorter than expected.
+	ErrBlobTruncated = errors.New("blob is truncated")
+	// ErrBlobCorrupt means a blob has the expected size, but not the
+	// expected merkle root.
+	ErrBlobCorrupt = errors.New("blob is corrupt")
+	// ErrBlobWrongIdentity means a blob is longer than expected, or of unknown
+	// expected size and not the expected merkle root, so it is most likely a
+	// different blob altogether.
+	ErrBlobWrongIdentity = errors.New("blob is a different blob")
+)
+
+// BlobVerifyError describes a blob that failed VerifyBlob. It matches one of
+// ErrBlobTruncated, ErrBlobCorrupt or ErrBlobWrongIdentity with errors.Is.
+type BlobVerifyError struct {
+	Path       string
+	Err        error
+	WantMerkle MerkleRoot
+	GotMerkle  MerkleRoot
+	WantSize   int64
+	GotSize    int64
+}
+
+func (e *BlobVerifyError) Error() string {
+	return fmt.Sprintf("pkg: %s: %s: got merkle %s and %d bytes, want merkle %s and %d bytes",
+		e.Path, e.Err, e.GotMerkle, e.GotSize, e.WantMerkle, e.WantSize)
+}
+
+func (e *BlobVerifyError) Unwrap() error {
+	return e.Err
+}
+
+// VerifyBlob checks that the file at path is the blob with the given merkle
+// root and size, or an uncompressed type 1 delivery blob of it. A negative size
+// skips the size check, for callers that only know the merkle root. Errors
+// reading the file are returned as is; a mismatch is returned as a
+// *BlobVerifyError.
+func VerifyBlob(path string, want MerkleRoot, size int64) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	br := bufio.NewReader(f)
+	if magic, err := br.Peek(len(deliveryBlobMagic)); err == nil && bytes.Equal(magic, deliveryBlobMagic[:]) {
+		got, n, err := deliveryBlobMerkle(br)
+		if err == nil {
+			return checkBlob(path, want, size, got, int64(n))
+		}
+		// A blob may start with the magic by chance, so only a delivery blob
+		// that does not match either way is reported as one.
+		if _, seekErr := f.Seek(0, io.SeekStart); seekErr != nil {
+			return seekErr
+		}
+		br.Reset(f)
+		if raw := VerifyBlobReader(path, br, want, size); raw == nil {
+			return nil
+		}
+		return err
+	}
+	return VerifyBlobReader(path, br, want, size)
+}
+
+// VerifyBlobReader is like VerifyBlob for a blob read from r, such as a blob
+// within a package archive. name identifies the blob in errors. Unlike
+// VerifyBlob, it does not accept delivery blobs.
+func VerifyBlobReader(name string, r io.Reader, want MerkleRoot, size int64) error {
+	var tree merkle.Tree
+	n, err := tree.ReadFrom(r)
+	if err != nil {
+		return err
+	}
+	var got MerkleRoot
+	copy(got[:], tree.Root())
+	return checkBlob(name, want, size, got, n)
+}
+
+func checkBlob(path string, want MerkleRoot, wantSize int64, got MerkleRoot, gotSize int64) error {
+	if got == want && (wantSize < 0 || gotSize == wantSize) {
+		return nil
+	}
+	e := &BlobVerifyError{Path: path, WantMerkle: want, GotMerkle: got, WantSize: wantSize, GotSize: gotSize}
+	switch {
+	case wantSize >= 0 && gotSize < wantSize:
+		e.Err = ErrBlobTruncated
+	case gotSize == wantSize:
+		e.Err = ErrBlobCorrupt
+	default:
+		e.Err = ErrBlobWrongIdentity
+	}
+	return e
+}
+
+// VerifyMetaFARBlobs checks that every blob listed in the meta/contents of the
+// meta.far at path is in blobsDir, named by its merkle root, and matches it.
+// This catches packages whose meta/contents was updated without rebuilding
+// their blobs, or the other way around. All mismatches are returned together.
+func VerifyMetaFARBlobs(path, blobsDir string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r, err := far.NewReader(f)
+	if err != nil {
+		return fmt.Errorf("pkg: reading %s: %w", path, err)
+	}
+	b, err := r.ReadFile("meta/contents")
+	if err != nil {
+		return fmt.Errorf("pkg: reading meta/contents of %s: %w", path, err)
+	}
+	contents, err := ParseMetaContents(bytes.NewReader(b))
+	if err != nil {
+		return fmt.Errorf("pkg: parsing meta/contents of %s: %w", path, err)
+	}
+
+	paths := make([]string, 0, len(contents))
+	for p := range contents {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	var errs FileErrors
+	for _, p := range paths {
+		root := contents[p]
+		if err := VerifyBlob(filepath.Join(blobsDir, root.String()), root, -1); err != nil {
+			errs = append(errs, fmt.Errorf("pkg: blob for %q: %w", p, err))
+		}
+	}
+	return errs.ErrorOrNil()
+}
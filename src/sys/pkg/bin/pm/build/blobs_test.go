@@ -0,0 +1,171 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package build
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"go.fuchsia.dev/fuchsia/src/sys/pkg/lib/merkle"
+)
+
+func TestAggregateBlobs(t *testing.T) {
+	a := &PackageManifest{
+		Blobs: []PackageBlobInfo{
+			{SourcePath: "out/a/meta.far", Path: "meta/", Merkle: MerkleRoot{3}, Size: 30},
+			{SourcePath: "out/z/shared", Path: "lib/shared", Merkle: MerkleRoot{1}, Size: 10},
+		},
+	}
+	b := &PackageManifest{
+		Blobs: []PackageBlobInfo{
+			{SourcePath: "out/b/meta.far", Path: "meta/", Merkle: MerkleRoot{2}, Size: 20},
+			{SourcePath: "out/b/shared", Path: "shared", Merkle: MerkleRoot{1}, Size: 10},
+		},
+	}
+
+	want := []BlobsJSONEntry{
+		{SourcePath: "out/b/shared", Merkle: MerkleRoot{1}, Size: 10},
+		{SourcePath: "out/b/meta.far", Merkle: MerkleRoot{2}, Size: 20},
+		{SourcePath: "out/a/meta.far", Merkle: MerkleRoot{3}, Size: 30},
+	}
+
+	// The result is independent of the manifest order.
+	for _, manifests := range [][]*PackageManifest{{a, b}, {b, a}} {
+		got, err := AggregateBlobs(manifests...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d := cmp.Diff(want, got); d != "" {
+			t.Errorf("AggregateBlobs (-want +got):\n%s", d)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := WriteBlobsJSON(&buf, a, b); err != nil {
+		t.Fatal(err)
+	}
+	var written []BlobsJSONEntry
+	if err := json.Unmarshal(buf.Bytes(), &written); err != nil {
+		t.Fatal(err)
+	}
+	if d := cmp.Diff(want, written); d != "" {
+		t.Errorf("WriteBlobsJSON (-want +got):\n%s", d)
+	}
+}
+
+func TestAggregateBlobsConflictingSizes(t *testing.T) {
+	m := &PackageManifest{
+		Blobs: []PackageBlobInfo{
+			{SourcePath: "a", Path: "a", Merkle: MerkleRoot{1}, Size: 10},
+			{SourcePath: "b", Path: "b", Merkle: MerkleRoot{1}, Size: 11},
+		},
+	}
+	if _, err := AggregateBlobs(m); err == nil {
+		t.Fatal("expected an error for conflicting blob sizes")
+	}
+}
+
+func TestVerifyBlob(t *testing.T) {
+	dir := t.TempDir()
+	content := bytes.Repeat([]byte("blob"), 3000)
+	write := func(name string, b []byte) string {
+		p := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(p, b, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	merkleOf := func(b []byte) MerkleRoot {
+		var tree merkle.Tree
+		if _, err := tree.ReadFrom(bytes.NewReader(b)); err != nil {
+			t.Fatal(err)
+		}
+		var root MerkleRoot
+		copy(root[:], tree.Root())
+		return root
+	}
+	want := merkleOf(content)
+	size := int64(len(content))
+
+	var delivery bytes.Buffer
+	if err := WriteDeliveryBlobType1(&delivery, bytes.NewReader(content), uint64(size)); err != nil {
+		t.Fatal(err)
+	}
+	corrupt := append([]byte(nil), content...)
+	corrupt[0] = 'x'
+
+	for _, tc := range []struct {
+		name    string
+		content []byte
+		size    int64
+		want    error
+	}{
+		{"blob", content, size, nil},
+		{"unknown size", content, -1, nil},
+		{"delivery blob", delivery.Bytes(), size, nil},
+		{"truncated", content[:100], size, ErrBlobTruncated},
+		{"corrupt", corrupt, size, ErrBlobCorrupt},
+		{"corrupt with unknown size", corrupt, -1, ErrBlobWrongIdentity},
+		{"other blob", append(content, content...), size, ErrBlobWrongIdentity},
+	} {
+		err := VerifyBlob(write(tc.name, tc.content), want, tc.size)
+		if tc.want == nil {
+			if err != nil {
+				t.Errorf("%s: %s", tc.name, err)
+			}
+			continue
+		}
+		var verr *BlobVerifyError
+		if !errors.Is(err, tc.want) || !errors.As(err, &verr) {
+			t.Errorf("%s: got %v, want %v", tc.name, err, tc.want)
+		}
+	}
+
+	if err := VerifyBlob(filepath.Join(dir, "missing"), want, size); err == nil {
+		t.Error("expected an error for a missing blob")
+	}
+}
+
+func TestVerifyMetaFARBlobs(t *testing.T) {
+	cfg := TestConfig()
+	defer os.RemoveAll(filepath.Dir(cfg.TempDir))
+	BuildTestPackage(cfg)
+	m, err := cfg.OutputManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blobsDir := t.TempDir()
+	for _, blob := range m.Blobs {
+		b, err := ioutil.ReadFile(blob.SourcePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(blobsDir, blob.Merkle.String()), b, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := VerifyMetaFARBlobs(cfg.MetaFAR(), blobsDir); err != nil {
+		t.Fatal(err)
+	}
+
+	// A content blob rebuilt without updating meta/contents is reported.
+	stale := m.Blobs[len(m.Blobs)-1]
+	if err := ioutil.WriteFile(filepath.Join(blobsDir, stale.Merkle.String()), []byte("rebuilt"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	err = VerifyMetaFARBlobs(cfg.MetaFAR(), blobsDir)
+	if !errors.Is(err, ErrBlobWrongIdentity) || !strings.Contains(err.Error(), stale.Path) {
+		t.Errorf("got %v, want blob for %q reported", err, stale.Path)
+	}
+}
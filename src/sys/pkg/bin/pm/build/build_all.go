@@ -0,0 +1,192 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package build
+
+import (
+	"fmt"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// PackageBuild is a single package to build with BuildAll.
+type PackageBuild struct {
+	// Name identifies the build in the Deps of other builds. It defaults to
+	// the package name of Config.
+	Name string
+
+	Config *Config
+
+	// Deps names the builds, such as subpackages, that must be built before
+	// this one.
+	Deps []string
+}
+
+func (b PackageBuild) name() string {
+	if b.Name != "" {
+		return b.Name
+	}
+	return b.Config.PkgName
+}
+
+// ErrDependencyCycle is returned by BuildAll when the dependencies between
+// builds form a cycle.
+type ErrDependencyCycle struct {
+	// Names are the builds that are part of, or depend on, a cycle.
+	Names []string
+}
+
+func (e ErrDependencyCycle) Error() string {
+	return fmt.Sprintf("build.BuildAll: dependency cycle among %s", strings.Join(e.Names, ", "))
+}
+
+// BuildAll updates and seals every given package, building each only after
+// its dependencies, with at most workers builds running at once (or one per
+// CPU if workers is not positive). It returns the output manifests in the
+// order of builds. A build that fails does not stop the others, but builds
+// that depend on it are skipped; all failures are reported together, and the
+// manifests of failed and skipped builds are nil.
+func BuildAll(builds []PackageBuild, workers int) ([]*PackageManifest, error) {
+	dependents, indegree, err := buildGraph(builds)
+	if err != nil {
+		return nil, err
+	}
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	type result struct {
+		index    int
+		manifest *PackageManifest
+		err      error
+	}
+	ready := make(chan int, len(builds))
+	results := make(chan result, len(builds))
+	for i := 0; i < workers; i++ {
+		go func() {
+			for i := range ready {
+				m, err := buildPackage(builds[i].Config)
+				results <- result{i, m, err}
+			}
+		}()
+	}
+	defer close(ready)
+
+	for i, n := range indegree {
+		if n == 0 {
+			ready <- i
+		}
+	}
+
+	manifests := make([]*PackageManifest, len(builds))
+	skipped := make([]bool, len(builds))
+	var errs FileErrors
+
+	// skip marks every transitive dependent of a failed build as skipped,
+	// returning how many builds were newly skipped.
+	var skip func(i int, cause string) int
+	skip = func(i int, cause string) int {
+		n := 0
+		for _, d := range dependents[i] {
+			if skipped[d] {
+				continue
+			}
+			skipped[d] = true
+			errs = append(errs, fmt.Errorf("build.BuildAll: skipped %s: dependency %s failed", builds[d].name(), cause))
+			n += 1 + skip(d, cause)
+		}
+		return n
+	}
+
+	for remaining := len(builds); remaining > 0; {
+		r := <-results
+		remaining--
+		if r.err != nil {
+			errs = append(errs, fmt.Errorf("build.BuildAll: %s: %w", builds[r.index].name(), r.err))
+			remaining -= skip(r.index, builds[r.index].name())
+			continue
+		}
+		manifests[r.index] = r.manifest
+		for _, d := range dependents[r.index] {
+			indegree[d]--
+			if indegree[d] == 0 && !skipped[d] {
+				ready <- d
+			}
+		}
+	}
+
+	return manifests, errs.ErrorOrNil()
+}
+
+// buildGraph returns, for each build, the builds that depend on it and the
+// number of builds it depends on, checking that every dependency exists and
+// that there are no cycles.
+func buildGraph(builds []PackageBuild) ([][]int, []int, error) {
+	byName := make(map[string]int, len(builds))
+	for i, b := range builds {
+		name := b.name()
+		if _, ok := byName[name]; ok {
+			return nil, nil, fmt.Errorf("build.BuildAll: more than one build named %q", name)
+		}
+		byName[name] = i
+	}
+
+	dependents := make([][]int, len(builds))
+	indegree := make([]int, len(builds))
+	for i, b := range builds {
+		for _, dep := range b.Deps {
+			j, ok := byName[dep]
+			if !ok {
+				return nil, nil, fmt.Errorf("build.BuildAll: %s depends on unknown build %q", b.name(), dep)
+			}
+			dependents[j] = append(dependents[j], i)
+			indegree[i]++
+		}
+	}
+
+	// Topologically sort the builds; any that cannot be sorted are part of
+	// or depend on a cycle.
+	remaining := append([]int{}, indegree...)
+	var queue []int
+	for i, n := range remaining {
+		if n == 0 {
+			queue = append(queue, i)
+		}
+	}
+	for len(queue) > 0 {
+		i := queue[0]
+		queue = queue[1:]
+		for _, d := range dependents[i] {
+			remaining[d]--
+			if remaining[d] == 0 {
+				queue = append(queue, d)
+			}
+		}
+	}
+	var cycle []string
+	for i, n := range remaining {
+		if n > 0 {
+			cycle = append(cycle, builds[i].name())
+		}
+	}
+	if len(cycle) > 0 {
+		sort.Strings(cycle)
+		return nil, nil, ErrDependencyCycle{Names: cycle}
+	}
+
+	return dependents, indegree, nil
+}
+
+// buildPackage updates and seals a single package, returning its output
+// manifest.
+func buildPackage(cfg *Config) (*PackageManifest, error) {
+	if err := Update(cfg); err != nil {
+		return nil, err
+	}
+	if _, err := Seal(cfg); err != nil {
+		return nil, err
+	}
+	return cfg.OutputManifest()
+}
@@ -0,0 +1,98 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package build
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func testPackageBuild(t *testing.T, name string, deps ...string) PackageBuild {
+	cfg := TestConfig()
+	t.Cleanup(func() { os.RemoveAll(filepath.Dir(cfg.TempDir)) })
+	cfg.PkgName = name
+	TestPackage(cfg)
+	return PackageBuild{Config: cfg, Deps: deps}
+}
+
+func TestBuildAll(t *testing.T) {
+	builds := []PackageBuild{
+		testPackageBuild(t, "parent", "child-a", "child-b"),
+		testPackageBuild(t, "child-a", "grandchild"),
+		testPackageBuild(t, "child-b"),
+		testPackageBuild(t, "grandchild"),
+	}
+
+	manifests, err := BuildAll(builds, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, m := range manifests {
+		if m == nil {
+			t.Fatalf("missing manifest for %s", builds[i].name())
+		}
+		if m.Package.Name != builds[i].name() {
+			t.Errorf("manifest %d is for %s, want %s", i, m.Package.Name, builds[i].name())
+		}
+	}
+}
+
+func TestBuildAllSkipsDependentsOfFailedBuilds(t *testing.T) {
+	broken := testPackageBuild(t, "broken")
+	os.Remove(broken.Config.ManifestPath)
+
+	builds := []PackageBuild{
+		testPackageBuild(t, "parent", "child"),
+		testPackageBuild(t, "child", "broken"),
+		broken,
+		testPackageBuild(t, "unrelated"),
+	}
+
+	manifests, err := BuildAll(builds, 0)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	for _, name := range []string{"broken", "skipped child", "skipped parent"} {
+		if !strings.Contains(err.Error(), name) {
+			t.Errorf("error %q does not mention %q", err, name)
+		}
+	}
+
+	var built []string
+	for _, m := range manifests {
+		if m != nil {
+			built = append(built, m.Package.Name)
+		}
+	}
+	if d := cmp.Diff([]string{"unrelated"}, built); d != "" {
+		t.Errorf("built packages (-want +got):\n%s", d)
+	}
+}
+
+func TestBuildAllRejectsInvalidGraphs(t *testing.T) {
+	cycle := []PackageBuild{
+		testPackageBuild(t, "a", "b"),
+		testPackageBuild(t, "b", "a"),
+		testPackageBuild(t, "c", "a"),
+		testPackageBuild(t, "d"),
+	}
+	var cycleErr ErrDependencyCycle
+	if _, err := BuildAll(cycle, 1); !errors.As(err, &cycleErr) {
+		t.Fatalf("got error %v, want ErrDependencyCycle", err)
+	}
+	if d := cmp.Diff([]string{"a", "b", "c"}, cycleErr.Names); d != "" {
+		t.Errorf("cycle names (-want +got):\n%s", d)
+	}
+
+	unknown := []PackageBuild{testPackageBuild(t, "a", "missing")}
+	if _, err := BuildAll(unknown, 1); err == nil {
+		t.Error("expected an error for an unknown dependency")
+	}
+}
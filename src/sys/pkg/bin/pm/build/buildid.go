@@ -0,0 +1,168 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package build
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// ntGNUBuildID is the ELF note type of a GNU build-id.
+const ntGNUBuildID = 3
+
+// BuildIDEntry describes an ELF blob of a package and its GNU build-id.
+type BuildIDEntry struct {
+	// The GNU build-id of the blob, in lowercase hex
+	BuildID string `json:"build_id"`
+
+	// The path within the package
+	Path string `json:"path"`
+
+	// The path of the blob relative to the output directory
+	SourcePath string `json:"source_path"`
+
+	// Merkle root for the blob
+	Merkle MerkleRoot `json:"merkle"`
+}
+
+// DebugPath returns the path of the entry's debug file within a .build-id
+// directory, in the conventional "ab/cdef.debug" layout.
+func (e BuildIDEntry) DebugPath() string {
+	if len(e.BuildID) <= 2 {
+		return e.BuildID + ".debug"
+	}
+	return e.BuildID[:2] + "/" + e.BuildID[2:] + ".debug"
+}
+
+// BuildIDIndex scans the content blobs of a package for ELF files with a GNU
+// build-id, returning an entry for each, sorted by package path. Blobs that
+// are not ELF files, or that have no build-id, are skipped.
+func BuildIDIndex(blobs []PackageBlobInfo) ([]BuildIDEntry, error) {
+	var entries []BuildIDEntry
+	for _, blob := range blobs {
+		if blob.Path == "meta/" {
+			continue
+		}
+		id, err := ReadBuildID(blob.SourcePath)
+		if err != nil {
+			return nil, fmt.Errorf("build.BuildIDIndex: %s: %w", blob.Path, err)
+		}
+		if id == "" {
+			continue
+		}
+		entries = append(entries, BuildIDEntry{
+			BuildID:    id,
+			Path:       blob.Path,
+			SourcePath: blob.SourcePath,
+			Merkle:     blob.Merkle,
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Path < entries[j].Path
+	})
+	return entries, nil
+}
+
+// WriteBuildIDIndex writes the given entries to w as JSON.
+func WriteBuildIDIndex(w io.Writer, entries []BuildIDEntry) error {
+	if entries == nil {
+		entries = []BuildIDEntry{}
+	}
+	content, err := json.MarshalIndent(entries, "", "    ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(content)
+	return err
+}
+
+// ReadBuildID returns the GNU build-id of the ELF file at path in lowercase
+// hex, or the empty string if the file is not an ELF file or has no build-id.
+func ReadBuildID(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	magic := make([]byte, len(elf.ELFMAG))
+	if _, err := io.ReadFull(f, magic); err != nil || string(magic) != elf.ELFMAG {
+		return "", nil
+	}
+
+	ef, err := elf.NewFile(f)
+	if err != nil {
+		return "", err
+	}
+	defer ef.Close()
+
+	// Prefer note sections, falling back to note segments for binaries with
+	// stripped section headers.
+	var notes []io.Reader
+	for _, s := range ef.Sections {
+		if s.Type == elf.SHT_NOTE {
+			notes = append(notes, s.Open())
+		}
+	}
+	if len(notes) == 0 {
+		for _, p := range ef.Progs {
+			if p.Type == elf.PT_NOTE {
+				notes = append(notes, p.Open())
+			}
+		}
+	}
+
+	for _, r := range notes {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return "", err
+		}
+		if id := findGNUBuildID(data, ef.ByteOrder); id != nil {
+			return hex.EncodeToString(id), nil
+		}
+	}
+	return "", nil
+}
+
+// findGNUBuildID returns the descriptor of the GNU build-id note within the
+// given note data, or nil if there is none.
+func findGNUBuildID(data []byte, order binary.ByteOrder) []byte {
+	// Sizes are widened before aligning so that a malformed size near the
+	// top of the uint32 range cannot wrap around.
+	align := func(n uint64) uint64 { return (n + 3) &^ 3 }
+	for len(data) >= 12 {
+		namesz := uint64(order.Uint32(data[0:4]))
+		descsz := uint64(order.Uint32(data[4:8]))
+		typ := order.Uint32(data[8:12])
+		data = data[12:]
+
+		size := uint64(len(data))
+		if namesz > size || descsz > size {
+			return nil
+		}
+		nameEnd := align(namesz)
+		descEnd := nameEnd + align(descsz)
+		if size < nameEnd+descsz {
+			return nil
+		}
+		name := data[:namesz]
+		desc := data[nameEnd : nameEnd+descsz]
+		if typ == ntGNUBuildID && bytes.Equal(name, []byte("GNU\x00")) {
+			return desc
+		}
+		if size < descEnd {
+			return nil
+		}
+		data = data[descEnd:]
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package build
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// writeTestELF writes a minimal ELF file with a single note section holding
+// the given GNU build-id.
+func writeTestELF(t *testing.T, path string, buildID []byte) {
+	order := binary.LittleEndian
+
+	var note bytes.Buffer
+	binary.Write(&note, order, uint32(4))
+	binary.Write(&note, order, uint32(len(buildID)))
+	binary.Write(&note, order, uint32(ntGNUBuildID))
+	note.WriteString("GNU\x00")
+	note.Write(buildID)
+	for note.Len()%4 != 0 {
+		note.WriteByte(0)
+	}
+
+	shstrtab := []byte("\x00.note.gnu.build-id\x00.shstrtab\x00")
+
+	const ehsize = 64
+	noteOff := uint64(ehsize)
+	strOff := noteOff + uint64(note.Len())
+	shOff := strOff + uint64(len(shstrtab))
+
+	hdr := elf.Header64{
+		Type:      uint16(elf.ET_DYN),
+		Machine:   uint16(elf.EM_X86_64),
+		Version:   uint32(elf.EV_CURRENT),
+		Shoff:     shOff,
+		Ehsize:    ehsize,
+		Shentsize: 64,
+		Shnum:     3,
+		Shstrndx:  2,
+	}
+	copy(hdr.Ident[:], elf.ELFMAG)
+	hdr.Ident[elf.EI_CLASS] = byte(elf.ELFCLASS64)
+	hdr.Ident[elf.EI_DATA] = byte(elf.ELFDATA2LSB)
+	hdr.Ident[elf.EI_VERSION] = byte(elf.EV_CURRENT)
+
+	sections := []elf.Section64{
+		{},
+		{Name: 1, Type: uint32(elf.SHT_NOTE), Flags: uint64(elf.SHF_ALLOC), Off: noteOff, Size: uint64(note.Len()), Addralign: 4},
+		{Name: 20, Type: uint32(elf.SHT_STRTAB), Off: strOff, Size: uint64(len(shstrtab)), Addralign: 1},
+	}
+
+	var buf bytes.Buffer
+	binary.Write(&buf, order, hdr)
+	buf.Write(note.Bytes())
+	buf.Write(shstrtab)
+	binary.Write(&buf, order, sections)
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBuildIDIndex(t *testing.T) {
+	dir := t.TempDir()
+	lib := filepath.Join(dir, "libfoo.so")
+	bin := filepath.Join(dir, "foo")
+	data := filepath.Join(dir, "data")
+	writeTestELF(t, lib, []byte{0xab, 0xcd, 0xef, 0x01})
+	writeTestELF(t, bin, []byte{0x12, 0x34})
+	if err := ioutil.WriteFile(data, []byte("not an ELF file"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	blobs := []PackageBlobInfo{
+		{SourcePath: data, Path: "meta/", Merkle: MerkleRoot{1}},
+		{SourcePath: lib, Path: "lib/libfoo.so", Merkle: MerkleRoot{2}},
+		{SourcePath: data, Path: "data/file", Merkle: MerkleRoot{3}},
+		{SourcePath: bin, Path: "bin/foo", Merkle: MerkleRoot{4}},
+	}
+	got, err := BuildIDIndex(blobs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []BuildIDEntry{
+		{BuildID: "1234", Path: "bin/foo", SourcePath: bin, Merkle: MerkleRoot{4}},
+		{BuildID: "abcdef01", Path: "lib/libfoo.so", SourcePath: lib, Merkle: MerkleRoot{2}},
+	}
+	if d := cmp.Diff(want, got); d != "" {
+		t.Errorf("BuildIDIndex (-want +got):\n%s", d)
+	}
+	if got, want := got[1].DebugPath(), "ab/cdef01.debug"; got != want {
+		t.Errorf("DebugPath() = %q, want %q", got, want)
+	}
+}
+
+func TestFindGNUBuildIDMalformedNotes(t *testing.T) {
+	note := func(namesz, descsz, typ uint32, payload []byte) []byte {
+		var b bytes.Buffer
+		binary.Write(&b, binary.LittleEndian, []uint32{namesz, descsz, typ})
+		b.Write(payload)
+		return b.Bytes()
+	}
+	payload := []byte("GNU\x00\x12\x34\x56\x78")
+	for name, data := range map[string][]byte{
+		// Aligning these sizes in 32 bits wraps around to 0.
+		"overflowing namesz": note(0xFFFFFFFD, 4, ntGNUBuildID, payload),
+		"overflowing descsz": note(4, 0xFFFFFFFD, ntGNUBuildID, payload),
+		"oversized namesz":   note(1024, 4, ntGNUBuildID, payload),
+		"truncated desc":     note(4, 16, ntGNUBuildID, payload),
+	} {
+		t.Run(name, func(t *testing.T) {
+			if id := findGNUBuildID(data, binary.LittleEndian); id != nil {
+				t.Errorf("findGNUBuildID() = %x, want nil", id)
+			}
+		})
+	}
+
+	if id := findGNUBuildID(note(4, 4, ntGNUBuildID, payload), binary.LittleEndian); !bytes.Equal(id, payload[4:]) {
+		t.Errorf("findGNUBuildID() = %x, want %x", id, payload[4:])
+	}
+}
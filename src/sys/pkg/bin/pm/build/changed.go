@@ -0,0 +1,89 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package build
+
+import "sort"
+
+// ManifestChanges describes how the blobs of a package changed from one build
+// to the next. Each slice is sorted by package path.
+type ManifestChanges struct {
+	// Added are the blobs at paths that were not in the previous build.
+	Added []PackageBlobInfo
+	// Changed are the blobs at paths whose merkle root changed.
+	Changed []PackageBlobInfo
+	// Removed are the blobs of the previous build at paths that are no
+	// longer in the package.
+	Removed []PackageBlobInfo
+
+	// previous holds the merkle roots of every blob of the previous build.
+	previous map[MerkleRoot]struct{}
+}
+
+// CompareManifests compares a freshly built package manifest against the
+// manifest of the previous build, which may be nil if there was none. The
+// meta.far is compared like any other blob, under its "meta/" path.
+func CompareManifests(previous, current *PackageManifest) ManifestChanges {
+	changes := ManifestChanges{previous: make(map[MerkleRoot]struct{})}
+
+	before := make(map[string]PackageBlobInfo)
+	if previous != nil {
+		for _, blob := range previous.Blobs {
+			before[blob.Path] = blob
+			changes.previous[blob.Merkle] = struct{}{}
+		}
+	}
+
+	after := make(map[string]struct{}, len(current.Blobs))
+	for _, blob := range current.Blobs {
+		after[blob.Path] = struct{}{}
+		old, ok := before[blob.Path]
+		switch {
+		case !ok:
+			changes.Added = append(changes.Added, blob)
+		case old.Merkle != blob.Merkle:
+			changes.Changed = append(changes.Changed, blob)
+		}
+	}
+	for path, blob := range before {
+		if _, ok := after[path]; !ok {
+			changes.Removed = append(changes.Removed, blob)
+		}
+	}
+
+	for _, blobs := range [][]PackageBlobInfo{changes.Added, changes.Changed, changes.Removed} {
+		sort.Slice(blobs, func(i, j int) bool {
+			return blobs[i].Path < blobs[j].Path
+		})
+	}
+	return changes
+}
+
+// Empty reports whether the package is unchanged.
+func (c ManifestChanges) Empty() bool {
+	return len(c.Added) == 0 && len(c.Changed) == 0 && len(c.Removed) == 0
+}
+
+// NewBlobs returns the added and changed blobs whose content was not part of
+// the previous build at any path, each merkle root once, sorted by package
+// path. These are the blobs that must be published or transferred for the
+// new build.
+func (c ManifestChanges) NewBlobs() []PackageBlobInfo {
+	var blobs []PackageBlobInfo
+	seen := make(map[MerkleRoot]struct{})
+	for _, blob := range append(append([]PackageBlobInfo{}, c.Added...), c.Changed...) {
+		if _, ok := c.previous[blob.Merkle]; ok {
+			continue
+		}
+		if _, ok := seen[blob.Merkle]; ok {
+			continue
+		}
+		seen[blob.Merkle] = struct{}{}
+		blobs = append(blobs, blob)
+	}
+	sort.Slice(blobs, func(i, j int) bool {
+		return blobs[i].Path < blobs[j].Path
+	})
+	return blobs
+}
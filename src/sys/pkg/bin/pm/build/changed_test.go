@@ -0,0 +1,66 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package build
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestCompareManifests(t *testing.T) {
+	previous := &PackageManifest{
+		Blobs: []PackageBlobInfo{
+			{Path: "meta/", Merkle: MerkleRoot{1}},
+			{Path: "a", Merkle: MerkleRoot{2}},
+			{Path: "b", Merkle: MerkleRoot{3}},
+			{Path: "c", Merkle: MerkleRoot{4}},
+		},
+	}
+	current := &PackageManifest{
+		Blobs: []PackageBlobInfo{
+			{Path: "meta/", Merkle: MerkleRoot{5}},
+			{Path: "a", Merkle: MerkleRoot{2}},
+			// Moved content is changed, but not new.
+			{Path: "b", Merkle: MerkleRoot{4}},
+			{Path: "d", Merkle: MerkleRoot{6}},
+			{Path: "e", Merkle: MerkleRoot{6}},
+		},
+	}
+
+	got := CompareManifests(previous, current)
+	want := ManifestChanges{
+		Added: []PackageBlobInfo{
+			{Path: "d", Merkle: MerkleRoot{6}},
+			{Path: "e", Merkle: MerkleRoot{6}},
+		},
+		Changed: []PackageBlobInfo{
+			{Path: "b", Merkle: MerkleRoot{4}},
+			{Path: "meta/", Merkle: MerkleRoot{5}},
+		},
+		Removed: []PackageBlobInfo{
+			{Path: "c", Merkle: MerkleRoot{4}},
+		},
+	}
+	if d := cmp.Diff(want, got, cmpopts.IgnoreUnexported(ManifestChanges{})); d != "" {
+		t.Errorf("CompareManifests (-want +got):\n%s", d)
+	}
+
+	wantNew := []PackageBlobInfo{
+		{Path: "d", Merkle: MerkleRoot{6}},
+		{Path: "meta/", Merkle: MerkleRoot{5}},
+	}
+	if d := cmp.Diff(wantNew, got.NewBlobs()); d != "" {
+		t.Errorf("NewBlobs (-want +got):\n%s", d)
+	}
+
+	if !CompareManifests(current, current).Empty() {
+		t.Error("a manifest compared with itself should be unchanged")
+	}
+	if got := CompareManifests(nil, current); len(got.Added) != len(current.Blobs) {
+		t.Errorf("got %d added blobs without a previous build, want %d", len(got.Added), len(current.Blobs))
+	}
+}
@@ -12,6 +12,7 @@ import (
 	"path/filepath"
 	"sort"
 	"strconv"
+	"strings"
 
 	versionHistory "go.fuchsia.dev/fuchsia/src/lib/versioning/version-history/go"
 	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/pkg"
@@ -28,6 +29,32 @@ type Config struct {
 	PkgVersion     string
 	PkgABIRevision uint64
 
+	// PkgMetadata is recorded as the Metadata of the output package manifest.
+	PkgMetadata map[string]string
+
+	// AllowedABIRevisions, if set, are the ABI revisions that Validate
+	// accepts. ABIRevisionWarnOnly downgrades a disallowed revision to a
+	// warning.
+	AllowedABIRevisions map[uint64]struct{}
+	ABIRevisionWarnOnly bool
+
+	// ConfigValues maps components, by name or manifest path, to structured
+	// config value files that Update places at meta/<component>.cvf.
+	ConfigValues map[string]string
+
+	// TrustPrecomputedMerkles makes Update use merkle roots precomputed in
+	// the creation manifest without checking them against their sources.
+	TrustPrecomputedMerkles bool
+
+	// Limits are checked against the package contents during Update.
+	Limits Limits
+
+	// SymlinkPolicy controls how symlinked package sources are handled.
+	SymlinkPolicy SymlinkPolicy
+
+	// Progress, if set, is called as Update and Seal make progress.
+	Progress ProgressFunc
+
 	// the manifest is memoized lazily, on the first call to Manifest()
 	manifest *Manifest
 }
@@ -79,6 +106,42 @@ func (c *Config) InitFlags(fs *flag.FlagSet) {
 	fs.StringVar(&c.TempDir, "t", c.TempDir, "temporary directory")
 	fs.StringVar(&c.PkgName, "n", c.PkgName, "name of the packages")
 	fs.StringVar(&c.PkgRepository, "r", c.PkgRepository, "repository of the packages")
+	fs.Func("allowed-abi-revisions", "path to a version_history.json listing the allowed ABI revisions", func(value string) error {
+		allowed, err := LoadAllowedABIRevisions(value)
+		if err != nil {
+			return err
+		}
+		c.AllowedABIRevisions = allowed
+		return nil
+	})
+	fs.BoolVar(&c.ABIRevisionWarnOnly, "abi-revision-warn-only", c.ABIRevisionWarnOnly, "warn rather than fail when the ABI revision is not allowed")
+	fs.Func("metadata", "annotate the output package manifest, as `key=value` (repeatable)", func(value string) error {
+		parts := strings.SplitN(value, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return fmt.Errorf("expected key=value, got %q", value)
+		}
+		if c.PkgMetadata == nil {
+			c.PkgMetadata = make(map[string]string)
+		}
+		c.PkgMetadata[parts[0]] = parts[1]
+		return nil
+	})
+	fs.Func("config-values", "structured config values for a component, as `component=path` (repeatable)", func(value string) error {
+		parts := strings.SplitN(value, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return fmt.Errorf("expected component=path, got %q", value)
+		}
+		if c.ConfigValues == nil {
+			c.ConfigValues = make(map[string]string)
+		}
+		c.ConfigValues[parts[0]] = parts[1]
+		return nil
+	})
+	fs.BoolVar(&c.TrustPrecomputedMerkles, "trust-precomputed-merkles", c.TrustPrecomputedMerkles, "use merkle roots given in the build manifest without size or spot checks")
+	fs.Uint64Var(&c.Limits.MaxBlobSize, "max-blob-size", c.Limits.MaxBlobSize, "maximum size in bytes of a content blob (0 for no limit)")
+	fs.IntVar(&c.Limits.MaxBlobCount, "max-blob-count", c.Limits.MaxBlobCount, "maximum number of blobs in the package (0 for no limit)")
+	fs.IntVar(&c.Limits.MaxPathLength, "max-path-length", c.Limits.MaxPathLength, "maximum length of a path within the package (0 for no limit)")
+	fs.Var(&c.SymlinkPolicy, "symlinks", "how to handle symlinked package sources: follow, forbid or record-target")
 	fs.Func("api-level", "package API level", func(value string) error {
 		if c.PkgABIRevision != 0 {
 			return fmt.Errorf("cannot specify both --api-level and --abi-revision")
@@ -139,10 +202,22 @@ func (c *Config) Manifest() (*Manifest, error) {
 			err = os.ErrNotExist
 		}
 		c.manifest, err = NewManifest(sources)
+		if err == nil {
+			if err = c.manifest.ApplySymlinkPolicy(c.SymlinkPolicy); err != nil {
+				c.manifest = nil
+			}
+		}
 	}
 	return c.manifest, err
 }
 
+// ResetManifest discards the memoized manifest, so that the next call to
+// Manifest() re-reads it from its sources. Long running commands use this to
+// pick up changes to the manifest between builds.
+func (c *Config) ResetManifest() {
+	c.manifest = nil
+}
+
 // MetaFAR returns the path to the meta.far that build.Seal generates
 func (c *Config) MetaFAR() string {
 	return filepath.Join(c.OutputDir, "meta.far")
@@ -252,5 +327,6 @@ func (c *Config) OutputManifest() (*PackageManifest, error) {
 		Repository: c.PkgRepository,
 		Package:    p,
 		Blobs:      blobs,
+		Metadata:   c.PkgMetadata,
 	}, err
 }
@@ -0,0 +1,64 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package build
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// ErrComponentNotFound is returned when structured config values are provided
+// for a component that is not in the package.
+type ErrComponentNotFound struct {
+	// Manifest is the expected path of the component manifest.
+	Manifest string
+	// Source is the config value file that targets the component.
+	Source string
+}
+
+func (e ErrComponentNotFound) Error() string {
+	return fmt.Sprintf("pkg: config values %s target component %q, which is not in the package", e.Source, e.Manifest)
+}
+
+// componentPaths returns the package paths of the component manifest and the
+// config value file of the component named by key, which is either a
+// component name ("foo") or a component manifest path ("meta/foo.cm").
+func componentPaths(key string) (manifest, values string) {
+	name := strings.TrimSuffix(strings.TrimPrefix(key, "meta/"), ".cm")
+	return "meta/" + name + ".cm", "meta/" + name + ".cvf"
+}
+
+// injectConfigValues adds the configured structured config value files to the
+// manifest at meta/<component>.cvf, checking that each target component is in
+// the package. All problems found are reported together.
+func injectConfigValues(cfg *Config, manifest *Manifest) error {
+	keys := make([]string, 0, len(cfg.ConfigValues))
+	for key := range cfg.ConfigValues {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var errs FileErrors
+	for _, key := range keys {
+		src := cfg.ConfigValues[key]
+		cm, cvf := componentPaths(key)
+		if _, ok := manifest.Paths[cm]; !ok {
+			errs = append(errs, ErrComponentNotFound{Manifest: cm, Source: src})
+			continue
+		}
+		if existing, ok := manifest.Paths[cvf]; ok && existing != src {
+			errs = append(errs, fmt.Errorf("pkg: config values %s for %q conflict with %s", src, cvf, existing))
+			continue
+		}
+		if _, err := os.Stat(src); err != nil {
+			errs = append(errs, fmt.Errorf("pkg: config values for %q: %w", cm, err))
+			continue
+		}
+		manifest.Paths[cvf] = src
+	}
+	return errs.ErrorOrNil()
+}
@@ -0,0 +1,74 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package build
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testPackageWithComponent creates a test package that contains a component
+// manifest at meta/foo.cm, and returns a config value file for it.
+func testPackageWithComponent(t *testing.T, cfg *Config) string {
+	TestPackage(cfg)
+	dir := t.TempDir()
+	cm := filepath.Join(dir, "foo.cm")
+	cvf := filepath.Join(dir, "foo.cvf")
+	for _, path := range []string{cm, cvf} {
+		if err := ioutil.WriteFile(path, []byte(filepath.Base(path)), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f, err := os.OpenFile(cfg.ManifestPath, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := fmt.Fprintf(f, "meta/foo.cm=%s\n", cm); err != nil {
+		t.Fatal(err)
+	}
+	return cvf
+}
+
+func TestUpdateInjectsConfigValues(t *testing.T) {
+	for _, key := range []string{"foo", "meta/foo.cm"} {
+		t.Run(key, func(t *testing.T) {
+			cfg := TestConfig()
+			defer os.RemoveAll(filepath.Dir(cfg.TempDir))
+			cvf := testPackageWithComponent(t, cfg)
+			cfg.ConfigValues = map[string]string{key: cvf}
+
+			if err := Update(cfg); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := Seal(cfg); err != nil {
+				t.Fatal(err)
+			}
+			manifest, err := cfg.Manifest()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := manifest.Meta()["meta/foo.cvf"]; got != cvf {
+				t.Errorf("meta/foo.cvf = %q, want %q", got, cvf)
+			}
+		})
+	}
+}
+
+func TestUpdateConfigValuesForMissingComponent(t *testing.T) {
+	cfg := TestConfig()
+	defer os.RemoveAll(filepath.Dir(cfg.TempDir))
+	cvf := testPackageWithComponent(t, cfg)
+	cfg.ConfigValues = map[string]string{"bar": cvf}
+
+	var notFound ErrComponentNotFound
+	if err := Update(cfg); !errors.As(err, &notFound) || notFound.Manifest != "meta/bar.cm" {
+		t.Fatalf("got error %v, want ErrComponentNotFound for meta/bar.cm", err)
+	}
+}
@@ -0,0 +1,240 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package build
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"go.fuchsia.dev/fuchsia/src/sys/pkg/lib/merkle"
+)
+
+// DeliveryBlobType identifies the format of a delivery blob, the form in which
+// a blob is transferred to and written by a device.
+type DeliveryBlobType uint32
+
+const (
+	// DeliveryBlobType1 is a blob compressed with chunked zstd.
+	DeliveryBlobType1 DeliveryBlobType = 1
+)
+
+// deliveryBlobMagic starts the header of every delivery blob.
+var deliveryBlobMagic = [4]byte{0xfc, 0x1a, 0xb1, 0x0b}
+
+// DeliveryBlobType1HeaderLength is the length of the header of a type 1
+// delivery blob, which is followed by its payload.
+const DeliveryBlobType1HeaderLength = 28
+
+// deliveryBlobType1IsCompressed is set in the flags of a type 1 delivery blob
+// whose payload is compressed.
+const deliveryBlobType1IsCompressed = 1 << 0
+
+// DeliveryBlobType1Header returns the header of a type 1 delivery blob with an
+// uncompressed payload of the given length. Without a zstd implementation
+// available, this is the only form of delivery blob pm can produce, and is
+// accepted by devices like any other.
+func DeliveryBlobType1Header(payloadLength uint64) []byte {
+	h := make([]byte, DeliveryBlobType1HeaderLength)
+	copy(h[0:4], deliveryBlobMagic[:])
+	binary.LittleEndian.PutUint32(h[4:8], uint32(DeliveryBlobType1))
+	binary.LittleEndian.PutUint32(h[8:12], DeliveryBlobType1HeaderLength)
+	binary.LittleEndian.PutUint64(h[12:20], payloadLength)
+	// The checksum at h[20:24] covers the header with the checksum zeroed.
+	binary.LittleEndian.PutUint32(h[24:28], 0)
+	binary.LittleEndian.PutUint32(h[20:24], crc32.ChecksumIEEE(h))
+	return h
+}
+
+// WriteDeliveryBlobType1 writes the type 1 delivery blob of the blob of the
+// given size read from r to w.
+func WriteDeliveryBlobType1(w io.Writer, r io.Reader, size uint64) error {
+	if _, err := w.Write(DeliveryBlobType1Header(size)); err != nil {
+		return err
+	}
+	n, err := io.Copy(w, r)
+	if err != nil {
+		return err
+	}
+	if uint64(n) != size {
+		return fmt.Errorf("pkg: delivery blob payload is %d bytes, want %d", n, size)
+	}
+	return nil
+}
+
+// WriteDeliveryBlobs writes the type 1 delivery blob of each of the given
+// blobs to dir, named by the merkle root of the blob, and records it in the
+// DeliveryBlobs of the blob, replacing any type 1 delivery blob recorded
+// before.
+func WriteDeliveryBlobs(blobs []PackageBlobInfo, dir string) error {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return err
+	}
+	written := make(map[MerkleRoot]DeliveryBlobInfo)
+	for i, blob := range blobs {
+		d, ok := written[blob.Merkle]
+		if !ok {
+			var err error
+			if d, err = writeDeliveryBlob(blob, filepath.Join(dir, blob.Merkle.String())); err != nil {
+				return err
+			}
+			written[blob.Merkle] = d
+		}
+		deliveryBlobs := []DeliveryBlobInfo{d}
+		for _, e := range blob.DeliveryBlobs {
+			if e.Type != DeliveryBlobType1 {
+				deliveryBlobs = append(deliveryBlobs, e)
+			}
+		}
+		blobs[i].DeliveryBlobs = deliveryBlobs
+	}
+	return nil
+}
+
+// writeDeliveryBlob writes the type 1 delivery blob of blob to path.
+func writeDeliveryBlob(blob PackageBlobInfo, path string) (DeliveryBlobInfo, error) {
+	src, err := os.Open(blob.SourcePath)
+	if err != nil {
+		return DeliveryBlobInfo{}, err
+	}
+	defer src.Close()
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path))
+	if err != nil {
+		return DeliveryBlobInfo{}, err
+	}
+	defer os.Remove(f.Name())
+
+	// The delivery blob is identified by its own merkle root, read back once
+	// it is written.
+	var tree merkle.Tree
+	var n int64
+	err = WriteDeliveryBlobType1(f, src, blob.Size)
+	if err == nil {
+		_, err = f.Seek(0, io.SeekStart)
+	}
+	if err == nil {
+		n, err = tree.ReadFrom(f)
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return DeliveryBlobInfo{}, fmt.Errorf("pkg: writing delivery blob of %s: %w", blob.SourcePath, err)
+	}
+	if err := os.Chmod(f.Name(), 0644); err != nil {
+		return DeliveryBlobInfo{}, err
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		return DeliveryBlobInfo{}, err
+	}
+	d := DeliveryBlobInfo{Type: DeliveryBlobType1, Size: uint64(n), SourcePath: path}
+	copy(d.Hash[:], tree.Root())
+	return d, nil
+}
+
+// errCompressedDeliveryBlob is returned when reading a delivery blob whose
+// payload is compressed, which pm has no zstd implementation to decompress.
+var errCompressedDeliveryBlob = errors.New("pkg: compressed delivery blobs are not supported")
+
+// readDeliveryBlobType1Header reads and validates the header of a type 1
+// delivery blob from r, returning the payload length and whether the payload
+// is compressed.
+func readDeliveryBlobType1Header(r io.Reader) (uint64, bool, error) {
+	h := make([]byte, DeliveryBlobType1HeaderLength)
+	if _, err := io.ReadFull(r, h); err != nil {
+		return 0, false, fmt.Errorf("pkg: reading delivery blob header: %w", err)
+	}
+	if !bytes.Equal(h[0:4], deliveryBlobMagic[:]) {
+		return 0, false, fmt.Errorf("pkg: invalid delivery blob magic %x", h[0:4])
+	}
+	if t := DeliveryBlobType(binary.LittleEndian.Uint32(h[4:8])); t != DeliveryBlobType1 {
+		return 0, false, fmt.Errorf("pkg: unsupported delivery blob type %d", t)
+	}
+	if l := binary.LittleEndian.Uint32(h[8:12]); l != DeliveryBlobType1HeaderLength {
+		return 0, false, fmt.Errorf("pkg: invalid delivery blob header length %d", l)
+	}
+	checksum := binary.LittleEndian.Uint32(h[20:24])
+	binary.LittleEndian.PutUint32(h[20:24], 0)
+	if got := crc32.ChecksumIEEE(h); got != checksum {
+		return 0, false, fmt.Errorf("pkg: delivery blob header checksum is %08x, want %08x", got, checksum)
+	}
+	flags := binary.LittleEndian.Uint32(h[24:28])
+	if flags&^deliveryBlobType1IsCompressed != 0 {
+		return 0, false, fmt.Errorf("pkg: unknown delivery blob flags %#x", flags)
+	}
+	return binary.LittleEndian.Uint64(h[12:20]), flags&deliveryBlobType1IsCompressed != 0, nil
+}
+
+// deliveryBlobMerkle reads the type 1 delivery blob from r and returns the
+// merkle root and size of the blob it contains. Only uncompressed payloads, as
+// WriteDeliveryBlobType1 writes, can be read.
+func deliveryBlobMerkle(r io.Reader) (MerkleRoot, uint64, error) {
+	payloadLength, compressed, err := readDeliveryBlobType1Header(r)
+	if err != nil {
+		return MerkleRoot{}, 0, err
+	}
+	if compressed {
+		return MerkleRoot{}, 0, errCompressedDeliveryBlob
+	}
+	var tree merkle.Tree
+	n, err := tree.ReadFrom(io.LimitReader(r, int64(payloadLength)))
+	if err != nil {
+		return MerkleRoot{}, 0, err
+	}
+	if uint64(n) != payloadLength {
+		return MerkleRoot{}, 0, fmt.Errorf("pkg: delivery blob payload is %d bytes, want %d", n, payloadLength)
+	}
+	var root MerkleRoot
+	copy(root[:], tree.Root())
+	return root, uint64(n), nil
+}
+
+// DeliveryBlobInfo identifies the delivery blob of a given type for a blob.
+// The blob itself is still identified by the merkle root of its uncompressed
+// contents.
+type DeliveryBlobInfo struct {
+	// The format of the delivery blob
+	Type DeliveryBlobType `json:"type"`
+
+	// Hash of the delivery blob file
+	Hash MerkleRoot `json:"hash"`
+
+	// Size of the delivery blob, in bytes
+	Size uint64 `json:"size"`
+
+	// The path of the delivery blob relative to the output directory, if it
+	// has been generated
+	SourcePath string `json:"source_path,omitempty"`
+}
+
+// DeliveryBlob returns the delivery blob of the given type for the blob, if
+// the manifest records one.
+func (b PackageBlobInfo) DeliveryBlob(t DeliveryBlobType) (DeliveryBlobInfo, bool) {
+	for _, d := range b.DeliveryBlobs {
+		if d.Type == t {
+			return d, true
+		}
+	}
+	return DeliveryBlobInfo{}, false
+}
+
+// validateDeliveryBlobs checks that a blob records at most one delivery blob
+// of each type.
+func validateDeliveryBlobs(b PackageBlobInfo) error {
+	seen := make(map[DeliveryBlobType]struct{}, len(b.DeliveryBlobs))
+	for _, d := range b.DeliveryBlobs {
+		if _, ok := seen[d.Type]; ok {
+			return fmt.Errorf("pkg: blob %s for %q has more than one delivery blob of type %d", b.Merkle, b.Path, d.Type)
+		}
+		seen[d.Type] = struct{}{}
+	}
+	return nil
+}
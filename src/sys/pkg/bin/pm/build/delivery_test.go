@@ -0,0 +1,255 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package build
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"go.fuchsia.dev/fuchsia/src/sys/pkg/lib/merkle"
+)
+
+func TestPackageBlobInfoJSONWithoutDeliveryBlobs(t *testing.T) {
+	b, err := json.Marshal(PackageBlobInfo{SourcePath: "a", Path: "a", Size: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), "delivery_blobs") {
+		t.Errorf("got %s, want no delivery_blobs field", b)
+	}
+}
+
+func TestLoadPackageManifestDeliveryBlobs(t *testing.T) {
+	dir := createBuildDir(t, map[string]string{
+		"package_manifest.json": `{
+			"version": "1",
+			"package": {"name": "foo", "version": "0"},
+			"blobs": [
+				{
+					"source_path": "blobs/a",
+					"path": "a",
+					"merkle": "1111111111111111111111111111111111111111111111111111111111111111",
+					"size": 100,
+					"delivery_blobs": [
+						{
+							"type": 1,
+							"hash": "2222222222222222222222222222222222222222222222222222222222222222",
+							"size": 40,
+							"source_path": "delivery/a"
+						}
+					]
+				}
+			],
+			"blob_sources_relative": "file"
+		}`,
+	})
+
+	m, err := LoadPackageManifest(filepath.Join(dir, "package_manifest.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, ok := m.Blobs[0].DeliveryBlob(DeliveryBlobType1)
+	if !ok {
+		t.Fatal("missing type 1 delivery blob")
+	}
+	want := DeliveryBlobInfo{
+		Type:       DeliveryBlobType1,
+		Hash:       MustDecodeMerkleRoot("2222222222222222222222222222222222222222222222222222222222222222"),
+		Size:       40,
+		SourcePath: filepath.Join(dir, "delivery", "a"),
+	}
+	if d := cmp.Diff(want, got); d != "" {
+		t.Errorf("delivery blob (-want +got):\n%s", d)
+	}
+	if _, ok := m.Blobs[0].DeliveryBlob(2); ok {
+		t.Error("unexpected type 2 delivery blob")
+	}
+}
+
+func TestLoadPackageManifestDuplicateDeliveryBlobTypes(t *testing.T) {
+	dir := createBuildDir(t, map[string]string{
+		"package_manifest.json": `{
+			"version": "1",
+			"blobs": [
+				{
+					"path": "a",
+					"merkle": "1111111111111111111111111111111111111111111111111111111111111111",
+					"delivery_blobs": [
+						{"type": 1, "hash": "2222222222222222222222222222222222222222222222222222222222222222", "size": 40},
+						{"type": 1, "hash": "3333333333333333333333333333333333333333333333333333333333333333", "size": 41}
+					]
+				}
+			]
+		}`,
+	})
+	if _, err := LoadPackageManifest(filepath.Join(dir, "package_manifest.json")); err == nil {
+		t.Fatal("expected an error for duplicate delivery blob types")
+	}
+}
+
+func TestAggregateBlobsMergesDeliveryBlobs(t *testing.T) {
+	type1 := DeliveryBlobInfo{Type: DeliveryBlobType1, Hash: MerkleRoot{2}, Size: 5}
+	type2 := DeliveryBlobInfo{Type: 2, Hash: MerkleRoot{3}, Size: 6}
+	a := &PackageManifest{Blobs: []PackageBlobInfo{
+		{SourcePath: "a", Path: "a", Merkle: MerkleRoot{1}, Size: 10, DeliveryBlobs: []DeliveryBlobInfo{type2}},
+	}}
+	b := &PackageManifest{Blobs: []PackageBlobInfo{
+		{SourcePath: "b", Path: "b", Merkle: MerkleRoot{1}, Size: 10, DeliveryBlobs: []DeliveryBlobInfo{type1, type2}},
+	}}
+
+	got, err := AggregateBlobs(a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []BlobsJSONEntry{
+		{SourcePath: "a", Merkle: MerkleRoot{1}, Size: 10, DeliveryBlobs: []DeliveryBlobInfo{type1, type2}},
+	}
+	if d := cmp.Diff(want, got); d != "" {
+		t.Errorf("AggregateBlobs (-want +got):\n%s", d)
+	}
+
+	conflicting := &PackageManifest{Blobs: []PackageBlobInfo{
+		{SourcePath: "c", Path: "c", Merkle: MerkleRoot{1}, Size: 10, DeliveryBlobs: []DeliveryBlobInfo{
+			{Type: DeliveryBlobType1, Hash: MerkleRoot{9}, Size: 5},
+		}},
+	}}
+	if _, err := AggregateBlobs(a, b, conflicting); err == nil {
+		t.Error("expected an error for conflicting delivery blobs")
+	}
+}
+
+func TestWriteDeliveryBlobType1(t *testing.T) {
+	var b bytes.Buffer
+	if err := WriteDeliveryBlobType1(&b, strings.NewReader("payload"), 7); err != nil {
+		t.Fatal(err)
+	}
+	got := b.Bytes()
+	if len(got) != DeliveryBlobType1HeaderLength+7 {
+		t.Fatalf("got %d bytes, want %d", len(got), DeliveryBlobType1HeaderLength+7)
+	}
+	if !bytes.Equal(got[:4], deliveryBlobMagic[:]) {
+		t.Errorf("got magic %x, want %x", got[:4], deliveryBlobMagic)
+	}
+	if typ := binary.LittleEndian.Uint32(got[4:8]); typ != uint32(DeliveryBlobType1) {
+		t.Errorf("got type %d, want 1", typ)
+	}
+	if l := binary.LittleEndian.Uint64(got[12:20]); l != 7 {
+		t.Errorf("got payload length %d, want 7", l)
+	}
+	if flags := binary.LittleEndian.Uint32(got[24:28]); flags&deliveryBlobType1IsCompressed != 0 {
+		t.Errorf("got flags %x, want uncompressed", flags)
+	}
+	header := append([]byte(nil), got[:DeliveryBlobType1HeaderLength]...)
+	checksum := binary.LittleEndian.Uint32(header[20:24])
+	binary.LittleEndian.PutUint32(header[20:24], 0)
+	if want := crc32.ChecksumIEEE(header); checksum != want {
+		t.Errorf("got checksum %x, want %x", checksum, want)
+	}
+	if string(got[DeliveryBlobType1HeaderLength:]) != "payload" {
+		t.Errorf("got payload %q", got[DeliveryBlobType1HeaderLength:])
+	}
+
+	if err := WriteDeliveryBlobType1(&b, strings.NewReader("short"), 7); err == nil {
+		t.Error("expected an error for a short payload")
+	}
+}
+
+func TestDeliveryBlobMerkle(t *testing.T) {
+	payload := bytes.Repeat([]byte("blob"), 5000)
+	var tree merkle.Tree
+	if _, err := tree.ReadFrom(bytes.NewReader(payload)); err != nil {
+		t.Fatal(err)
+	}
+	var want MerkleRoot
+	copy(want[:], tree.Root())
+
+	var b bytes.Buffer
+	if err := WriteDeliveryBlobType1(&b, bytes.NewReader(payload), uint64(len(payload))); err != nil {
+		t.Fatal(err)
+	}
+	blob := b.Bytes()
+	root, size, err := deliveryBlobMerkle(bytes.NewReader(blob))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root != want || size != uint64(len(payload)) {
+		t.Errorf("got %s and %d bytes, want %s and %d bytes", root, size, want, len(payload))
+	}
+
+	corrupt := func(f func(h []byte)) []byte {
+		c := append([]byte(nil), blob...)
+		f(c)
+		return c
+	}
+	compressed := corrupt(func(h []byte) {
+		binary.LittleEndian.PutUint32(h[24:28], deliveryBlobType1IsCompressed)
+		binary.LittleEndian.PutUint32(h[20:24], 0)
+		binary.LittleEndian.PutUint32(h[20:24], crc32.ChecksumIEEE(h[:DeliveryBlobType1HeaderLength]))
+	})
+	if _, _, err := deliveryBlobMerkle(bytes.NewReader(compressed)); !errors.Is(err, errCompressedDeliveryBlob) {
+		t.Errorf("compressed payload: got %v, want errCompressedDeliveryBlob", err)
+	}
+	for name, c := range map[string][]byte{
+		"bad magic":     corrupt(func(h []byte) { h[0] = 0 }),
+		"bad checksum":  corrupt(func(h []byte) { h[20]++ }),
+		"short payload": blob[:len(blob)-1],
+		"short header":  blob[:10],
+	} {
+		if _, _, err := deliveryBlobMerkle(bytes.NewReader(c)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestWriteDeliveryBlobs(t *testing.T) {
+	cfg := TestConfig()
+	defer os.RemoveAll(filepath.Dir(cfg.TempDir))
+	BuildTestPackage(cfg)
+	blobs, err := cfg.BlobInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := filepath.Join(t.TempDir(), "delivery_blobs")
+	if err := WriteDeliveryBlobs(blobs, dir); err != nil {
+		t.Fatal(err)
+	}
+	for _, blob := range blobs {
+		d, ok := blob.DeliveryBlob(DeliveryBlobType1)
+		if !ok {
+			t.Errorf("blob %s for %q has no type 1 delivery blob", blob.Merkle, blob.Path)
+			continue
+		}
+		if want := filepath.Join(dir, blob.Merkle.String()); d.SourcePath != want {
+			t.Errorf("blob %s: got delivery blob at %s, want %s", blob.Merkle, d.SourcePath, want)
+		}
+		if err := VerifyBlob(d.SourcePath, blob.Merkle, int64(blob.Size)); err != nil {
+			t.Error(err)
+		}
+		b, err := ioutil.ReadFile(d.SourcePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var tree merkle.Tree
+		if _, err := tree.ReadFrom(bytes.NewReader(b)); err != nil {
+			t.Fatal(err)
+		}
+		var hash MerkleRoot
+		copy(hash[:], tree.Root())
+		if d.Hash != hash || d.Size != uint64(len(b)) {
+			t.Errorf("blob %s: got delivery blob %s (%d bytes), want %s (%d bytes)", blob.Merkle, d.Hash, d.Size, hash, len(b))
+		}
+	}
+}
@@ -0,0 +1,37 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package build
+
+import (
+	"sort"
+	"strings"
+)
+
+// FileErrors aggregates the errors found for individual files of a package, so
+// that a broken build can be fixed in one pass instead of one file at a time.
+type FileErrors []error
+
+func (e FileErrors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// ErrorOrNil returns nil if there are no errors, the error itself if there is
+// exactly one, and otherwise all the errors sorted by their message.
+func (e FileErrors) ErrorOrNil() error {
+	switch len(e) {
+	case 0:
+		return nil
+	case 1:
+		return e[0]
+	}
+	sort.Slice(e, func(i, j int) bool {
+		return e[i].Error() < e[j].Error()
+	})
+	return e
+}
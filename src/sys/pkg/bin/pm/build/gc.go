@@ -0,0 +1,102 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package build
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// GarbageCollect removes every file under cfg.OutputDir that is not reachable
+// from the current package manifest, and is not one of the outputs of sealing
+// the package or listed in keep. It returns the paths of the files that were
+// removed, in sorted order. If dryRun is true, nothing is removed and the
+// returned paths are the files that would have been removed.
+//
+// Directories left empty by the collection are removed as well.
+func GarbageCollect(cfg *Config, keep []string, dryRun bool) ([]string, error) {
+	manifest, err := cfg.Manifest()
+	if err != nil {
+		return nil, err
+	}
+
+	outputDir, err := filepath.Abs(cfg.OutputDir)
+	if err != nil {
+		return nil, err
+	}
+
+	reachable := map[string]struct{}{}
+	addReachable := func(path string) error {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return err
+		}
+		reachable[abs] = struct{}{}
+		return nil
+	}
+
+	paths := []string{
+		cfg.MetaFAR(),
+		cfg.MetaFARMerkle(),
+		filepath.Join(cfg.OutputDir, "meta", "contents"),
+		cfg.ManifestPath,
+	}
+	paths = append(paths, keep...)
+	for _, src := range manifest.Paths {
+		paths = append(paths, src)
+	}
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		if err := addReachable(path); err != nil {
+			return nil, err
+		}
+	}
+
+	var garbage []string
+	var dirs []string
+	err = filepath.Walk(outputDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if path != outputDir {
+				dirs = append(dirs, path)
+			}
+			return nil
+		}
+		if _, ok := reachable[path]; !ok {
+			garbage = append(garbage, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("build.GarbageCollect: %s", err)
+	}
+	sort.Strings(garbage)
+
+	if dryRun {
+		return garbage, nil
+	}
+
+	for _, path := range garbage {
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("build.GarbageCollect: %s", err)
+		}
+	}
+
+	// Remove directories deepest first, so that parents which only contained
+	// empty directories are removed too. Non-empty directories fail to be
+	// removed, which is expected.
+	sort.Sort(sort.Reverse(sort.StringSlice(dirs)))
+	for _, dir := range dirs {
+		os.Remove(dir)
+	}
+
+	return garbage, nil
+}
@@ -0,0 +1,70 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package build
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestGarbageCollect(t *testing.T) {
+	cfg := TestConfig()
+	defer os.RemoveAll(filepath.Dir(cfg.TempDir))
+	BuildTestPackage(cfg)
+
+	pkgManifestPath := filepath.Join(cfg.OutputDir, "package_manifest.json")
+	stale := []string{
+		filepath.Join(cfg.OutputDir, "blobs.json"),
+		filepath.Join(cfg.OutputDir, "meta", "old"),
+		filepath.Join(cfg.OutputDir, "stale", "dir", "blob"),
+	}
+	for _, path := range stale {
+		if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte("stale"), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	garbage, err := GarbageCollect(cfg, []string{pkgManifestPath}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(stale, garbage); diff != "" {
+		t.Errorf("dry run garbage mismatch (-want +got):\n%s", diff)
+	}
+	for _, path := range stale {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("dry run removed %s: %s", path, err)
+		}
+	}
+
+	garbage, err = GarbageCollect(cfg, []string{pkgManifestPath}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(stale, garbage); diff != "" {
+		t.Errorf("garbage mismatch (-want +got):\n%s", diff)
+	}
+	for _, path := range stale {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be removed, got %v", path, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(cfg.OutputDir, "stale")); !os.IsNotExist(err) {
+		t.Errorf("expected empty directory to be removed, got %v", err)
+	}
+
+	for _, path := range []string{cfg.MetaFAR(), cfg.MetaFARMerkle(), pkgManifestPath, filepath.Join(cfg.OutputDir, "meta", "contents")} {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("expected %s to be kept: %s", path, err)
+		}
+	}
+}
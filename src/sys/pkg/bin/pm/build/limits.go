@@ -0,0 +1,97 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package build
+
+import (
+	"fmt"
+	"os"
+	"sort"
+)
+
+// Limits are the practical limits of blobfs that packages are checked against
+// during Update, so that oversized packages fail at build time rather than
+// when they are paved or resolved. A zero value disables the corresponding
+// check.
+type Limits struct {
+	// MaxBlobSize is the maximum size in bytes of any content blob.
+	MaxBlobSize uint64
+	// MaxBlobCount is the maximum number of blobs in the package, including
+	// the meta.far.
+	MaxBlobCount int
+	// MaxPathLength is the maximum length in bytes of a path within the
+	// package.
+	MaxPathLength int
+}
+
+// ErrLimitExceeded is returned when a package exceeds one of its Limits.
+type ErrLimitExceeded struct {
+	// Limit names the limit that was exceeded.
+	Limit string
+	// Path is the offending path within the package, if any.
+	Path string
+	// Source is the source of the offending file, if any.
+	Source string
+	Value  uint64
+	Max    uint64
+}
+
+func (e ErrLimitExceeded) Error() string {
+	switch {
+	case e.Source != "":
+		return fmt.Sprintf("pkg: %q (from %s) exceeds the %s: %d > %d", e.Path, e.Source, e.Limit, e.Value, e.Max)
+	case e.Path != "":
+		return fmt.Sprintf("pkg: %q exceeds the %s: %d > %d", e.Path, e.Limit, e.Value, e.Max)
+	default:
+		return fmt.Sprintf("pkg: package exceeds the %s: %d > %d", e.Limit, e.Value, e.Max)
+	}
+}
+
+// check validates the given package contents, a map of package path to source
+// path, against the limits, reporting every violation.
+func (l Limits) check(contents map[string]string) error {
+	var errs FileErrors
+
+	// Content blobs plus the meta.far.
+	if count := len(contents) + 1; l.MaxBlobCount > 0 && count > l.MaxBlobCount {
+		errs = append(errs, ErrLimitExceeded{
+			Limit: "maximum blob count",
+			Value: uint64(count),
+			Max:   uint64(l.MaxBlobCount),
+		})
+	}
+
+	dests := make([]string, 0, len(contents))
+	for dest := range contents {
+		dests = append(dests, dest)
+	}
+	sort.Strings(dests)
+
+	for _, dest := range dests {
+		src := contents[dest]
+		if l.MaxPathLength > 0 && len(dest) > l.MaxPathLength {
+			errs = append(errs, ErrLimitExceeded{
+				Limit:  "maximum path length",
+				Path:   dest,
+				Source: src,
+				Value:  uint64(len(dest)),
+				Max:    uint64(l.MaxPathLength),
+			})
+		}
+		if l.MaxBlobSize > 0 {
+			// Missing sources are reported by the caller.
+			if info, err := os.Stat(src); err == nil && uint64(info.Size()) > l.MaxBlobSize {
+				errs = append(errs, ErrLimitExceeded{
+					Limit:  "maximum blob size",
+					Path:   dest,
+					Source: src,
+					Value:  uint64(info.Size()),
+					Max:    l.MaxBlobSize,
+				})
+			}
+		}
+	}
+
+	return errs.ErrorOrNil()
+}
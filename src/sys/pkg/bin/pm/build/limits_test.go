@@ -0,0 +1,84 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package build
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestUpdateLimits(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		limits    Limits
+		wantLimit string
+		wantPaths []string
+	}{
+		{
+			name:   "no limits",
+			limits: Limits{},
+		},
+		{
+			name:   "within limits",
+			limits: Limits{MaxBlobSize: 1024, MaxBlobCount: 10, MaxPathLength: 10},
+		},
+		{
+			name:      "blob too large",
+			limits:    Limits{MaxBlobSize: 50},
+			wantLimit: "maximum blob size",
+			wantPaths: []string{"rand1", "rand2"},
+		},
+		{
+			name:      "too many blobs",
+			limits:    Limits{MaxBlobCount: 3},
+			wantLimit: "maximum blob count",
+			wantPaths: []string{""},
+		},
+		{
+			name:      "path too long",
+			limits:    Limits{MaxPathLength: 4},
+			wantLimit: "maximum path length",
+			wantPaths: []string{"dir/c", "rand1", "rand2"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := TestConfig()
+			defer os.RemoveAll(filepath.Dir(cfg.TempDir))
+			TestPackage(cfg)
+			cfg.Limits = tc.limits
+
+			err := Update(cfg)
+			if tc.wantLimit == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+
+			errs, ok := err.(FileErrors)
+			if !ok {
+				errs = FileErrors{err}
+			}
+			var gotPaths []string
+			for _, err := range errs {
+				var limitErr ErrLimitExceeded
+				if !errors.As(err, &limitErr) {
+					t.Fatalf("got error %v, want ErrLimitExceeded", err)
+				}
+				if limitErr.Limit != tc.wantLimit {
+					t.Errorf("got %s exceeded, want %s", limitErr.Limit, tc.wantLimit)
+				}
+				gotPaths = append(gotPaths, limitErr.Path)
+			}
+			if d := cmp.Diff(tc.wantPaths, gotPaths); d != "" {
+				t.Errorf("exceeded paths (-want +got):\n%s", d)
+			}
+		})
+	}
+}
@@ -25,6 +25,9 @@ type Manifest struct {
 	Srcs []string
 	// Paths is the fully computed contents of a package in the form of "destination": "source"
 	Paths map[string]string
+	// Precomputed holds the merkle roots and sizes supplied by manifest files
+	// for some destinations, see NewManifest.
+	Precomputed map[string]PrecomputedBlob
 }
 
 // NewManifest initializes a manifest from the given paths. If a path is a
@@ -32,11 +35,14 @@ type Manifest struct {
 // that directory. If the path is a manifest file, the file is parsed and all
 // files are mapped as described by the manifest file. Manifest files contain
 // lines with "destination=source". Lines that do not match this pattern are
-// ignored.
+// ignored. A line may also give the merkle root and size of its source, as in
+// "destination=source merkle=<root> size=<bytes>", to spare Update from
+// hashing it.
 func NewManifest(paths []string) (*Manifest, error) {
 	m := &Manifest{
-		Srcs:  paths,
-		Paths: make(map[string]string),
+		Srcs:        paths,
+		Paths:       make(map[string]string),
+		Precomputed: make(map[string]PrecomputedBlob),
 	}
 
 	for _, path := range paths {
@@ -46,16 +52,23 @@ func NewManifest(paths []string) (*Manifest, error) {
 		}
 
 		var newPaths map[string]string
+		var precomputed map[string]PrecomputedBlob
 		if info.IsDir() {
 			newPaths, err = walk(path)
 		} else {
-			newPaths, err = parseManifest(path)
+			newPaths, precomputed, err = parseManifest(path)
 		}
 		if err != nil {
 			return nil, err
 		}
 		for k, v := range newPaths {
 			m.Paths[k] = v
+			// A later source replaces any precomputed value for the path.
+			if p, ok := precomputed[k]; ok {
+				m.Precomputed[k] = p
+			} else {
+				delete(m.Precomputed, k)
+			}
 		}
 	}
 
@@ -67,7 +80,7 @@ func NewManifest(paths []string) (*Manifest, error) {
 func (m *Manifest) Meta() map[string]string {
 	meta := map[string]string{}
 	for d, s := range m.Paths {
-		// TODO(raggi): portable separator concerns
+		// Destinations always use forward slashes, see normalizePackagePath.
 		if strings.HasPrefix(d, "meta/") {
 			meta[d] = s
 		}
@@ -97,7 +110,7 @@ func (m *Manifest) Package() (*pkg.Package, error) {
 func (m *Manifest) Content() map[string]string {
 	content := map[string]string{}
 	for d, s := range m.Paths {
-		// TODO(raggi): portable separator concerns
+		// Destinations always use forward slashes, see normalizePackagePath.
 		if !strings.HasPrefix(d, "meta/") {
 			content[d] = s
 		}
@@ -116,6 +129,7 @@ func walk(root string) (map[string]string, error) {
 		if err != nil {
 			return err
 		}
+		dest = filepath.ToSlash(dest)
 		if ignores.Match(dest) {
 			return filepath.SkipDir
 		}
@@ -132,39 +146,47 @@ func walk(root string) (map[string]string, error) {
 	return r, err
 }
 
-func parseManifest(path string) (map[string]string, error) {
+func parseManifest(path string) (map[string]string, map[string]PrecomputedBlob, error) {
 	f, err := os.Open(path)
 	if err != nil {
-		return nil, fmt.Errorf("build.parseManifest: %s", err)
+		return nil, nil, fmt.Errorf("build.parseManifest: %s", err)
 	}
 	defer f.Close()
 	r := map[string]string{}
+	precomputed := map[string]PrecomputedBlob{}
 	b := bufio.NewReader(f)
 	for {
 		line, err := b.ReadString('\n')
 		if err == io.EOF {
 			if len(strings.TrimSpace(line)) == 0 {
-				return r, nil
+				return r, precomputed, nil
 			}
 			err = nil
 		}
 		if err != nil {
-			return r, err
+			return r, precomputed, err
 		}
 
 		parts := strings.SplitN(line, "=", 2)
 		if len(parts) < 2 {
 			continue
 		}
-		src := strings.TrimSpace(parts[1])
-		dest := strings.TrimSpace(parts[0])
+		src, p, err := splitPrecomputed(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return r, precomputed, fmt.Errorf("build.parseManifest: %s: %s", path, err)
+		}
+		src = normalizeSourcePath(src)
+		dest := normalizePackagePath(strings.TrimSpace(parts[0]))
+		if p != nil {
+			precomputed[dest] = *p
+		}
 
 		// TODO(anmittal): make file comparision efficient.
 		if duplicateSrc, ok := r[dest]; ok {
 			if equal, err := filesEqual(src, duplicateSrc); err != nil {
-				return r, err
+				return r, precomputed, err
 			} else if !equal {
-				return r, fmt.Errorf("build.parseManifest: Multiple entries for key, pointing to different files: %q, [%s, %s]", dest, src, duplicateSrc)
+				return r, precomputed, fmt.Errorf("build.parseManifest: Multiple entries for key, pointing to different files: %q, [%s, %s]", dest, src, duplicateSrc)
 			}
 			continue
 		}
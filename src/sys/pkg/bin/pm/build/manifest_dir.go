@@ -0,0 +1,133 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package build
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/ignores"
+)
+
+// DirOptions control how ManifestFromDir maps a directory tree to package
+// paths.
+type DirOptions struct {
+	// Prefix is prepended to the package path of every file, e.g. "data/".
+	Prefix string
+
+	// Include, if non-empty, limits the manifest to files whose path relative
+	// to the root matches at least one of these globs.
+	Include []string
+
+	// Exclude removes files, and prunes directories, whose path relative to
+	// the root matches any of these globs.
+	Exclude []string
+}
+
+// ManifestFromDir creates a manifest from the files under root. Globs are
+// matched against slash-separated paths relative to root using path.Match
+// syntax, extended so that a "**" element matches any number of path
+// elements. Files ignored by NewManifest for directory sources are ignored
+// here too.
+func ManifestFromDir(root string, opts DirOptions) (*Manifest, error) {
+	for _, pattern := range append(append([]string{}, opts.Include...), opts.Exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("build.ManifestFromDir: invalid glob %q: %w", pattern, err)
+		}
+	}
+
+	m := &Manifest{
+		Srcs:  []string{root},
+		Paths: make(map[string]string),
+	}
+	err := filepath.Walk(root, func(source string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, source)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+		if ignores.Match(rel) || matchAnyGlob(opts.Exclude, rel) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.IsDir() {
+			return nil
+		}
+		if len(opts.Include) > 0 && !matchAnyGlob(opts.Include, rel) {
+			return nil
+		}
+		m.Paths[normalizePackagePath(opts.Prefix+rel)] = source
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("build.ManifestFromDir: %w", err)
+	}
+	return m, nil
+}
+
+// WriteTo writes the manifest to w as "destination=source" lines sorted by
+// destination, in the format read by NewManifest.
+func (m *Manifest) WriteTo(w io.Writer) (int64, error) {
+	dests := make([]string, 0, len(m.Paths))
+	for dest := range m.Paths {
+		dests = append(dests, dest)
+	}
+	sort.Strings(dests)
+
+	var total int64
+	for _, dest := range dests {
+		n, err := fmt.Fprintf(w, "%s=%s\n", dest, m.Paths[dest])
+		total += int64(n)
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+func matchAnyGlob(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if matchGlob(strings.Split(pattern, "/"), strings.Split(name, "/")) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchGlob matches path elements against pattern elements, where a "**"
+// pattern element matches zero or more path elements.
+func matchGlob(pattern, elems []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(elems); i++ {
+				if matchGlob(pattern[1:], elems[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(elems) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], elems[0]); !ok {
+			return false
+		}
+		pattern, elems = pattern[1:], elems[1:]
+	}
+	return len(elems) == 0
+}
@@ -0,0 +1,101 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package build
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestManifestFromDir(t *testing.T) {
+	root := createBuildDir(t, map[string]string{
+		"bin/app":             "app",
+		"lib/libfoo.so":       "foo",
+		"lib/debug/libfoo.so": "foo debug",
+		"data/a.json":         "{}",
+		"data/sub/b.json":     "{}",
+		"data/sub/c.txt":      "c",
+		"data/.file.swp":      "swap",
+	})
+
+	for _, tc := range []struct {
+		name string
+		opts DirOptions
+		want []string
+	}{
+		{
+			name: "everything",
+			opts: DirOptions{},
+			want: []string{"bin/app", "data/a.json", "data/sub/b.json", "data/sub/c.txt", "lib/debug/libfoo.so", "lib/libfoo.so"},
+		},
+		{
+			name: "include",
+			opts: DirOptions{Include: []string{"data/**/*.json"}},
+			want: []string{"data/a.json", "data/sub/b.json"},
+		},
+		{
+			name: "exclude prunes directories",
+			opts: DirOptions{Exclude: []string{"**/debug"}},
+			want: []string{"bin/app", "data/a.json", "data/sub/b.json", "data/sub/c.txt", "lib/libfoo.so"},
+		},
+		{
+			name: "prefix",
+			opts: DirOptions{Prefix: "pkg/", Include: []string{"bin/*"}},
+			want: []string{"pkg/bin/app"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			m, err := ManifestFromDir(root, tc.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := make(map[string]string)
+			for _, dest := range tc.want {
+				want[dest] = filepath.Join(root, filepath.FromSlash(dest[len(tc.opts.Prefix):]))
+			}
+			if d := cmp.Diff(want, m.Paths); d != "" {
+				t.Errorf("ManifestFromDir paths (-want +got):\n%s", d)
+			}
+		})
+	}
+
+	if _, err := ManifestFromDir(root, DirOptions{Include: []string{"["}}); err == nil {
+		t.Error("expected an error for an invalid glob")
+	}
+}
+
+func TestManifestWriteTo(t *testing.T) {
+	m := &Manifest{
+		Paths: map[string]string{
+			"b":            "/src/b",
+			"a":            "/src/a",
+			"meta/package": "/src/package",
+		},
+	}
+	var buf bytes.Buffer
+	if _, err := m.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	want := "a=/src/a\nb=/src/b\nmeta/package=/src/package\n"
+	if got := buf.String(); got != want {
+		t.Errorf("WriteTo wrote %q, want %q", got, want)
+	}
+
+	path := filepath.Join(t.TempDir(), "manifest")
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := NewManifest([]string{path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := cmp.Diff(m.Paths, parsed.Paths); d != "" {
+		t.Errorf("round-tripped paths (-want +got):\n%s", d)
+	}
+}
@@ -0,0 +1,140 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package build
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// ErrOutsideRoot is returned when a blob source path that is to be rebased is
+// not under the root it is being rebased from.
+type ErrOutsideRoot struct {
+	SourcePath string
+	Root       string
+}
+
+func (e ErrOutsideRoot) Error() string {
+	return fmt.Sprintf("pkg: blob source %s is not under %s", e.SourcePath, e.Root)
+}
+
+// WithAbsoluteSourcePaths returns a copy of the manifest with every blob
+// source path made absolute, resolving relative paths against the working
+// directory.
+func (m *PackageManifest) WithAbsoluteSourcePaths() (*PackageManifest, error) {
+	return m.mapSourcePaths(filepath.Abs)
+}
+
+// Rebase returns a copy of the manifest with every blob source path under
+// oldRoot moved to the same location under newRoot, for manifests whose blobs
+// have been moved to another build output directory or cache. Relative paths
+// and roots are resolved against the working directory.
+func (m *PackageManifest) Rebase(oldRoot, newRoot string) (*PackageManifest, error) {
+	oldRoot, err := filepath.Abs(oldRoot)
+	if err != nil {
+		return nil, err
+	}
+	newRoot, err = filepath.Abs(newRoot)
+	if err != nil {
+		return nil, err
+	}
+	return m.mapSourcePaths(func(p string) (string, error) {
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			return "", err
+		}
+		rel, err := filepath.Rel(oldRoot, abs)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return "", ErrOutsideRoot{SourcePath: p, Root: oldRoot}
+		}
+		return filepath.Join(newRoot, rel), nil
+	})
+}
+
+// mapSourcePaths returns a copy of the manifest with f applied to every
+// non-empty blob and delivery blob source path, and subpackage manifest path.
+func (m *PackageManifest) mapSourcePaths(f func(string) (string, error)) (*PackageManifest, error) {
+	apply := func(p string) (string, error) {
+		if p == "" {
+			return p, nil
+		}
+		return f(p)
+	}
+
+	out := *m
+	out.Blobs = make([]PackageBlobInfo, len(m.Blobs))
+	for i, blob := range m.Blobs {
+		var err error
+		if blob.SourcePath, err = apply(blob.SourcePath); err != nil {
+			return nil, err
+		}
+		if blob.DeliveryBlobs != nil {
+			deliveryBlobs := make([]DeliveryBlobInfo, len(blob.DeliveryBlobs))
+			for j, d := range blob.DeliveryBlobs {
+				if d.SourcePath, err = apply(d.SourcePath); err != nil {
+					return nil, err
+				}
+				deliveryBlobs[j] = d
+			}
+			blob.DeliveryBlobs = deliveryBlobs
+		}
+		out.Blobs[i] = blob
+	}
+	if m.Subpackages != nil {
+		out.Subpackages = make([]SubpackageInfo, len(m.Subpackages))
+		for i, sub := range m.Subpackages {
+			var err error
+			if sub.ManifestPath, err = apply(sub.ManifestPath); err != nil {
+				return nil, err
+			}
+			out.Subpackages[i] = sub
+		}
+	}
+	return &out, nil
+}
+
+// WritePackageManifest writes the manifest to path. If relative is set, blob
+// source paths are written relative to the directory containing path, and the
+// manifest is marked so that LoadPackageManifest resolves them against it.
+func WritePackageManifest(m *PackageManifest, path string, relative bool) error {
+	var v interface{} = m
+	if relative {
+		dir, err := filepath.Abs(filepath.Dir(path))
+		if err != nil {
+			return err
+		}
+		rel, err := m.mapSourcePaths(func(p string) (string, error) {
+			abs, err := filepath.Abs(p)
+			if err != nil {
+				return "", err
+			}
+			r, err := filepath.Rel(dir, abs)
+			if err != nil {
+				return "", err
+			}
+			return filepath.ToSlash(r), nil
+		})
+		if err != nil {
+			return err
+		}
+		v = packageManifestMaybeRelative{
+			Version:     rel.Version,
+			Repository:  rel.Repository,
+			Package:     rel.Package,
+			Blobs:       rel.Blobs,
+			Subpackages: rel.Subpackages,
+			Metadata:    rel.Metadata,
+			RelativeTo:  "file",
+		}
+	}
+	content, err := json.MarshalIndent(v, "", "    ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, content, 0644)
+}
@@ -0,0 +1,97 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package build
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func testRewriteManifest(root string) *PackageManifest {
+	return &PackageManifest{
+		Version:  "1",
+		Metadata: map[string]string{"gn_label": "//src/foo:pkg", "git_revision": "abc123"},
+		Blobs: []PackageBlobInfo{
+			{SourcePath: filepath.Join(root, "meta.far"), Path: "meta/", Merkle: MerkleRoot{1}, Size: 1},
+			{
+				SourcePath: filepath.Join(root, "blobs", "a"),
+				Path:       "a",
+				Merkle:     MerkleRoot{2},
+				Size:       2,
+				DeliveryBlobs: []DeliveryBlobInfo{
+					{Type: DeliveryBlobType1, Hash: MerkleRoot{3}, Size: 1, SourcePath: filepath.Join(root, "delivery", "a")},
+				},
+			},
+		},
+	}
+}
+
+func TestPackageManifestRebase(t *testing.T) {
+	oldRoot := filepath.Join(t.TempDir(), "old")
+	newRoot := filepath.Join(t.TempDir(), "new")
+	m := testRewriteManifest(oldRoot)
+
+	got, err := m.Rebase(oldRoot, newRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := cmp.Diff(testRewriteManifest(newRoot), got); d != "" {
+		t.Errorf("Rebase (-want +got):\n%s", d)
+	}
+	// The original is left untouched.
+	if d := cmp.Diff(testRewriteManifest(oldRoot), m); d != "" {
+		t.Errorf("Rebase modified its receiver (-want +got):\n%s", d)
+	}
+
+	var outside ErrOutsideRoot
+	if _, err := m.Rebase(filepath.Join(oldRoot, "blobs"), newRoot); !errors.As(err, &outside) {
+		t.Errorf("got error %v, want ErrOutsideRoot", err)
+	}
+}
+
+func TestWritePackageManifestRelative(t *testing.T) {
+	dir := t.TempDir()
+	m := testRewriteManifest(filepath.Join(dir, "out"))
+	path := filepath.Join(dir, "package_manifest.json")
+
+	if err := WritePackageManifest(m, path, true); err != nil {
+		t.Fatal(err)
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(content), dir) {
+		t.Errorf("relative manifest contains absolute paths:\n%s", content)
+	}
+
+	loaded, err := LoadPackageManifest(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := cmp.Diff(m, loaded); d != "" {
+		t.Errorf("loaded manifest (-want +got):\n%s", d)
+	}
+}
+
+func TestPackageManifestWithAbsoluteSourcePaths(t *testing.T) {
+	m := testRewriteManifest("out")
+	got, err := m.WithAbsoluteSourcePaths()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := filepath.Abs("out")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := cmp.Diff(testRewriteManifest(want), got); d != "" {
+		t.Errorf("WithAbsoluteSourcePaths (-want +got):\n%s", d)
+	}
+}
@@ -0,0 +1,62 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package build
+
+import (
+	"io"
+
+	"go.fuchsia.dev/fuchsia/src/sys/pkg/lib/merkle"
+)
+
+// MerkleTee writes to an underlying writer while computing the merkle root of
+// the written bytes, so that a generated blob need not be read back to be
+// hashed.
+type MerkleTee struct {
+	w    io.Writer
+	pw   *io.PipeWriter
+	done chan struct{}
+
+	tree merkle.Tree
+	n    int64
+	err  error
+}
+
+// NewMerkleTee returns a MerkleTee writing to w. Close must be called to
+// obtain the merkle root and release the hashing goroutine.
+func NewMerkleTee(w io.Writer) *MerkleTee {
+	pr, pw := io.Pipe()
+	t := &MerkleTee{w: w, pw: pw, done: make(chan struct{})}
+	go func() {
+		defer close(t.done)
+		t.n, t.err = t.tree.ReadFrom(pr)
+		// Unblock any writer if hashing failed.
+		pr.CloseWithError(t.err)
+	}()
+	return t
+}
+
+// Write writes b to the underlying writer, and hashes whatever was written.
+func (t *MerkleTee) Write(b []byte) (int, error) {
+	n, err := t.w.Write(b)
+	if n > 0 {
+		if _, hashErr := t.pw.Write(b[:n]); hashErr != nil && err == nil {
+			err = hashErr
+		}
+	}
+	return n, err
+}
+
+// Close finishes hashing and returns the merkle root and size of everything
+// written. It does not close the underlying writer.
+func (t *MerkleTee) Close() (MerkleRoot, int64, error) {
+	t.pw.Close()
+	<-t.done
+	if t.err != nil {
+		return MerkleRoot{}, 0, t.err
+	}
+	var root MerkleRoot
+	copy(root[:], t.tree.Root())
+	return root, t.n, nil
+}
@@ -0,0 +1,54 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package build
+
+import (
+	"bytes"
+	"testing"
+
+	"go.fuchsia.dev/fuchsia/src/sys/pkg/lib/merkle"
+)
+
+func TestMerkleTee(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 5000)
+	var tree merkle.Tree
+	if _, err := tree.ReadFrom(bytes.NewReader(content)); err != nil {
+		t.Fatal(err)
+	}
+	var want MerkleRoot
+	copy(want[:], tree.Root())
+
+	var out bytes.Buffer
+	tee := NewMerkleTee(&out)
+	for i := 0; i < len(content); i += 3000 {
+		end := i + 3000
+		if end > len(content) {
+			end = len(content)
+		}
+		if _, err := tee.Write(content[i:end]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	root, n, err := tee.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root != want || n != int64(len(content)) {
+		t.Errorf("got %s and %d bytes, want %s and %d bytes", root, n, want, len(content))
+	}
+	if !bytes.Equal(out.Bytes(), content) {
+		t.Error("tee did not write the content through")
+	}
+
+	// The root of nothing written is the root of the empty blob.
+	var empty merkle.Tree
+	if _, err := empty.ReadFrom(bytes.NewReader(nil)); err != nil {
+		t.Fatal(err)
+	}
+	root, n, err = NewMerkleTee(&out).Close()
+	if err != nil || n != 0 || !bytes.Equal(root[:], empty.Root()) {
+		t.Errorf("got %s, %d bytes, %v for an empty tee", root, n, err)
+	}
+}
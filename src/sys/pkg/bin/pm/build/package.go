@@ -9,13 +9,13 @@ import (
 	"encoding/binary"
 	"encoding/json"
 	"fmt"
-	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"regexp"
 	"runtime"
 	"sync"
+	"time"
 
 	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/pkg"
 	"go.fuchsia.dev/fuchsia/src/sys/pkg/lib/far/go"
@@ -35,6 +35,11 @@ type PackageManifest struct {
 	Repository string            `json:"repository,omitempty"`
 	Package    pkg.Package       `json:"package"`
 	Blobs      []PackageBlobInfo `json:"blobs"`
+	// Subpackages are the packages this package refers to by name.
+	Subpackages []SubpackageInfo `json:"subpackages,omitempty"`
+	// Metadata holds free-form annotations about the package, such as its
+	// build provenance. It is published in the package's TUF custom metadata.
+	Metadata map[string]string `json:"metadata,omitempty"`
 }
 
 // packageManifestMaybeRelative is the json structure representation of a package
@@ -42,11 +47,13 @@ type PackageManifest struct {
 // from PackageManifest so we don't need to touch every use of PackageManifest to
 // avoid writing invalid blob_sources_relative values to disk.
 type packageManifestMaybeRelative struct {
-	Version    string            `json:"version"`
-	Repository string            `json:"repository,omitempty"`
-	Package    pkg.Package       `json:"package"`
-	Blobs      []PackageBlobInfo `json:"blobs"`
-	RelativeTo string            `json:"blob_sources_relative"`
+	Version     string            `json:"version"`
+	Repository  string            `json:"repository,omitempty"`
+	Package     pkg.Package       `json:"package"`
+	Blobs       []PackageBlobInfo `json:"blobs"`
+	Subpackages []SubpackageInfo  `json:"subpackages,omitempty"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+	RelativeTo  string            `json:"blob_sources_relative"`
 }
 
 // LoadPackageManifest parses the package manifest for a particular package,
@@ -57,6 +64,21 @@ func LoadPackageManifest(packageManifestPath string) (*PackageManifest, error) {
 		return nil, fmt.Errorf("failed to read %s: %w", packageManifestPath, err)
 	}
 
+	// Check the manifest against the schema for its version first, so that
+	// malformed manifests are reported precisely rather than by the first
+	// unmarshaling error.
+	var header struct {
+		Version interface{} `json:"version"`
+	}
+	if err := json.Unmarshal(fileContents, &header); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal %s: %w", packageManifestPath, err)
+	}
+	if version, ok := header.Version.(string); ok {
+		if err := validatePackageManifestSchema(packageManifestPath, version, fileContents); err != nil {
+			return nil, err
+		}
+	}
+
 	rawManifest := &packageManifestMaybeRelative{}
 	if err := json.Unmarshal(fileContents, rawManifest); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal %s: %w", packageManifestPath, err)
@@ -66,21 +88,53 @@ func LoadPackageManifest(packageManifestPath string) (*PackageManifest, error) {
 	manifest.Version = rawManifest.Version
 	manifest.Repository = rawManifest.Repository
 	manifest.Package = rawManifest.Package
+	manifest.Metadata = rawManifest.Metadata
 
 	if manifest.Version != "1" {
 		return nil, fmt.Errorf("unknown version %q, can't load manifest", manifest.Version)
 	}
 
 	// if the manifest has file-relative blob paths, make them relative to the working directory
-	if rawManifest.RelativeTo == "file" {
-		basePath := filepath.Dir(packageManifestPath)
-		for i := 0; i < len(rawManifest.Blobs); i++ {
-			blob := rawManifest.Blobs[i]
-			blob.SourcePath = filepath.Join(basePath, blob.SourcePath)
-			manifest.Blobs = append(manifest.Blobs, blob)
+	var errs FileErrors
+	for _, blob := range rawManifest.Blobs {
+		blob.Path = normalizePackagePath(blob.Path)
+		// The meta.far is listed under the special "meta/" path, and blobs
+		// that do not record a path have nothing to validate.
+		if blob.Path != "meta/" && blob.Path != "" {
+			if err := validatePackagePath(blob.Path); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		if err := validateDeliveryBlobs(blob); err != nil {
+			errs = append(errs, err)
+		}
+		if rawManifest.RelativeTo == "file" {
+			blob.SourcePath = resolveSourcePath(filepath.Dir(packageManifestPath), blob.SourcePath)
+		} else if blob.SourcePath != "" {
+			blob.SourcePath = normalizeSourcePath(blob.SourcePath)
 		}
-	} else {
-		manifest.Blobs = rawManifest.Blobs
+		for i, d := range blob.DeliveryBlobs {
+			if d.SourcePath == "" {
+				continue
+			}
+			if rawManifest.RelativeTo == "file" {
+				blob.DeliveryBlobs[i].SourcePath = resolveSourcePath(filepath.Dir(packageManifestPath), d.SourcePath)
+			} else {
+				blob.DeliveryBlobs[i].SourcePath = normalizeSourcePath(d.SourcePath)
+			}
+		}
+		manifest.Blobs = append(manifest.Blobs, blob)
+	}
+	for _, sub := range rawManifest.Subpackages {
+		if rawManifest.RelativeTo == "file" {
+			sub.ManifestPath = resolveSourcePath(filepath.Dir(packageManifestPath), sub.ManifestPath)
+		} else {
+			sub.ManifestPath = normalizeSourcePath(sub.ManifestPath)
+		}
+		manifest.Subpackages = append(manifest.Subpackages, sub)
+	}
+	if err := errs.ErrorOrNil(); err != nil {
+		return nil, fmt.Errorf("invalid package manifest %s: %w", packageManifestPath, err)
 	}
 
 	return manifest, nil
@@ -129,8 +183,30 @@ func Update(cfg *Config) error {
 		return err
 	}
 
+	if err := injectConfigValues(cfg, manifest); err != nil {
+		return err
+	}
+
 	contentsPath := filepath.Join(metadir, "contents")
 	pkgContents := manifest.Content()
+	start := time.Now()
+
+	if err := cfg.Limits.check(pkgContents); err != nil {
+		return err
+	}
+
+	// Files with a precomputed merkle root are not hashed, except for a
+	// sample of spot checks, unless the config trusts them completely.
+	precomputed := make(map[string]PrecomputedBlob)
+	for dest := range pkgContents {
+		if p, ok := manifest.Precomputed[dest]; ok {
+			precomputed[dest] = p
+		}
+	}
+	spotChecks := map[string]bool{}
+	if !cfg.TrustPrecomputedMerkles {
+		spotChecks = precomputedSpotChecks(precomputed)
+	}
 
 	// manifestLines is a channel containing unpacked manifest paths
 	var manifestLines = make(chan struct{ src, dest string }, len(pkgContents))
@@ -145,9 +221,19 @@ func Update(cfg *Config) error {
 	type contentEntry struct {
 		path string
 		root MerkleRoot
+		size uint64
 	}
 	var contentCollector = make(chan contentEntry, len(pkgContents))
-	var errors = make(chan error)
+
+	// errs collects the failures for every file, rather than stopping at the
+	// first one, so that they can all be reported together.
+	var errsMu sync.Mutex
+	var errs FileErrors
+	addErr := func(err error) {
+		errsMu.Lock()
+		errs = append(errs, err)
+		errsMu.Unlock()
+	}
 
 	// w is a group that is done when contentCollector is fully populated
 	var w sync.WaitGroup
@@ -158,22 +244,38 @@ func Update(cfg *Config) error {
 			defer w.Done()
 
 			for in := range manifestLines {
+				if p, ok := precomputed[in.dest]; ok && !spotChecks[in.dest] {
+					if !cfg.TrustPrecomputedMerkles {
+						if err := checkPrecomputedSize(in.dest, in.src, p); err != nil {
+							addErr(err)
+							continue
+						}
+					}
+					contentCollector <- contentEntry{in.dest, p.Merkle, p.Size}
+					continue
+				}
+
 				var t merkle.Tree
 				cf, err := os.Open(in.src)
 				if err != nil {
-					errors <- fmt.Errorf("build.Update: open %s for %s: %s", in.src, in.dest, err)
-					return
+					addErr(fmt.Errorf("build.Update: open %s for %s: %w", in.src, in.dest, err))
+					continue
 				}
-				_, err = t.ReadFrom(bufio.NewReader(cf))
+				n, err := t.ReadFrom(bufio.NewReader(cf))
 				cf.Close()
 				if err != nil {
-					errors <- err
-					return
+					addErr(fmt.Errorf("build.Update: read %s for %s: %w", in.src, in.dest, err))
+					continue
 				}
 
 				var root MerkleRoot
 				copy(root[:], t.Root())
-				contentCollector <- contentEntry{in.dest, root}
+				got := PrecomputedBlob{Merkle: root, Size: uint64(n)}
+				if p, ok := precomputed[in.dest]; ok && p != got {
+					addErr(ErrPrecomputedMismatch{Path: in.dest, Source: in.src, Want: p, Got: got})
+					continue
+				}
+				contentCollector <- contentEntry{in.dest, root, uint64(n)}
 			}
 		}()
 	}
@@ -184,21 +286,28 @@ func Update(cfg *Config) error {
 		close(contentCollector)
 	}()
 
-	// collect all results and close done to signal the waiting select
+	// collect all results and close done to signal completion
 	var done = make(chan struct{})
 	contents := MetaContents{}
 	go func() {
+		var bytes uint64
 		for entry := range contentCollector {
 			contents[entry.path] = entry.root
+			bytes += entry.size
+			cfg.reportProgress(ProgressEvent{
+				Stage:      ProgressUpdate,
+				Path:       entry.path,
+				Files:      len(contents),
+				TotalFiles: len(pkgContents),
+				Bytes:      bytes,
+				Elapsed:    time.Since(start),
+			})
 		}
 		close(done)
 	}()
 
-	select {
-	case <-done:
-		// contents is populated
-	case err := <-errors:
-		// exit on the first error
+	<-done
+	if err := errs.ErrorOrNil(); err != nil {
 		return err
 	}
 
@@ -244,7 +353,10 @@ func (e ErrRequiredFileMissing) Error() string {
 // RequiredFiles is a list of files that are required before a package can be sealed.
 var RequiredFiles = []string{"meta/contents", "meta/package"}
 
-// Validate ensures that the package contains the required files.
+// Validate ensures that the package contains the required files, that every
+// destination is a valid package path whose source exists, and that its ABI
+// revision, if any, is allowed by the config. All problems found are reported
+// together, see FileErrors.
 func Validate(cfg *Config) error {
 	if InvalidRepositoryCharsPattern(cfg.PkgRepository) {
 		return fmt.Errorf("pkg: invalid package repository \"%v\"", cfg.PkgRepository)
@@ -255,13 +367,33 @@ func Validate(cfg *Config) error {
 	}
 	meta := manifest.Meta()
 
+	var errs FileErrors
 	for _, f := range RequiredFiles {
 		if _, ok := meta[f]; !ok {
-			return ErrRequiredFileMissing{f}
+			errs = append(errs, ErrRequiredFileMissing{f})
 		}
 	}
 
-	return nil
+	for dest, src := range manifest.Paths {
+		if err := validatePackagePath(dest); err != nil {
+			errs = append(errs, err)
+		}
+		if src == "" {
+			errs = append(errs, fmt.Errorf("pkg: empty source path for %q", dest))
+			continue
+		}
+		if _, err := os.Stat(src); err != nil {
+			errs = append(errs, fmt.Errorf("pkg: source for %q: %w", dest, err))
+		}
+	}
+
+	if src, ok := meta[abiRevisionKey]; ok {
+		if err := cfg.checkABIRevision(src); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errs.ErrorOrNil()
 }
 
 // Seal archives meta/ into a FAR archive named meta.far.
@@ -275,24 +407,36 @@ func Seal(cfg *Config) (string, error) {
 		return "", err
 	}
 
+	start := time.Now()
+	meta := manifest.Meta()
+
 	archive, err := os.Create(cfg.MetaFAR())
 	if err != nil {
 		return "", err
 	}
 
-	if err := far.Write(archive, manifest.Meta()); err != nil {
-		return "", err
-	}
-
-	if _, err := archive.Seek(0, io.SeekStart); err != nil {
-		return "", err
+	// The archive is hashed as it is written, instead of being read back.
+	tee := NewMerkleTee(archive)
+	writeErr := far.Write(tee, meta)
+	root, n, err := tee.Close()
+	if writeErr != nil {
+		archive.Close()
+		return "", writeErr
 	}
-
-	var tree merkle.Tree
-	if _, err := tree.ReadFrom(archive); err != nil {
+	if err != nil {
+		archive.Close()
 		return "", err
 	}
-	if err := ioutil.WriteFile(cfg.MetaFARMerkle(), []byte(fmt.Sprintf("%x", tree.Root())), os.ModePerm); err != nil {
+	cfg.reportProgress(ProgressEvent{
+		Stage:      ProgressSeal,
+		Path:       "meta/",
+		Files:      len(meta),
+		TotalFiles: len(meta),
+		Bytes:      uint64(n),
+		Elapsed:    time.Since(start),
+	})
+	if err := ioutil.WriteFile(cfg.MetaFARMerkle(), []byte(root.String()), os.ModePerm); err != nil {
+		archive.Close()
 		return "", err
 	}
 	return cfg.MetaFAR(), archive.Close()
@@ -0,0 +1,153 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package build
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+
+	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/pkg"
+	"go.fuchsia.dev/fuchsia/src/sys/pkg/lib/far/go"
+	"go.fuchsia.dev/fuchsia/src/sys/pkg/lib/merkle"
+)
+
+// PackageArchiveMetaFAR is the name of the meta.far within a package archive.
+// Content blobs are named by their merkle root.
+const PackageArchiveMetaFAR = "meta.far"
+
+// WritePackageArchive writes a package archive to w containing the meta.far
+// and every content blob of the given package manifest. Blobs are streamed
+// from their source paths rather than loaded into memory.
+func WritePackageArchive(w io.Writer, m *PackageManifest) error {
+	files := make(map[string]string, len(m.Blobs))
+	for _, blob := range m.Blobs {
+		if blob.Path == "meta/" {
+			files[PackageArchiveMetaFAR] = blob.SourcePath
+		} else {
+			files[blob.Merkle.String()] = blob.SourcePath
+		}
+	}
+	if _, ok := files[PackageArchiveMetaFAR]; !ok {
+		return fmt.Errorf("package manifest for %q has no meta.far", m.Package.Name)
+	}
+	return far.Write(w, files)
+}
+
+// PackageArchive is a package archive opened for reading.
+type PackageArchive struct {
+	archive    *far.Reader
+	metaMerkle MerkleRoot
+	pkg        pkg.Package
+	contents   MetaContents
+}
+
+// NewPackageArchive reads a package archive, checking that it contains the
+// meta.far and every content blob the meta.far refers to.
+func NewPackageArchive(r io.ReaderAt) (*PackageArchive, error) {
+	archive, err := far.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	if !archive.IsFile(PackageArchiveMetaFAR) {
+		return nil, fmt.Errorf("package archive has no %s", PackageArchiveMetaFAR)
+	}
+	metaReader, err := archive.Open(PackageArchiveMetaFAR)
+	if err != nil {
+		return nil, err
+	}
+	metaSize := int64(archive.GetSize(PackageArchiveMetaFAR))
+
+	var tree merkle.Tree
+	if _, err := tree.ReadFrom(io.NewSectionReader(metaReader, 0, metaSize)); err != nil {
+		return nil, err
+	}
+	var metaMerkle MerkleRoot
+	copy(metaMerkle[:], tree.Root())
+
+	meta, err := far.NewReader(metaReader)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", PackageArchiveMetaFAR, err)
+	}
+	pkgJSON, err := meta.ReadFile("meta/package")
+	if err != nil {
+		return nil, err
+	}
+	var p pkg.Package
+	if err := json.Unmarshal(pkgJSON, &p); err != nil {
+		return nil, err
+	}
+	contentsBytes, err := meta.ReadFile("meta/contents")
+	if err != nil {
+		return nil, err
+	}
+	contents, err := ParseMetaContents(bytes.NewReader(contentsBytes))
+	if err != nil {
+		return nil, err
+	}
+
+	for path, root := range contents {
+		if !archive.IsFile(root.String()) {
+			return nil, fmt.Errorf("package archive is missing blob %s for %q", root, path)
+		}
+	}
+
+	return &PackageArchive{
+		archive:    archive,
+		metaMerkle: metaMerkle,
+		pkg:        p,
+		contents:   contents,
+	}, nil
+}
+
+// Package returns the meta/package of the archived package.
+func (a *PackageArchive) Package() pkg.Package {
+	return a.pkg
+}
+
+// MetaMerkle returns the merkle root of the archived meta.far.
+func (a *PackageArchive) MetaMerkle() MerkleRoot {
+	return a.metaMerkle
+}
+
+// Contents returns the meta/contents of the archived package.
+func (a *PackageArchive) Contents() MetaContents {
+	return a.contents
+}
+
+// Blobs returns the merkle roots of all blobs in the archive, including the
+// meta.far, in sorted order.
+func (a *PackageArchive) Blobs() []MerkleRoot {
+	seen := map[MerkleRoot]struct{}{a.metaMerkle: {}}
+	for _, root := range a.contents {
+		seen[root] = struct{}{}
+	}
+	roots := make([]MerkleRoot, 0, len(seen))
+	for root := range seen {
+		roots = append(roots, root)
+	}
+	sort.Slice(roots, func(i, j int) bool {
+		return roots[i].LessThan(roots[j])
+	})
+	return roots
+}
+
+// OpenBlob returns a reader for the blob with the given merkle root.
+func (a *PackageArchive) OpenBlob(root MerkleRoot) (*io.SectionReader, error) {
+	name := root.String()
+	if root == a.metaMerkle {
+		name = PackageArchiveMetaFAR
+	}
+	if !a.archive.IsFile(name) {
+		return nil, fmt.Errorf("package archive has no blob %s", root)
+	}
+	r, err := a.archive.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return io.NewSectionReader(r, 0, int64(a.archive.GetSize(name))), nil
+}
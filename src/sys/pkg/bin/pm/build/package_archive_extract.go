@@ -0,0 +1,107 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package build
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// ExtractedPackageManifest is the name of the package manifest written by
+// ExtractPackageArchive.
+const ExtractedPackageManifest = "package_manifest.json"
+
+// ExtractPackageArchive unpacks the given package archive into outputDir,
+// writing the meta.far to outputDir/meta.far and the content blobs to
+// outputDir/blobs/<merkle>. A package manifest describing the extracted
+// package is written to outputDir/package_manifest.json with file-relative
+// source paths, so the extracted directory can be moved as a whole. The
+// returned manifest has source paths resolved against outputDir.
+func ExtractPackageArchive(a *PackageArchive, outputDir string) (*PackageManifest, error) {
+	blobsDir := filepath.Join(outputDir, "blobs")
+	if err := os.MkdirAll(blobsDir, os.ModePerm); err != nil {
+		return nil, err
+	}
+
+	metaPath := filepath.Join(outputDir, PackageArchiveMetaFAR)
+	metaSize, err := extractBlob(a, a.MetaMerkle(), metaPath)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := &PackageManifest{
+		Version: "1",
+		Package: a.Package(),
+		Blobs: []PackageBlobInfo{{
+			SourcePath: metaPath,
+			Path:       "meta/",
+			Merkle:     a.MetaMerkle(),
+			Size:       metaSize,
+		}},
+	}
+
+	contents := a.Contents()
+	paths := make([]string, 0, len(contents))
+	for path := range contents {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	sizes := make(map[MerkleRoot]uint64)
+	for _, path := range paths {
+		root := contents[path]
+		blobPath := filepath.Join(blobsDir, root.String())
+		size, ok := sizes[root]
+		if !ok {
+			if size, err = extractBlob(a, root, blobPath); err != nil {
+				return nil, err
+			}
+			sizes[root] = size
+		}
+		manifest.Blobs = append(manifest.Blobs, PackageBlobInfo{
+			SourcePath: blobPath,
+			Path:       path,
+			Merkle:     root,
+			Size:       size,
+		})
+	}
+
+	if err := WritePackageManifest(manifest, filepath.Join(outputDir, ExtractedPackageManifest), true); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// extractBlob copies the blob with the given merkle root out of the archive to
+// path, returning its size. The blob is verified against its merkle root as it
+// is copied, and path is only written once it matches.
+func extractBlob(a *PackageArchive, root MerkleRoot, path string) (uint64, error) {
+	r, err := a.OpenBlob(root)
+	if err != nil {
+		return 0, err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path))
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(f.Name())
+	if err := VerifyBlobReader(path, io.TeeReader(r, f), root, r.Size()); err != nil {
+		f.Close()
+		return 0, err
+	}
+	if err := f.Close(); err != nil {
+		return 0, err
+	}
+	if err := os.Chmod(f.Name(), 0644); err != nil {
+		return 0, err
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		return 0, err
+	}
+	return uint64(r.Size()), nil
+}
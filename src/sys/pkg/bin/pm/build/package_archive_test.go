@@ -0,0 +1,186 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package build
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestPackageArchiveRoundTrip(t *testing.T) {
+	cfg := TestConfig()
+	defer os.RemoveAll(filepath.Dir(cfg.TempDir))
+	BuildTestPackage(cfg)
+
+	m, err := cfg.OutputManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := WritePackageArchive(&buf, m); err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := NewPackageArchive(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := a.Package(); got != m.Package {
+		t.Errorf("Package() = %v, want %v", got, m.Package)
+	}
+
+	for _, blob := range m.Blobs {
+		if blob.Path == "meta/" && a.MetaMerkle() != blob.Merkle {
+			t.Errorf("MetaMerkle() = %s, want %s", a.MetaMerkle(), blob.Merkle)
+		}
+		r, err := a.OpenBlob(blob.Merkle)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, err := ioutil.ReadFile(blob.SourcePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("blob %s for %q does not match its source", blob.Merkle, blob.Path)
+		}
+	}
+
+	if _, err := a.OpenBlob(MerkleRoot{}); err == nil {
+		t.Error("expected an error opening a blob missing from the archive")
+	}
+}
+
+func TestWritePackageArchiveRequiresMetaFAR(t *testing.T) {
+	m := &PackageManifest{
+		Blobs: []PackageBlobInfo{{SourcePath: "a", Path: "a"}},
+	}
+	if err := WritePackageArchive(&bytes.Buffer{}, m); err == nil {
+		t.Fatal("expected an error for a manifest without a meta.far")
+	}
+}
+
+func TestExtractPackageArchive(t *testing.T) {
+	cfg := TestConfig()
+	defer os.RemoveAll(filepath.Dir(cfg.TempDir))
+	BuildTestPackage(cfg)
+
+	m, err := cfg.OutputManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := WritePackageArchive(&buf, m); err != nil {
+		t.Fatal(err)
+	}
+	a, err := NewPackageArchive(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	outputDir := t.TempDir()
+	extracted, err := ExtractPackageArchive(a, outputDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The written manifest round-trips through LoadPackageManifest.
+	loaded, err := LoadPackageManifest(filepath.Join(outputDir, ExtractedPackageManifest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := cmp.Diff(extracted, loaded); d != "" {
+		t.Errorf("loaded manifest (-extracted +loaded):\n%s", d)
+	}
+
+	want := make(map[string]PackageBlobInfo)
+	for _, blob := range m.Blobs {
+		want[blob.Path] = blob
+	}
+	if len(extracted.Blobs) != len(want) {
+		t.Fatalf("got %d blobs, want %d", len(extracted.Blobs), len(want))
+	}
+	for _, blob := range extracted.Blobs {
+		w, ok := want[blob.Path]
+		if !ok {
+			t.Errorf("unexpected blob path %q", blob.Path)
+			continue
+		}
+		if blob.Merkle != w.Merkle || blob.Size != w.Size {
+			t.Errorf("blob %q = %s (%d bytes), want %s (%d bytes)", blob.Path, blob.Merkle, blob.Size, w.Merkle, w.Size)
+		}
+		got, err := ioutil.ReadFile(blob.SourcePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wantBytes, err := ioutil.ReadFile(w.SourcePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, wantBytes) {
+			t.Errorf("extracted blob for %q does not match its source", blob.Path)
+		}
+	}
+}
+
+func TestExtractPackageArchiveRejectsCorruptBlobs(t *testing.T) {
+	cfg := TestConfig()
+	defer os.RemoveAll(filepath.Dir(cfg.TempDir))
+	BuildTestPackage(cfg)
+
+	m, err := cfg.OutputManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Replace the content of one blob with different bytes of the same size,
+	// leaving its merkle root as it was.
+	var corrupt PackageBlobInfo
+	for i, blob := range m.Blobs {
+		if blob.Path == "meta/" {
+			continue
+		}
+		b, err := ioutil.ReadFile(blob.SourcePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for j := range b {
+			b[j] ^= 0xff
+		}
+		tampered := filepath.Join(t.TempDir(), "tampered")
+		if err := ioutil.WriteFile(tampered, b, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		m.Blobs[i].SourcePath = tampered
+		corrupt = m.Blobs[i]
+		break
+	}
+	var buf bytes.Buffer
+	if err := WritePackageArchive(&buf, m); err != nil {
+		t.Fatal(err)
+	}
+	a, err := NewPackageArchive(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	outputDir := t.TempDir()
+	if _, err := ExtractPackageArchive(a, outputDir); !errors.Is(err, ErrBlobCorrupt) {
+		t.Fatalf("ExtractPackageArchive() returned %v, want ErrBlobCorrupt", err)
+	}
+	if _, err := os.Stat(filepath.Join(outputDir, "blobs", corrupt.Merkle.String())); !os.IsNotExist(err) {
+		t.Errorf("corrupt blob %s for %q was extracted", corrupt.Merkle, corrupt.Path)
+	}
+}
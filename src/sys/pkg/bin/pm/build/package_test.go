@@ -317,6 +317,71 @@ func TestValidate(t *testing.T) {
 	}
 }
 
+func TestUpdateReportsAllMissingFiles(t *testing.T) {
+	cfg := TestConfig()
+	defer os.RemoveAll(filepath.Dir(cfg.TempDir))
+	TestPackage(cfg)
+
+	manifest, err := cfg.Manifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	missing := []string{"a", "dir/c"}
+	for _, f := range missing {
+		if err := os.Remove(manifest.Paths[f]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = Update(cfg)
+	var errs FileErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("got error %v, want FileErrors", err)
+	}
+	if len(errs) != len(missing) {
+		t.Fatalf("got %d errors, want %d: %v", len(errs), len(missing), err)
+	}
+	for i, f := range missing {
+		if !strings.Contains(errs[i].Error(), manifest.Paths[f]) {
+			t.Errorf("error %q does not mention %q", errs[i], manifest.Paths[f])
+		}
+		if !errors.Is(errs[i], os.ErrNotExist) {
+			t.Errorf("error %q is not os.ErrNotExist", errs[i])
+		}
+	}
+}
+
+func TestValidateReportsAllErrors(t *testing.T) {
+	cfg := TestConfig()
+	defer os.RemoveAll(filepath.Dir(cfg.TempDir))
+	TestPackage(cfg)
+
+	manifest, err := cfg.Manifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(manifest.Paths["b"]); err != nil {
+		t.Fatal(err)
+	}
+
+	// meta/contents is missing since Update was not run, and b's source is gone.
+	err = Validate(cfg)
+	var errs FileErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("got error %v, want FileErrors", err)
+	}
+	if len(errs) != 2 {
+		t.Fatalf("got %d errors, want 2: %v", len(errs), err)
+	}
+	var required ErrRequiredFileMissing
+	if !errors.As(errs[0], &required) || required.Path != "meta/contents" {
+		t.Errorf("got %v, want missing meta/contents", errs[0])
+	}
+	if !errors.Is(errs[1], os.ErrNotExist) {
+		t.Errorf("got %v, want missing source for b", errs[1])
+	}
+}
+
 func TestSeal(t *testing.T) {
 	cfg := TestConfig()
 	defer os.RemoveAll(filepath.Dir(cfg.TempDir))
@@ -0,0 +1,108 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package build
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// MaxPackagePathLength is the maximum length in bytes of a path within a
+	// package.
+	MaxPackagePathLength = 1024
+
+	// MaxPackagePathSegmentLength is the maximum length in bytes of a single
+	// segment of a path within a package.
+	MaxPackagePathSegmentLength = 255
+)
+
+// ErrInvalidPackagePath is returned when a destination path within a package
+// is not a valid package resource path.
+type ErrInvalidPackagePath struct {
+	Path   string
+	Reason string
+}
+
+func (e ErrInvalidPackagePath) Error() string {
+	return fmt.Sprintf("pkg: invalid package path %q: %s", e.Path, e.Reason)
+}
+
+// validatePackagePath checks that p, a path within a package, is a relative,
+// normalized, UTF-8 path that cannot escape the package.
+func validatePackagePath(p string) error {
+	invalid := func(reason string) error {
+		return ErrInvalidPackagePath{Path: p, Reason: reason}
+	}
+	switch {
+	case p == "":
+		return invalid("path is empty")
+	case len(p) > MaxPackagePathLength:
+		return invalid(fmt.Sprintf("path is longer than %d bytes", MaxPackagePathLength))
+	case !utf8.ValidString(p):
+		return invalid("path is not valid UTF-8")
+	case strings.ContainsRune(p, 0):
+		return invalid("path contains a NUL byte")
+	case strings.HasPrefix(p, "/") || isAbsSourcePath(p):
+		return invalid("path is absolute")
+	}
+	for _, segment := range strings.Split(p, "/") {
+		switch {
+		case segment == "":
+			return invalid("path has an empty segment")
+		case segment == "." || segment == "..":
+			return invalid(fmt.Sprintf("path contains a %q segment", segment))
+		case len(segment) > MaxPackagePathSegmentLength:
+			return invalid(fmt.Sprintf("segment is longer than %d bytes", MaxPackagePathSegmentLength))
+		}
+	}
+	return nil
+}
+
+// normalizePackagePath converts a path within a package, which may have been
+// written on a Windows host, to the canonical form using forward slashes.
+func normalizePackagePath(p string) string {
+	return strings.ReplaceAll(p, `\`, "/")
+}
+
+// normalizeSourcePath converts a source path, which may have been written on
+// a Windows host and may mix separators, to use the separator of the current
+// host.
+//
+// Backslashes are treated as separators on every host. They are valid in
+// file names on POSIX systems, but are not used in build outputs.
+func normalizeSourcePath(p string) string {
+	return filepath.FromSlash(strings.ReplaceAll(p, `\`, "/"))
+}
+
+// isAbsSourcePath reports whether p is absolute on the current host, or is a
+// Windows absolute path (with a drive letter, or a UNC path). Such paths must
+// never be joined onto a base directory, even when read on a POSIX host.
+func isAbsSourcePath(p string) bool {
+	if filepath.IsAbs(p) {
+		return true
+	}
+	slashed := strings.ReplaceAll(p, `\`, "/")
+	if strings.HasPrefix(slashed, "//") {
+		return true
+	}
+	return len(slashed) >= 3 && isDriveLetter(slashed[0]) && slashed[1] == ':' && slashed[2] == '/'
+}
+
+func isDriveLetter(c byte) bool {
+	return ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
+// resolveSourcePath returns the host path of a blob source read from a
+// package manifest, resolving it against baseDir when it is relative.
+func resolveSourcePath(baseDir, p string) string {
+	p = normalizeSourcePath(p)
+	if isAbsSourcePath(p) {
+		return p
+	}
+	return filepath.Join(baseDir, p)
+}
@@ -0,0 +1,200 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package build
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNormalizePackagePath(t *testing.T) {
+	for _, tc := range []struct{ in, want string }{
+		{"a/b/c", "a/b/c"},
+		{`a\b\c`, "a/b/c"},
+		{`meta\foo/bar`, "meta/foo/bar"},
+		{"meta/", "meta/"},
+	} {
+		if got := normalizePackagePath(tc.in); got != tc.want {
+			t.Errorf("normalizePackagePath(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestIsAbsSourcePath(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want bool
+	}{
+		{"/out/default/a", true},
+		{`C:\out\default\a`, true},
+		{"c:/out/default/a", true},
+		{`\\server\share\a`, true},
+		{"out/default/a", false},
+		{`obj\a`, false},
+		{"C:relative", false},
+	} {
+		if got := isAbsSourcePath(tc.in); got != tc.want {
+			t.Errorf("isAbsSourcePath(%q) = %v, want %v", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestResolveSourcePath(t *testing.T) {
+	base := filepath.FromSlash("/build/out")
+	for _, tc := range []struct{ in, want string }{
+		{"obj/a", filepath.FromSlash("/build/out/obj/a")},
+		{`obj\pkg/a`, filepath.FromSlash("/build/out/obj/pkg/a")},
+		{`..\gen\a`, filepath.FromSlash("/build/gen/a")},
+		{"/abs/a", filepath.FromSlash("/abs/a")},
+		{`D:\abs\a`, filepath.FromSlash("D:/abs/a")},
+	} {
+		if got := resolveSourcePath(base, tc.in); got != tc.want {
+			t.Errorf("resolveSourcePath(%q, %q) = %q, want %q", base, tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestLoadPackageManifestWindowsPaths(t *testing.T) {
+	dir := createBuildDir(t, map[string]string{
+		"pkg/package_manifest.json": `{
+			"version": "1",
+			"blob_sources_relative": "file",
+			"blobs": [
+				{
+					"source_path": "..\\obj\\meta.far",
+					"path": "meta/",
+					"merkle": "0000000000000000000000000000000000000000000000000000000000000000"
+				},
+				{
+					"source_path": "gen/data\\a",
+					"path": "data\\a",
+					"merkle": "1111111111111111111111111111111111111111111111111111111111111111"
+				},
+				{
+					"source_path": "C:\\out\\b",
+					"path": "data/b",
+					"merkle": "2222222222222222222222222222222222222222222222222222222222222222"
+				}
+			]
+		}`,
+	})
+
+	manifest, err := LoadPackageManifest(filepath.Join(dir, "pkg", "package_manifest.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct{ source, path string }{
+		{filepath.Join(dir, "obj", "meta.far"), "meta/"},
+		{filepath.Join(dir, "pkg", "gen", "data", "a"), "data/a"},
+		{filepath.FromSlash("C:/out/b"), "data/b"},
+	}
+	if len(manifest.Blobs) != len(want) {
+		t.Fatalf("got %d blobs, want %d", len(manifest.Blobs), len(want))
+	}
+	for i, blob := range manifest.Blobs {
+		if blob.SourcePath != want[i].source || blob.Path != want[i].path {
+			t.Errorf("blob %d: got (%q, %q), want (%q, %q)", i, blob.SourcePath, blob.Path, want[i].source, want[i].path)
+		}
+	}
+}
+
+func TestParseManifestWindowsPaths(t *testing.T) {
+	dir := createBuildDir(t, map[string]string{
+		"manifest": "data\\a=obj\\a\nmeta/package=gen\\meta/package\n",
+	})
+
+	paths, _, err := parseManifest(filepath.Join(dir, "manifest"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"data/a":       filepath.FromSlash("obj/a"),
+		"meta/package": filepath.FromSlash("gen/meta/package"),
+	}
+	if len(paths) != len(want) {
+		t.Fatalf("got %v, want %v", paths, want)
+	}
+	for dest, src := range want {
+		if paths[dest] != src {
+			t.Errorf("got %q=%q, want %q", dest, paths[dest], src)
+		}
+	}
+}
+
+func TestValidatePackagePath(t *testing.T) {
+	for _, p := range []string{
+		"a",
+		"meta/package",
+		"data/dir/file.txt",
+		"lib/ld.so.1",
+		"..foo/bar..",
+		strings.Repeat("a", MaxPackagePathSegmentLength),
+	} {
+		if err := validatePackagePath(p); err != nil {
+			t.Errorf("validatePackagePath(%q) = %v, want nil", p, err)
+		}
+	}
+
+	for _, p := range []string{
+		"",
+		"/etc/passwd",
+		"../../etc/passwd",
+		"meta/../foo",
+		"a/./b",
+		"a//b",
+		"a/",
+		`C:/Windows`,
+		"a\x00b",
+		"\xff",
+		strings.Repeat("a", MaxPackagePathSegmentLength+1),
+		strings.Repeat("a/", MaxPackagePathLength/2) + "a",
+	} {
+		var invalid ErrInvalidPackagePath
+		if err := validatePackagePath(p); !errors.As(err, &invalid) {
+			t.Errorf("validatePackagePath(%q) = %v, want ErrInvalidPackagePath", p, err)
+		}
+	}
+}
+
+func TestValidateRejectsInvalidDestinations(t *testing.T) {
+	cfg := TestConfig()
+	defer os.RemoveAll(filepath.Dir(cfg.TempDir))
+	BuildTestPackage(cfg)
+
+	manifest, err := cfg.Manifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest.Paths["../../etc/passwd"] = cfg.ManifestPath
+
+	var invalid ErrInvalidPackagePath
+	if err := Validate(cfg); !errors.As(err, &invalid) || invalid.Path != "../../etc/passwd" {
+		t.Fatalf("got error %v, want ErrInvalidPackagePath for ../../etc/passwd", err)
+	}
+}
+
+func TestLoadPackageManifestRejectsInvalidPaths(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "package_manifest.json")
+	content := `{
+		"version": "1",
+		"package": {"name": "foo", "version": "0"},
+		"blobs": [
+			{"source_path": "meta.far", "path": "meta/", "merkle": "0000000000000000000000000000000000000000000000000000000000000000", "size": 1},
+			{"source_path": "x", "path": "meta/../foo", "merkle": "0000000000000000000000000000000000000000000000000000000000000000", "size": 1}
+		]
+	}`
+	if err := ioutil.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	var invalid ErrInvalidPackagePath
+	if _, err := LoadPackageManifest(path); !errors.As(err, &invalid) || invalid.Path != "meta/../foo" {
+		t.Fatalf("got error %v, want ErrInvalidPackagePath for meta/../foo", err)
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package build
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// precomputedSpotCheckInterval is how often Update fully re-hashes a blob with
+// a precomputed merkle root, to catch stale values without paying for hashing
+// every blob.
+const precomputedSpotCheckInterval = 16
+
+// precomputedPattern matches the optional merkle root and size that may
+// follow the source path of a creation manifest line, as in
+// "dest=src merkle=<root> size=<bytes>".
+var precomputedPattern = regexp.MustCompile(`^(.*?)\s+merkle=([0-9a-fA-F]{64})\s+size=([0-9]+)$`)
+
+// PrecomputedBlob is a merkle root and size supplied by the creation manifest
+// for a file, so that Update need not hash it.
+type PrecomputedBlob struct {
+	Merkle MerkleRoot
+	Size   uint64
+}
+
+// ErrPrecomputedMismatch is returned by Update when a file does not match the
+// merkle root or size precomputed for it in the creation manifest.
+type ErrPrecomputedMismatch struct {
+	Path   string
+	Source string
+	Want   PrecomputedBlob
+	Got    PrecomputedBlob
+}
+
+func (e ErrPrecomputedMismatch) Error() string {
+	if e.Want.Size != e.Got.Size {
+		return fmt.Sprintf("pkg: %q (from %s) is %d bytes, but the manifest says %d", e.Path, e.Source, e.Got.Size, e.Want.Size)
+	}
+	return fmt.Sprintf("pkg: %q (from %s) has merkle root %s, but the manifest says %s", e.Path, e.Source, e.Got.Merkle, e.Want.Merkle)
+}
+
+// splitPrecomputed splits a creation manifest source into the source path and
+// the precomputed blob that may follow it.
+func splitPrecomputed(src string) (string, *PrecomputedBlob, error) {
+	m := precomputedPattern.FindStringSubmatch(src)
+	if m == nil {
+		return src, nil, nil
+	}
+	root, err := DecodeMerkleRoot([]byte(m[2]))
+	if err != nil {
+		return "", nil, err
+	}
+	size, err := strconv.ParseUint(m[3], 10, 64)
+	if err != nil {
+		return "", nil, err
+	}
+	return m[1], &PrecomputedBlob{Merkle: root, Size: size}, nil
+}
+
+// precomputedSpotChecks returns the package paths of the precomputed blobs
+// that Update re-hashes in full. The selection is deterministic, so that a
+// stale value is caught consistently rather than intermittently.
+func precomputedSpotChecks(precomputed map[string]PrecomputedBlob) map[string]bool {
+	dests := make([]string, 0, len(precomputed))
+	for dest := range precomputed {
+		dests = append(dests, dest)
+	}
+	sort.Strings(dests)
+
+	checks := make(map[string]bool)
+	for i := 0; i < len(dests); i += precomputedSpotCheckInterval {
+		checks[dests[i]] = true
+	}
+	return checks
+}
+
+// checkPrecomputedSize cheaply verifies a precomputed blob against the size of
+// its source.
+func checkPrecomputedSize(dest, src string, want PrecomputedBlob) error {
+	info, err := os.Stat(src)
+	if err != nil {
+		return fmt.Errorf("build.Update: stat %s for %s: %w", src, dest, err)
+	}
+	if got := uint64(info.Size()); got != want.Size {
+		return ErrPrecomputedMismatch{
+			Path:   dest,
+			Source: src,
+			Want:   want,
+			Got:    PrecomputedBlob{Merkle: want.Merkle, Size: got},
+		}
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package build
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writePrecomputedManifest rewrites the test package manifest of cfg so that
+// every content entry carries the merkle root and size from contents, with the
+// entry for badPath, if any, given a bogus merkle root.
+func writePrecomputedManifest(t *testing.T, cfg *Config, contents MetaContents, badPath string) {
+	manifest, err := cfg.Manifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lines string
+	for dest, src := range manifest.Paths {
+		root, ok := contents[dest]
+		if !ok {
+			lines += fmt.Sprintf("%s=%s\n", dest, src)
+			continue
+		}
+		info, err := os.Stat(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if dest == badPath {
+			root = MerkleRoot{0xba, 0xd}
+		}
+		lines += fmt.Sprintf("%s=%s merkle=%s size=%d\n", dest, src, root, info.Size())
+	}
+	if err := ioutil.WriteFile(cfg.ManifestPath, []byte(lines), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg.ResetManifest()
+}
+
+func TestUpdateUsesPrecomputedMerkles(t *testing.T) {
+	cfg := TestConfig()
+	defer os.RemoveAll(filepath.Dir(cfg.TempDir))
+	TestPackage(cfg)
+	if err := Update(cfg); err != nil {
+		t.Fatal(err)
+	}
+	want, err := LoadMetaContents(filepath.Join(cfg.OutputDir, "meta", "contents"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writePrecomputedManifest(t, cfg, want, "")
+	manifest, err := cfg.Manifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(manifest.Precomputed) != len(want) {
+		t.Fatalf("got %d precomputed entries, want %d", len(manifest.Precomputed), len(want))
+	}
+	if err := Update(cfg); err != nil {
+		t.Fatal(err)
+	}
+	got, err := LoadMetaContents(filepath.Join(cfg.OutputDir, "meta", "contents"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.String() != want.String() {
+		t.Errorf("got contents\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestUpdatePrecomputedMismatch(t *testing.T) {
+	cfg := TestConfig()
+	defer os.RemoveAll(filepath.Dir(cfg.TempDir))
+	TestPackage(cfg)
+	if err := Update(cfg); err != nil {
+		t.Fatal(err)
+	}
+	contents, err := LoadMetaContents(filepath.Join(cfg.OutputDir, "meta", "contents"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The lexically first path is always spot checked.
+	writePrecomputedManifest(t, cfg, contents, "a")
+	var mismatch ErrPrecomputedMismatch
+	if err := Update(cfg); !errors.As(err, &mismatch) || mismatch.Path != "a" {
+		t.Fatalf("got error %v, want ErrPrecomputedMismatch for \"a\"", err)
+	}
+
+	// Trusted values are used as given.
+	cfg.ResetManifest()
+	cfg.TrustPrecomputedMerkles = true
+	if err := Update(cfg); err != nil {
+		t.Fatal(err)
+	}
+	got, err := LoadMetaContents(filepath.Join(cfg.OutputDir, "meta", "contents"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got["a"] != (MerkleRoot{0xba, 0xd}) {
+		t.Errorf("got merkle root %s for \"a\", want the precomputed value", got["a"])
+	}
+}
+
+func TestUpdatePrecomputedSizeMismatch(t *testing.T) {
+	cfg := TestConfig()
+	defer os.RemoveAll(filepath.Dir(cfg.TempDir))
+	TestPackage(cfg)
+	if err := Update(cfg); err != nil {
+		t.Fatal(err)
+	}
+	contents, err := LoadMetaContents(filepath.Join(cfg.OutputDir, "meta", "contents"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	writePrecomputedManifest(t, cfg, contents, "")
+
+	// "b" is not spot checked, but its size no longer matches.
+	manifest, err := cfg.Manifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(manifest.Paths["b"], []byte("changed content"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	var mismatch ErrPrecomputedMismatch
+	if err := Update(cfg); !errors.As(err, &mismatch) || mismatch.Path != "b" {
+		t.Fatalf("got error %v, want ErrPrecomputedMismatch for \"b\"", err)
+	}
+}
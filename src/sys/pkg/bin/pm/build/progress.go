@@ -0,0 +1,52 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package build
+
+import "time"
+
+// ProgressStage identifies the build operation a ProgressEvent belongs to.
+type ProgressStage string
+
+const (
+	// ProgressUpdate events are emitted by Update as each content file is hashed.
+	ProgressUpdate ProgressStage = "update"
+	// ProgressSeal events are emitted by Seal as the meta.far is written and hashed.
+	ProgressSeal ProgressStage = "seal"
+)
+
+// ProgressEvent describes the progress of a long running build operation.
+type ProgressEvent struct {
+	Stage ProgressStage
+
+	// Path is the package path of the file that was just processed.
+	Path string
+
+	// Files is the number of files processed so far in this stage, out of
+	// TotalFiles.
+	Files      int
+	TotalFiles int
+
+	// Bytes is the number of bytes processed so far in this stage.
+	Bytes uint64
+
+	// Elapsed is the time since the stage started.
+	Elapsed time.Duration
+}
+
+// Done returns true if this is the last event of its stage.
+func (e ProgressEvent) Done() bool {
+	return e.Files == e.TotalFiles
+}
+
+// ProgressFunc receives progress events. It is never called concurrently, but
+// it is called from goroutines other than the one that started the operation,
+// and it should return quickly since it blocks the operation.
+type ProgressFunc func(ProgressEvent)
+
+func (c *Config) reportProgress(e ProgressEvent) {
+	if c.Progress != nil {
+		c.Progress(e)
+	}
+}
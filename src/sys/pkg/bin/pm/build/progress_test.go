@@ -0,0 +1,78 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package build
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestProgress(t *testing.T) {
+	cfg := TestConfig()
+	defer os.RemoveAll(filepath.Dir(cfg.TempDir))
+	TestPackage(cfg)
+
+	var events []ProgressEvent
+	cfg.Progress = func(e ProgressEvent) {
+		events = append(events, e)
+	}
+
+	if err := Update(cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	var contentFiles []string
+	for _, f := range TestFiles {
+		if !strings.HasPrefix(f, "meta/") {
+			contentFiles = append(contentFiles, f)
+		}
+	}
+	if len(events) != len(contentFiles) {
+		t.Fatalf("got %d update events, want %d", len(events), len(contentFiles))
+	}
+	var paths []string
+	var lastBytes uint64
+	for i, e := range events {
+		if e.Stage != ProgressUpdate {
+			t.Errorf("event %d: got stage %q, want %q", i, e.Stage, ProgressUpdate)
+		}
+		if e.Files != i+1 || e.TotalFiles != len(contentFiles) {
+			t.Errorf("event %d: got %d/%d files, want %d/%d", i, e.Files, e.TotalFiles, i+1, len(contentFiles))
+		}
+		if e.Bytes <= lastBytes {
+			t.Errorf("event %d: bytes did not increase: %d <= %d", i, e.Bytes, lastBytes)
+		}
+		lastBytes = e.Bytes
+		paths = append(paths, e.Path)
+	}
+	if !events[len(events)-1].Done() {
+		t.Errorf("expected the last update event to be done")
+	}
+	sort.Strings(paths)
+	sort.Strings(contentFiles)
+	if diff := cmp.Diff(contentFiles, paths); diff != "" {
+		t.Errorf("update event paths mismatch (-want +got):\n%s", diff)
+	}
+
+	events = nil
+	if _, err := Seal(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("got %d seal events, want 1", len(events))
+	}
+	info, err := os.Stat(cfg.MetaFAR())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e := events[0]; e.Stage != ProgressSeal || !e.Done() || e.Bytes != uint64(info.Size()) {
+		t.Errorf("unexpected seal event %+v, want %d bytes", e, info.Size())
+	}
+}
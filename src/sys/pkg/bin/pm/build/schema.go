@@ -0,0 +1,119 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package build
+
+import (
+	"embed"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/xeipuuv/gojsonschema"
+)
+
+var (
+	//go:embed schema/*.json
+	packageManifestSchemas embed.FS
+
+	// compiledSchemas memoizes the compiled schema for each manifest version.
+	compiledSchemasMu sync.Mutex
+	compiledSchemas   = map[string]*gojsonschema.Schema{}
+)
+
+// SchemaViolation is a single way in which a document fails to match its
+// schema.
+type SchemaViolation struct {
+	// Pointer is the JSON pointer to the offending value, e.g. "/blobs/0/size".
+	Pointer string
+	// Expected is the expected type or value, if the schema names one.
+	Expected string
+	// Message describes the violation.
+	Message string
+}
+
+// ErrManifestSchema is returned when a package manifest does not match the
+// schema for its version.
+type ErrManifestSchema struct {
+	Path       string
+	Violations []SchemaViolation
+}
+
+func (e ErrManifestSchema) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s does not match the package manifest schema:", e.Path)
+	for _, v := range e.Violations {
+		pointer := v.Pointer
+		if pointer == "" {
+			pointer = "(root)"
+		}
+		fmt.Fprintf(&b, "\n  %s: %s", pointer, v.Message)
+	}
+	return b.String()
+}
+
+// packageManifestSchema returns the compiled schema for the given package
+// manifest version, or nil if there is none.
+func packageManifestSchema(version string) (*gojsonschema.Schema, error) {
+	compiledSchemasMu.Lock()
+	defer compiledSchemasMu.Unlock()
+
+	if schema, ok := compiledSchemas[version]; ok {
+		return schema, nil
+	}
+	data, err := packageManifestSchemas.ReadFile(fmt.Sprintf("schema/package_manifest-%s.json", version))
+	if err != nil {
+		// Not an embedded version.
+		return nil, nil
+	}
+	schema, err := gojsonschema.NewSchema(gojsonschema.NewBytesLoader(data))
+	if err != nil {
+		return nil, fmt.Errorf("compiling package manifest schema for version %q: %w", version, err)
+	}
+	compiledSchemas[version] = schema
+	return schema, nil
+}
+
+// validatePackageManifestSchema checks the contents of the package manifest at
+// path against the schema for its version. Versions without a schema are left
+// for the caller to reject.
+func validatePackageManifestSchema(path, version string, data []byte) error {
+	schema, err := packageManifestSchema(version)
+	if err != nil || schema == nil {
+		return err
+	}
+	result, err := schema.Validate(gojsonschema.NewBytesLoader(data))
+	if err != nil {
+		return fmt.Errorf("failed to validate %s: %w", path, err)
+	}
+	if result.Valid() {
+		return nil
+	}
+
+	e := ErrManifestSchema{Path: path}
+	for _, re := range result.Errors() {
+		v := SchemaViolation{
+			Pointer: jsonPointer(re.Context()),
+			Message: re.Description(),
+		}
+		if expected, ok := re.Details()["expected"]; ok {
+			v.Expected = fmt.Sprint(expected)
+		}
+		e.Violations = append(e.Violations, v)
+	}
+	return e
+}
+
+// jsonPointer converts a gojsonschema context, such as "(root).blobs.0", to a
+// JSON pointer, such as "/blobs/0".
+func jsonPointer(c *gojsonschema.JsonContext) string {
+	tokens := strings.Split(c.String("\x00"), "\x00")
+	var b strings.Builder
+	for _, token := range tokens[1:] {
+		token = strings.ReplaceAll(token, "~", "~0")
+		token = strings.ReplaceAll(token, "/", "~1")
+		b.WriteString("/" + token)
+	}
+	return b.String()
+}
@@ -0,0 +1,65 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package build
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestLoadPackageManifestSchemaViolations(t *testing.T) {
+	dir := createBuildDir(t, map[string]string{
+		"package_manifest.json": `{
+			"version": "1",
+			"package": {"name": "foo", "version": 0},
+			"blobs": [
+				{"source_path": "meta.far", "path": "meta/", "merkle": "0000000000000000000000000000000000000000000000000000000000000000", "size": 1},
+				{"source_path": "a", "path": "a", "merkle": "not a merkle", "size": "12"}
+			],
+			"blob_sources_relative": "elsewhere"
+		}`,
+	})
+
+	_, err := LoadPackageManifest(filepath.Join(dir, "package_manifest.json"))
+	var schemaErr ErrManifestSchema
+	if !errors.As(err, &schemaErr) {
+		t.Fatalf("got error %v, want ErrManifestSchema", err)
+	}
+
+	want := []SchemaViolation{
+		{Pointer: "/blob_sources_relative"},
+		{Pointer: "/blobs/1/merkle"},
+		{Pointer: "/blobs/1/size", Expected: "integer"},
+		{Pointer: "/package/version", Expected: "string"},
+	}
+	opts := []cmp.Option{
+		cmpopts.IgnoreFields(SchemaViolation{}, "Message"),
+		cmpopts.SortSlices(func(a, b SchemaViolation) bool { return a.Pointer < b.Pointer }),
+	}
+	if d := cmp.Diff(want, schemaErr.Violations, opts...); d != "" {
+		t.Errorf("violations (-want +got):\n%s", d)
+	}
+}
+
+func TestLoadPackageManifestMatchesSchema(t *testing.T) {
+	dir := createBuildDir(t, map[string]string{
+		"package_manifest.json": `{
+			"version": "1",
+			"repository": "fuchsia.com",
+			"package": {"name": "foo", "version": "0"},
+			"blobs": [
+				{"source_path": "meta.far", "path": "meta/", "merkle": "0000000000000000000000000000000000000000000000000000000000000000", "size": 1}
+			],
+			"blob_sources_relative": "file"
+		}`,
+	})
+	if _, err := LoadPackageManifest(filepath.Join(dir, "package_manifest.json")); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package build
+
+import "fmt"
+
+// SubpackageInfo identifies a subpackage of a package.
+type SubpackageInfo struct {
+	// The name of the subpackage within its parent
+	Name string `json:"name"`
+
+	// Merkle root of the subpackage's meta.far
+	Merkle MerkleRoot `json:"merkle"`
+
+	// The path of the subpackage's package manifest
+	ManifestPath string `json:"manifest_path"`
+}
+
+// LoadPackageManifestClosure loads the package manifest at path and the
+// manifests of all packages reachable through its subpackages, keyed by
+// manifest path. Each subpackage's meta.far is checked against the merkle root
+// its parent declares for it.
+func LoadPackageManifestClosure(path string) (map[string]*PackageManifest, error) {
+	closure := make(map[string]*PackageManifest)
+	var load func(path string, want *SubpackageInfo) error
+	load = func(path string, want *SubpackageInfo) error {
+		if _, ok := closure[path]; ok {
+			return nil
+		}
+		m, err := LoadPackageManifest(path)
+		if err != nil {
+			return err
+		}
+		if want != nil {
+			var got MerkleRoot
+			for _, blob := range m.Blobs {
+				if blob.Path == "meta/" {
+					got = blob.Merkle
+				}
+			}
+			if got != want.Merkle {
+				return fmt.Errorf("pkg: subpackage %q manifest %s has meta.far %s, but its parent expects %s", want.Name, path, got, want.Merkle)
+			}
+		}
+		closure[path] = m
+		for i := range m.Subpackages {
+			sub := m.Subpackages[i]
+			if err := load(sub.ManifestPath, &sub); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := load(path, nil); err != nil {
+		return nil, err
+	}
+	return closure, nil
+}
@@ -0,0 +1,75 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package build
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeTestSubpackageManifests builds a parent and a child package, and writes
+// their package manifests with the child declared as a subpackage of the
+// parent under the given merkle root, returning the parent manifest path.
+func writeTestSubpackageManifests(t *testing.T, childMerkle *MerkleRoot) (string, string) {
+	dir := t.TempDir()
+	var manifests []*PackageManifest
+	for _, name := range []string{"parent", "child"} {
+		cfg := TestConfig()
+		t.Cleanup(func() { os.RemoveAll(filepath.Dir(cfg.TempDir)) })
+		cfg.PkgName = name
+		BuildTestPackage(cfg)
+		m, err := cfg.OutputManifest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		manifests = append(manifests, m)
+	}
+	parent, child := manifests[0], manifests[1]
+
+	childPath := filepath.Join(dir, "child", "package_manifest.json")
+	if err := os.MkdirAll(filepath.Dir(childPath), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := WritePackageManifest(child, childPath, false); err != nil {
+		t.Fatal(err)
+	}
+
+	merkle := child.Blobs[0].Merkle
+	if childMerkle != nil {
+		merkle = *childMerkle
+	}
+	parent.Subpackages = []SubpackageInfo{{Name: "child", Merkle: merkle, ManifestPath: childPath}}
+	parentPath := filepath.Join(dir, "package_manifest.json")
+	if err := WritePackageManifest(parent, parentPath, true); err != nil {
+		t.Fatal(err)
+	}
+	return parentPath, childPath
+}
+
+func TestLoadPackageManifestClosure(t *testing.T) {
+	parentPath, childPath := writeTestSubpackageManifests(t, nil)
+
+	closure, err := LoadPackageManifestClosure(parentPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(closure) != 2 {
+		t.Fatalf("got %d manifests, want 2", len(closure))
+	}
+	if got := closure[parentPath].Subpackages[0].ManifestPath; got != childPath {
+		t.Errorf("got subpackage manifest path %q, want %q", got, childPath)
+	}
+	if got := closure[childPath].Package.Name; got != "child" {
+		t.Errorf("got subpackage %q, want %q", got, "child")
+	}
+}
+
+func TestLoadPackageManifestClosureMerkleMismatch(t *testing.T) {
+	parentPath, _ := writeTestSubpackageManifests(t, &MerkleRoot{1})
+	if _, err := LoadPackageManifestClosure(parentPath); err == nil {
+		t.Fatal("expected an error for a subpackage with the wrong merkle root")
+	}
+}
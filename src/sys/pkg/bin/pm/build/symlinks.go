@@ -0,0 +1,108 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package build
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// SymlinkPolicy controls how package sources that are symbolic links are
+// handled when a manifest is loaded.
+type SymlinkPolicy int
+
+const (
+	// SymlinkFollow silently follows symlinked sources. This is the default.
+	SymlinkFollow SymlinkPolicy = iota
+	// SymlinkForbid rejects manifests that contain symlinked sources, for
+	// build environments that require hermetic inputs.
+	SymlinkForbid
+	// SymlinkRecordTarget replaces symlinked sources with the path of the file
+	// they resolve to, so that outputs such as depfiles and package manifests
+	// name the real input.
+	SymlinkRecordTarget
+)
+
+var symlinkPolicyNames = map[SymlinkPolicy]string{
+	SymlinkFollow:       "follow",
+	SymlinkForbid:       "forbid",
+	SymlinkRecordTarget: "record-target",
+}
+
+func (p SymlinkPolicy) String() string {
+	if name, ok := symlinkPolicyNames[p]; ok {
+		return name
+	}
+	return fmt.Sprintf("SymlinkPolicy(%d)", int(p))
+}
+
+// Set implements flag.Value.
+func (p *SymlinkPolicy) Set(s string) error {
+	for policy, name := range symlinkPolicyNames {
+		if name == s {
+			*p = policy
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown symlink policy %q, must be one of follow, forbid or record-target", s)
+}
+
+// ErrSymlinkForbidden is returned when a package source is a symlink and the
+// SymlinkForbid policy is in effect.
+type ErrSymlinkForbidden struct {
+	Path   string
+	Source string
+	Target string
+}
+
+func (e ErrSymlinkForbidden) Error() string {
+	return fmt.Sprintf("pkg: source %q for %q is a symlink to %q, which is forbidden", e.Source, e.Path, e.Target)
+}
+
+// applySymlinkPolicy applies policy to the sources in paths, a map of package
+// path to source path, returning the errors for every offending entry.
+func applySymlinkPolicy(policy SymlinkPolicy, paths map[string]string) error {
+	if policy == SymlinkFollow {
+		return nil
+	}
+
+	dests := make([]string, 0, len(paths))
+	for dest := range paths {
+		dests = append(dests, dest)
+	}
+	sort.Strings(dests)
+
+	var errs FileErrors
+	for _, dest := range dests {
+		src := paths[dest]
+		info, err := os.Lstat(src)
+		if err != nil {
+			// Missing sources are reported by Validate and Update.
+			continue
+		}
+		if info.Mode()&os.ModeSymlink == 0 {
+			continue
+		}
+		target, err := filepath.EvalSymlinks(src)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("pkg: resolving symlink %q for %q: %w", src, dest, err))
+			continue
+		}
+		switch policy {
+		case SymlinkForbid:
+			errs = append(errs, ErrSymlinkForbidden{Path: dest, Source: src, Target: target})
+		case SymlinkRecordTarget:
+			paths[dest] = target
+		}
+	}
+	return errs.ErrorOrNil()
+}
+
+// ApplySymlinkPolicy applies policy to every source in the manifest.
+func (m *Manifest) ApplySymlinkPolicy(policy SymlinkPolicy) error {
+	return applySymlinkPolicy(policy, m.Paths)
+}
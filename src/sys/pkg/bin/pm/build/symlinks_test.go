@@ -0,0 +1,108 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package build
+
+import (
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// symlinkTestPackage creates the test package, then replaces the source of
+// package path "a" with a symlink to a copy of it, returning the path of the
+// link and of its target.
+func symlinkTestPackage(t *testing.T, cfg *Config) (string, string) {
+	TestPackage(cfg)
+	manifest, err := cfg.Manifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	link := manifest.Paths["a"]
+	target := link + ".target"
+	if err := os.Rename(link, target); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(target, link); err != nil {
+		t.Fatal(err)
+	}
+	cfg.ResetManifest()
+	return link, target
+}
+
+func TestSymlinkPolicyFollow(t *testing.T) {
+	cfg := TestConfig()
+	defer os.RemoveAll(filepath.Dir(cfg.TempDir))
+	link, _ := symlinkTestPackage(t, cfg)
+
+	manifest, err := cfg.Manifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := manifest.Paths["a"]; got != link {
+		t.Errorf("got source %q, want %q", got, link)
+	}
+	if err := Update(cfg); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSymlinkPolicyForbid(t *testing.T) {
+	cfg := TestConfig()
+	defer os.RemoveAll(filepath.Dir(cfg.TempDir))
+	link, target := symlinkTestPackage(t, cfg)
+	cfg.SymlinkPolicy = SymlinkForbid
+
+	err := Update(cfg)
+	var forbidden ErrSymlinkForbidden
+	if !errors.As(err, &forbidden) {
+		t.Fatalf("got error %v, want ErrSymlinkForbidden", err)
+	}
+	resolved, err := filepath.EvalSymlinks(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ErrSymlinkForbidden{Path: "a", Source: link, Target: resolved}
+	if forbidden != want {
+		t.Errorf("got %#v, want %#v", forbidden, want)
+	}
+}
+
+func TestSymlinkPolicyRecordTarget(t *testing.T) {
+	cfg := TestConfig()
+	defer os.RemoveAll(filepath.Dir(cfg.TempDir))
+	_, target := symlinkTestPackage(t, cfg)
+	cfg.SymlinkPolicy = SymlinkRecordTarget
+
+	manifest, err := cfg.Manifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	resolved, err := filepath.EvalSymlinks(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := manifest.Paths["a"]; got != resolved {
+		t.Errorf("got source %q, want %q", got, resolved)
+	}
+}
+
+func TestSymlinkPolicyFlag(t *testing.T) {
+	cfg := TestConfig()
+	defer os.RemoveAll(filepath.Dir(cfg.TempDir))
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	cfg.InitFlags(fs)
+	if err := fs.Parse([]string{"-symlinks", "record-target"}); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.SymlinkPolicy != SymlinkRecordTarget {
+		t.Errorf("got %s, want %s", cfg.SymlinkPolicy, SymlinkRecordTarget)
+	}
+	if err := fs.Parse([]string{"-symlinks", "bogus"}); err == nil {
+		t.Errorf("expected an error for an unknown policy")
+	}
+}
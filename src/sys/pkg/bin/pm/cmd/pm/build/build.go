@@ -15,13 +15,16 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
 
 	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/build"
 	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/cmd/pm/seal"
 	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/cmd/pm/update"
 )
 
-const usage = `Usage: %s build
+const usage = `Usage: %s build [-watch]
 perform update and seal in order
 `
 
@@ -32,6 +35,14 @@ func Run(cfg *build.Config, args []string) error {
 	var pkgManifestPath = fs.String("output-package-manifest", "", "If set, produce a package manifest at the given path")
 	var blobsfile = fs.Bool("blobsfile", false, "Produce blobs.json file")
 	var blobsmani = fs.Bool("blobs-manifest", false, "Produce blobs.manifest file")
+	var buildIDs = fs.Bool("build-ids", false, "Produce build_ids.json file indexing the GNU build-ids of ELF blobs")
+	var deliveryBlobs = fs.Bool("delivery-blobs", false, "Write type 1 delivery blobs of every blob to the delivery_blobs directory, and record them in blobs.json and the package manifest")
+	var progress = fs.Bool("progress", false, "Print a status line as files are hashed and the package is sealed")
+	var gc = fs.Bool("gc", false, "Remove files in the output directory that are no longer part of the package")
+	var gcDryRun = fs.Bool("gc-dry-run", false, "Like -gc, but only print the files that would be removed")
+	var watch = fs.Bool("watch", false, "Rebuild the package whenever the manifest or any of its sources change")
+	var watchDelay = fs.Duration("watch-delay", defaultWatchDelay, "With -watch, how long to wait for further changes before rebuilding")
+	var publishRepo = fs.String("publish-repo", "", "With -watch, publish the package to the repository at this path after every rebuild")
 
 	fs.Usage = func() {
 		fmt.Fprintf(os.Stderr, usage, filepath.Base(os.Args[0]))
@@ -47,6 +58,46 @@ func Run(cfg *build.Config, args []string) error {
 		fmt.Fprintf(os.Stderr, "WARNING: unused arguments: %s\n", fs.Args())
 	}
 
+	if *progress {
+		cfg.Progress = printProgress
+	}
+
+	opts := buildOptions{
+		depfile:         *depfile,
+		pkgManifestPath: *pkgManifestPath,
+		blobsfile:       *blobsfile,
+		blobsmani:       *blobsmani,
+		buildIDs:        *buildIDs,
+		deliveryBlobs:   *deliveryBlobs,
+		gc:              *gc || *gcDryRun,
+		gcDryRun:        *gcDryRun,
+	}
+
+	if *watch {
+		return watchAndRebuild(cfg, opts, *watchDelay, *publishRepo)
+	}
+	if *publishRepo != "" {
+		return fmt.Errorf("the -publish-repo option requires the use of the -watch option")
+	}
+
+	return runBuild(cfg, opts)
+}
+
+// buildOptions holds the optional outputs of a single `pm build` run.
+type buildOptions struct {
+	depfile         bool
+	pkgManifestPath string
+	blobsfile       bool
+	blobsmani       bool
+	buildIDs        bool
+	deliveryBlobs   bool
+	gc              bool
+	gcDryRun        bool
+}
+
+// runBuild performs a single update and seal of the package described by cfg,
+// writing any additional outputs requested in opts.
+func runBuild(cfg *build.Config, opts buildOptions) error {
 	if err := update.Run(cfg, []string{}); err != nil {
 		return fmt.Errorf("failed to update the merkle roots: %s", err)
 	}
@@ -55,7 +106,7 @@ func Run(cfg *build.Config, args []string) error {
 		return fmt.Errorf("failed to seal the package: %s", err)
 	}
 
-	if *depfile {
+	if opts.depfile {
 		if cfg.ManifestPath == "" {
 			return fmt.Errorf("the -depfile option requires the use of the -m manifest option")
 		}
@@ -78,7 +129,13 @@ func Run(cfg *build.Config, args []string) error {
 		return err
 	}
 
-	if *blobsfile {
+	if opts.deliveryBlobs {
+		if err := build.WriteDeliveryBlobs(blobs, deliveryBlobsDir(cfg)); err != nil {
+			return err
+		}
+	}
+
+	if opts.blobsfile {
 		content, err := json.MarshalIndent(blobs, "", "    ")
 		if err != nil {
 			return err
@@ -88,7 +145,7 @@ func Run(cfg *build.Config, args []string) error {
 		}
 	}
 
-	if *blobsmani {
+	if opts.blobsmani {
 		var buf bytes.Buffer
 		for _, blob := range blobs {
 			fmt.Fprintf(&buf, "%s=%s\n", blob.Merkle.String(), blob.SourcePath)
@@ -98,23 +155,102 @@ func Run(cfg *build.Config, args []string) error {
 		}
 	}
 
-	if *pkgManifestPath != "" {
+	if opts.buildIDs {
+		entries, err := build.BuildIDIndex(blobs)
+		if err != nil {
+			return err
+		}
+		var buf bytes.Buffer
+		if err := build.WriteBuildIDIndex(&buf, entries); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(filepath.Join(cfg.OutputDir, "build_ids.json"), buf.Bytes(), 0644); err != nil {
+			return err
+		}
+	}
+
+	if opts.pkgManifestPath != "" {
 		pkgManifest, err := cfg.OutputManifest()
 		if err != nil {
 			return err
 		}
+		// Include the delivery blobs written above.
+		pkgManifest.Blobs = blobs
 		content, err := json.MarshalIndent(pkgManifest, "", "    ")
 		if err != nil {
 			return err
 		}
-		if err := ioutil.WriteFile(*pkgManifestPath, content, 0644); err != nil {
+		if err := ioutil.WriteFile(opts.pkgManifestPath, content, 0644); err != nil {
 			return err
 		}
 	}
 
+	if opts.gc {
+		if err := collectGarbage(cfg, opts); err != nil {
+			return fmt.Errorf("failed to garbage collect the output directory: %s", err)
+		}
+	}
+
 	return nil
 }
 
+// collectGarbage removes (or with gcDryRun, reports) files in the output
+// directory that were not produced or referenced by this build.
+func collectGarbage(cfg *build.Config, opts buildOptions) error {
+	var keep []string
+	if opts.depfile {
+		keep = append(keep, cfg.MetaFAR()+".d")
+	}
+	if opts.blobsfile {
+		keep = append(keep, filepath.Join(cfg.OutputDir, "blobs.json"))
+	}
+	if opts.blobsmani {
+		keep = append(keep, filepath.Join(cfg.OutputDir, "blobs.manifest"))
+	}
+	if opts.buildIDs {
+		keep = append(keep, filepath.Join(cfg.OutputDir, "build_ids.json"))
+	}
+	if opts.pkgManifestPath != "" {
+		keep = append(keep, opts.pkgManifestPath)
+	}
+	if opts.deliveryBlobs {
+		blobs, err := cfg.BlobInfo()
+		if err != nil {
+			return err
+		}
+		for _, blob := range blobs {
+			keep = append(keep, filepath.Join(deliveryBlobsDir(cfg), blob.Merkle.String()))
+		}
+	}
+
+	garbage, err := build.GarbageCollect(cfg, keep, opts.gcDryRun)
+	if err != nil {
+		return err
+	}
+	for _, path := range garbage {
+		if opts.gcDryRun {
+			fmt.Printf("would remove %s\n", path)
+		} else {
+			fmt.Printf("removed %s\n", path)
+		}
+	}
+	return nil
+}
+
+// deliveryBlobsDir returns the directory that -delivery-blobs writes to.
+func deliveryBlobsDir(cfg *build.Config) string {
+	return filepath.Join(cfg.OutputDir, "delivery_blobs")
+}
+
+// printProgress renders build progress events as a status line on stderr.
+func printProgress(e build.ProgressEvent) {
+	fmt.Fprintf(os.Stderr, "\r[pm build] %s: %d/%d files, %s, %v",
+		e.Stage, e.Files, e.TotalFiles, humanize.IBytes(e.Bytes), e.Elapsed.Round(time.Millisecond))
+	if e.Done() {
+		fmt.Fprintln(os.Stderr)
+	}
+}
+
 // computedOutputs are files that are produced by the `build` composite command
 // that must be excluded from the depfile
 var computedOutputs = map[string]struct{}{
@@ -0,0 +1,143 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package build
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"time"
+
+	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/build"
+	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/fswatch"
+	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/repo"
+)
+
+// defaultWatchDelay is the default time to wait for more filesystem events
+// before rebuilding, so that a burst of writes from an editor or a build
+// results in a single rebuild.
+const defaultWatchDelay = 100 * time.Millisecond
+
+// watchGeneratedPaths are package paths whose sources are written by the build
+// itself, and so must not be watched or every build would trigger another.
+var watchGeneratedPaths = map[string]struct{}{
+	"meta/contents":                 {},
+	"meta/fuchsia.abi/abi-revision": {},
+}
+
+// watchAndRebuild builds the package, then rebuilds it every time the
+// manifest or one of the files it references changes, until interrupted. If
+// publishRepo is non-empty, the package is published to the repository at
+// that path after every successful build.
+func watchAndRebuild(cfg *build.Config, opts buildOptions, delay time.Duration, publishRepo string) error {
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+	return watchUntil(cfg, opts, delay, publishRepo, interrupt)
+}
+
+// watchUntil implements watchAndRebuild, returning once stop receives a signal.
+func watchUntil(cfg *build.Config, opts buildOptions, delay time.Duration, publishRepo string, stop <-chan os.Signal) error {
+	if cfg.ManifestPath == "" {
+		return fmt.Errorf("the -watch option requires the use of the -m manifest option")
+	}
+	if publishRepo != "" && opts.pkgManifestPath == "" {
+		opts.pkgManifestPath = filepath.Join(cfg.OutputDir, "package_manifest.json")
+	}
+
+	w, err := fswatch.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to initialize fsnotify: %s", err)
+	}
+	defer w.Close()
+
+	rebuild := func() {
+		start := time.Now()
+		cfg.ResetManifest()
+		err := runBuild(cfg, opts)
+		if err == nil && publishRepo != "" {
+			err = publish(publishRepo, opts.pkgManifestPath)
+		}
+		status := "rebuilt"
+		if err != nil {
+			status = fmt.Sprintf("build failed: %s", err)
+		}
+		fmt.Fprintf(os.Stderr, "%s [pm build] %s %s in %v\n",
+			time.Now().Format("2006-01-02 15:04:05"), cfg.MetaFAR(), status, time.Since(start).Round(time.Millisecond))
+
+		// Editors commonly replace files rather than writing them in place,
+		// which drops the watch, and the manifest may have gained new
+		// sources, so (re-)add every input after each build.
+		for _, path := range watchPaths(cfg) {
+			if err := w.Add(path); err != nil {
+				log.Printf("[pm build] unable to watch %q: %s", path, err)
+			}
+		}
+	}
+
+	rebuild()
+
+	var timer <-chan time.Time
+	for {
+		select {
+		case event, ok := <-w.Events:
+			if !ok {
+				return nil
+			}
+			if event.Op&^fswatch.Chmod == 0 {
+				// Only the file's mode changed.
+				continue
+			}
+			timer = time.After(delay)
+		case err, ok := <-w.Errors:
+			if !ok {
+				return nil
+			}
+			log.Printf("[pm build] watch error: %s", err)
+		case <-timer:
+			timer = nil
+			rebuild()
+		case <-stop:
+			return nil
+		}
+	}
+}
+
+// watchPaths returns the manifest path along with the source of every file in
+// the package that is not generated by the build itself.
+func watchPaths(cfg *build.Config) []string {
+	paths := []string{cfg.ManifestPath}
+	manifest, err := cfg.Manifest()
+	if err != nil {
+		// The manifest itself is still watched, so fixing it triggers a rebuild.
+		return paths
+	}
+	for dst, src := range manifest.Paths {
+		if _, ok := watchGeneratedPaths[dst]; ok {
+			continue
+		}
+		paths = append(paths, src)
+	}
+	return paths
+}
+
+// publish adds the package described by the package manifest at
+// pkgManifestPath to the repository at repoDir, creating the repository if
+// needed, and commits the updated metadata.
+func publish(repoDir, pkgManifestPath string) error {
+	r, err := repo.New(repoDir, filepath.Join(repoDir, "repository", "blobs"))
+	if err != nil {
+		return err
+	}
+	if err := r.Init(); err != nil && !os.IsExist(err) {
+		return fmt.Errorf("repository at %q is not valid or could not be initialized: %s", repoDir, err)
+	}
+	if _, err := r.PublishManifest(pkgManifestPath); err != nil {
+		return fmt.Errorf("failed to publish %s: %s", pkgManifestPath, err)
+	}
+	return r.CommitUpdates(false)
+}
@@ -0,0 +1,67 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package build
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/build"
+)
+
+func TestWatchRebuildsOnChange(t *testing.T) {
+	cfg := build.TestConfig()
+	defer os.RemoveAll(filepath.Dir(cfg.TempDir))
+	build.TestPackage(cfg)
+
+	stop := make(chan os.Signal, 1)
+	done := make(chan error, 1)
+	go func() {
+		done <- watchUntil(cfg, buildOptions{}, 10*time.Millisecond, "", stop)
+	}()
+	defer func() {
+		stop <- os.Interrupt
+		if err := <-done; err != nil {
+			t.Errorf("watch failed: %s", err)
+		}
+	}()
+
+	// Wait for the initial build.
+	first := waitForMerkle(t, cfg, nil, func() {})
+
+	// Change one of the package's files and wait for the rebuild. The file
+	// is only watched once the initial build has finished, so keep writing
+	// it until the rebuild is seen.
+	src := filepath.Join(filepath.Dir(cfg.ManifestPath), "package", "a")
+	waitForMerkle(t, cfg, first, func() {
+		if err := ioutil.WriteFile(src, []byte("changed\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+// waitForMerkle calls poke, then waits for the package's meta.far.merkle to
+// exist and differ from prev, poking again every so often, and returns its
+// contents.
+func waitForMerkle(t *testing.T, cfg *build.Config, prev []byte, poke func()) []byte {
+	t.Helper()
+	deadline := time.Now().Add(30 * time.Second)
+	for i := 0; time.Now().Before(deadline); i++ {
+		if i%10 == 0 {
+			poke()
+		}
+		b, err := ioutil.ReadFile(cfg.MetaFARMerkle())
+		if err == nil && len(b) > 0 && !bytes.Equal(b, prev) {
+			return b
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %s to be rebuilt", cfg.MetaFARMerkle())
+	return nil
+}
@@ -0,0 +1,95 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// Package gc contains the `pm gc` command
+package gc
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/build"
+	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/repo"
+)
+
+const usage = `Usage: %s gc [-n] [-v] [-keep-repo <repository directory>...] -repo <repository directory>
+remove blobs no package target in the repository refers to
+`
+
+// repoList is a flag.Value that collects repository directories.
+type repoList []string
+
+func (l *repoList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *repoList) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
+func Run(cfg *build.Config, args []string) error {
+	fs := flag.NewFlagSet("gc", flag.ExitOnError)
+
+	config := &repo.Config{}
+	config.Vars(fs)
+	dryRun := fs.Bool("n", false, "Only report the unreferenced blobs, do not remove them.")
+	verbose := fs.Bool("v", false, "List every unreferenced blob.")
+	var keepRepos repoList
+	fs.Var(&keepRepos, "keep-repo", "Another repository that publishes blobs from this repository's blob store. The blobs it refers to are kept. May be repeated.")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, usage, filepath.Base(os.Args[0]))
+		fmt.Fprintln(os.Stderr)
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if len(fs.Args()) != 0 {
+		fmt.Fprintf(os.Stderr, "WARNING: unused arguments: %s\n", fs.Args())
+	}
+	config.ApplyDefaults()
+
+	if _, err := os.Stat(config.RepoDir); err != nil {
+		return fmt.Errorf("repository path %q is not valid: %s", config.RepoDir, err)
+	}
+	blobsDir := filepath.Join(config.RepoDir, "repository", "blobs")
+	r, err := repo.New(config.RepoDir, blobsDir)
+	if err != nil {
+		return err
+	}
+	opts := repo.GCOptions{DryRun: *dryRun}
+	for _, dir := range keepRepos {
+		if _, err := os.Stat(dir); err != nil {
+			return fmt.Errorf("repository path %q is not valid: %s", dir, err)
+		}
+		other, err := repo.New(dir, blobsDir)
+		if err != nil {
+			return err
+		}
+		opts.Others = append(opts.Others, other)
+	}
+
+	result, err := r.GC(opts)
+	if err != nil {
+		return err
+	}
+	if *verbose {
+		for _, root := range result.Unreferenced {
+			fmt.Println(root)
+		}
+	}
+	verb := "removed"
+	if *dryRun {
+		verb = "would remove"
+	}
+	fmt.Printf("%d blobs referenced, %s %d unreferenced blobs (%d bytes)\n",
+		result.Reachable, verb, len(result.Unreferenced), result.UnreferencedBytes)
+	return nil
+}
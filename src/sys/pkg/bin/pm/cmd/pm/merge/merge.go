@@ -0,0 +1,73 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// Package merge contains the `pm merge` command
+package merge
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/build"
+	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/repo"
+)
+
+const usage = `Usage: %s merge -repo <repository directory> -src <repository directory> [-src ...]
+merge the packages and blobs of other repositories into a repository
+`
+
+type repeatedArg []string
+
+func (r *repeatedArg) Set(s string) error {
+	*r = append(*r, s)
+	return nil
+}
+
+func (r *repeatedArg) String() string {
+	return strings.Join(*r, " ")
+}
+
+func Run(cfg *build.Config, args []string) error {
+	fs := flag.NewFlagSet("merge", flag.ExitOnError)
+
+	config := &repo.Config{}
+	config.Vars(fs)
+
+	var srcs repeatedArg
+	fs.Var(&srcs, "src", "Path(s) of the repositories to merge")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, usage, filepath.Base(os.Args[0]))
+		fmt.Fprintln(os.Stderr)
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if len(fs.Args()) != 0 {
+		fmt.Fprintf(os.Stderr, "WARNING: unused arguments: %s\n", fs.Args())
+	}
+	config.ApplyDefaults()
+
+	if len(srcs) == 0 {
+		return fmt.Errorf("no repository to merge supplied")
+	}
+
+	r, err := repo.New(config.RepoDir, filepath.Join(config.RepoDir, "repository", "blobs"))
+	if err != nil {
+		return err
+	}
+	if err := r.Init(); err != nil && err != os.ErrExist {
+		return fmt.Errorf("repository at %q is not valid or could not be initialized: %s", config.RepoDir, err)
+	}
+
+	if err := r.Merge(srcs); err != nil {
+		return err
+	}
+	return r.CommitUpdates(config.TimeVersioned)
+}
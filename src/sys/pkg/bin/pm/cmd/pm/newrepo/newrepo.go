@@ -11,20 +11,70 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
 	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/build"
 	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/repo"
 )
 
-const usage = `Usage: %s newrepo
+const usage = `Usage: %s newrepo [-keys role=n] [-threshold role=n] [-expires role=duration]
 create a new repostory and associated key material
+
+The -keys, -threshold and -expires flags may be repeated to configure each of
+the root, targets, snapshot and timestamp roles, for example:
+
+    -keys root=3 -threshold root=2 -expires timestamp=24h
 `
 
+// policyFlag is a flag that sets a field of the repository policy of the role
+// named in its "role=value" argument.
+type policyFlag struct {
+	policy repo.Policy
+	set    func(p *repo.RolePolicy, value string) error
+}
+
+func (f *policyFlag) String() string {
+	return ""
+}
+
+func (f *policyFlag) Set(arg string) error {
+	i := strings.Index(arg, "=")
+	if i < 0 {
+		return fmt.Errorf("expected role=value, got %q", arg)
+	}
+	role := arg[:i]
+	p, ok := f.policy[role]
+	if !ok {
+		return fmt.Errorf("unknown role %q", role)
+	}
+	if err := f.set(&p, arg[i+1:]); err != nil {
+		return err
+	}
+	f.policy[role] = p
+	return nil
+}
+
 func Run(cfg *build.Config, args []string) error {
 	fs := flag.NewFlagSet("newrepo", flag.ExitOnError)
 
 	config := &repo.Config{}
 	config.Vars(fs)
+	policy := repo.DefaultPolicy()
+	fs.Var(&policyFlag{policy, func(p *repo.RolePolicy, v string) (err error) {
+		p.Keys, err = strconv.Atoi(v)
+		return
+	}}, "keys", "Number of keys to generate for a role, as `role=n`.")
+	fs.Var(&policyFlag{policy, func(p *repo.RolePolicy, v string) (err error) {
+		p.Threshold, err = strconv.Atoi(v)
+		return
+	}}, "threshold", "Number of keys that must sign the metadata of a role, as `role=n`.")
+	fs.Var(&policyFlag{policy, func(p *repo.RolePolicy, v string) error {
+		d, err := time.ParseDuration(v)
+		p.Expires = repo.Duration(d)
+		return err
+	}}, "expires", "How long the metadata of a role is valid for, as `role=duration`.")
 
 	fs.Usage = func() {
 		fmt.Fprintf(os.Stderr, usage, filepath.Base(os.Args[0]))
@@ -46,11 +96,11 @@ func Run(cfg *build.Config, args []string) error {
 	if err != nil {
 		return err
 	}
-	if err := r.Init(); err != nil {
+	if err := r.InitWithPolicy(policy); err != nil {
 		return err
 	}
 
-	if err := r.Repo.AddTargets([]string{}, json.RawMessage{}); err != nil {
+	if err := r.AddTargets([]string{}, json.RawMessage{}); err != nil {
 		return err
 	}
 
@@ -17,13 +17,17 @@ import (
 	buildcmd "go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/cmd/pm/build"
 	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/cmd/pm/delta"
 	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/cmd/pm/expand"
+	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/cmd/pm/gc"
 	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/cmd/pm/genkey"
 	initcmd "go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/cmd/pm/init"
+	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/cmd/pm/merge"
 	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/cmd/pm/newrepo"
 	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/cmd/pm/publish"
+	repocmd "go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/cmd/pm/repo"
 	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/cmd/pm/seal"
 	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/cmd/pm/serve"
 	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/cmd/pm/snapshot"
+	synccmd "go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/cmd/pm/sync"
 	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/cmd/pm/update"
 	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/cmd/pm/verify"
 )
@@ -42,6 +46,10 @@ Repository Commands:
     newrepo  - create a new local repostory
     publish  - publish a package to a local repository
     serve    - serve a local repository
+    merge    - merge other repositories into a local repository
+    gc       - remove unreferenced blobs from a local repository
+    sync     - upload a local repository to cloud storage
+    repo     - inspect and maintain a local repository
     expand   - (deprecated) expand an archive
 
 Tools:
@@ -98,15 +106,24 @@ func doMain() int {
 	case "expand":
 		err = expand.Run(cfg, flag.Args()[1:])
 
+	case "gc":
+		err = gc.Run(cfg, flag.Args()[1:])
+
 	case "genkey":
 		err = genkey.Run(cfg, flag.Args()[1:])
 
 	case "init":
 		err = initcmd.Run(cfg, flag.Args()[1:])
 
+	case "merge":
+		err = merge.Run(cfg, flag.Args()[1:])
+
 	case "publish":
 		err = publish.Run(cfg, flag.Args()[1:])
 
+	case "repo":
+		err = repocmd.Run(cfg, flag.Args()[1:])
+
 	case "seal":
 		err = seal.Run(cfg, flag.Args()[1:])
 
@@ -120,6 +137,9 @@ func doMain() int {
 	case "snapshot":
 		err = snapshot.Run(cfg, flag.Args()[1:])
 
+	case "sync":
+		err = synccmd.Run(cfg, flag.Args()[1:])
+
 	case "update":
 		err = update.Run(cfg, flag.Args()[1:])
 
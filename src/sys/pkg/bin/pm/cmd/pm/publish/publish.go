@@ -6,7 +6,7 @@ package publish
 
 import (
 	"bufio"
-	"bytes"
+	"context"
 	"encoding/json"
 	"flag"
 	"fmt"
@@ -14,21 +14,23 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"runtime"
 	"runtime/debug"
 	"strconv"
 	"strings"
 
 	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/build"
-	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/pkg"
+	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/pmhttp"
 	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/repo"
-	far "go.fuchsia.dev/fuchsia/src/sys/pkg/lib/far/go"
 )
 
 const (
 	usage = `Usage: %s publish [-a|-lp] -C -f <file> [-repo <repository directory>]
 		Pass any one of the mode flags [-a|-lp], and at least one file to pubish.
+		Several package archives may be published at once with -a.
+		With -remote, the repository is then uploaded to a remote
+		repository served by "pm serve -upload".
 `
-	metaFar = "meta.far"
 )
 
 type RepeatedArg []string
@@ -45,7 +47,7 @@ func (r *RepeatedArg) String() string {
 func Run(cfg *build.Config, args []string) error {
 	fs := flag.NewFlagSet("publish", flag.ExitOnError)
 
-	archiveMode := fs.Bool("a", false, "(mode) Publish an archived package.")
+	archiveMode := fs.Bool("a", false, "(mode) Publish archived packages.")
 	listOfPackageManifestsMode := fs.Bool("lp", false, "(mode) Publish a list of packages (and blobs) by package output manifest")
 	packageSetMode := fs.Bool("ps", false, "(mode) Publish a set of packages from a manifest.")
 	blobSetMode := fs.Bool("bs", false, "(mode) Publish a set of blobs from a manifest.")
@@ -64,6 +66,10 @@ func Run(cfg *build.Config, args []string) error {
 	noCreateRepo := fs.Bool("n", false, "If the specified repository path does not exist, do NOT attempt to create it.")
 
 	depfilePath := fs.String("depfile", "", "Path to a depfile to write to")
+	jobs := fs.Int("j", 1, "Number of blobs to publish concurrently in -lp mode. With -v, the time taken by each package is reported.")
+	remote := fs.String("remote", "", "URL below which to upload the published repository, e.g. https://host:8083/upload")
+	remoteTokenFile := fs.String("remote-token-file", "", "Path to a file whose first token authenticates -remote uploads")
+	remoteJobs := fs.Int("remote-j", runtime.NumCPU(), "Number of parallel -remote uploads")
 
 	// NOTE(raggi): encryption as implemented is not intended to be a generally used
 	// feature, as such this flag is deliberately not included in the usage line
@@ -84,6 +90,25 @@ func Run(cfg *build.Config, args []string) error {
 
 	config.ApplyDefaults()
 
+	var remoteStorage *repo.HTTPStorage
+	if *remote != "" {
+		var token string
+		if *remoteTokenFile != "" {
+			tokens, err := pmhttp.LoadTokens(*remoteTokenFile)
+			if err != nil {
+				return err
+			}
+			if len(tokens) == 0 {
+				return fmt.Errorf("no token in %s", *remoteTokenFile)
+			}
+			token = tokens[0]
+		}
+		var err error
+		if remoteStorage, err = repo.NewHTTPStorage(*remote, token, *remoteJobs); err != nil {
+			return err
+		}
+	}
+
 	var numModes int
 	for _, v := range modeFlags {
 		if *v {
@@ -189,11 +214,28 @@ func Run(cfg *build.Config, args []string) error {
 			return err
 		}
 
-		pkgdeps, err := repo.PublishManifests(pkgManifestPaths)
-		if err != nil {
-			return err
+		if *jobs > 1 {
+			pkgdeps, timings, err := repo.PublishManifestsParallel(pkgManifestPaths, *jobs)
+			if err != nil {
+				return err
+			}
+			deps = append(deps, pkgdeps...)
+			if *verbose {
+				for _, timing := range timings {
+					if timing.Skipped {
+						fmt.Printf("%s: already published\n", timing.Name)
+					} else {
+						fmt.Printf("%s: %d blobs in %s\n", timing.Name, timing.Blobs, timing.Duration)
+					}
+				}
+			}
+		} else {
+			pkgdeps, err := repo.PublishManifests(pkgManifestPaths)
+			if err != nil {
+				return err
+			}
+			deps = append(deps, pkgdeps...)
 		}
-		deps = append(deps, pkgdeps...)
 
 		if *verbose {
 			fmt.Printf("committing updates\n")
@@ -202,58 +244,11 @@ func Run(cfg *build.Config, args []string) error {
 			log.Fatalf("error committing repository updates: %s", err)
 		}
 	case *archiveMode:
-		if len(filePaths) != 1 {
-			return fmt.Errorf("too many file paths supplied")
-		}
-
-		deps = append(deps, filePaths[0])
-		f, err := os.Open(filePaths[0])
-		if err != nil {
-			return fmt.Errorf("open %s: %s", filePaths[0], err)
-		}
-		defer f.Close()
-
-		ar, err := far.NewReader(f)
-		if err != nil {
-			return fmt.Errorf("open far %s: %s", f.Name(), err)
-		}
-
-		b, err := ar.ReadFile(metaFar)
-		if err != nil {
-			return fmt.Errorf("open %s from %s: %s", metaFar, f.Name(), err)
-		}
-
-		mf, err := far.NewReader(bytes.NewReader(b))
-		if err != nil {
-			return err
-		}
-		pb, err := mf.ReadFile("meta/package")
-		if err != nil {
-			return fmt.Errorf("open meta/package from %s from %s: %s", metaFar, f.Name(), err)
-		}
-		var p pkg.Package
-		if err := json.Unmarshal(pb, &p); err != nil {
-			return err
-		}
-
-		name := p.Name + "/" + p.Version
-
-		if *verbose {
-			fmt.Printf("adding package %s\n", name)
-		}
-		if err := repo.AddPackage(name, bytes.NewReader(b), ""); err != nil {
-			return err
-		}
-
-		for _, n := range ar.List() {
-			if len(n) != 64 {
-				continue
-			}
-			b, err := ar.ReadFile(n)
-			if err != nil {
-				return err
-			}
-			if _, _, err := repo.AddBlob(n, bytes.NewReader(b)); err != nil {
+		// Blobs are read from the archives as they are published, without
+		// unpacking the archives to disk first.
+		for _, path := range filePaths {
+			deps = append(deps, path)
+			if err := publishArchive(repo, path, *verbose); err != nil {
 				return err
 			}
 		}
@@ -309,6 +304,23 @@ func Run(cfg *build.Config, args []string) error {
 		panic("unhandled mode")
 	}
 
+	if *verbose {
+		stats := repo.Stats()
+		fmt.Printf("blobs written: %d (%d bytes), skipped: %d (%d bytes)\n",
+			stats.BlobsWritten, stats.BytesWritten, stats.BlobsSkipped, stats.BytesSkipped)
+	}
+
+	if remoteStorage != nil {
+		result, err := repo.Sync(context.Background(), remoteStorage, *remoteJobs)
+		if err != nil {
+			return fmt.Errorf("uploading to %s: %s", *remote, err)
+		}
+		if *verbose {
+			fmt.Printf("uploaded %d objects (%d bytes), %d already up to date\n",
+				result.Uploaded, result.UploadedBytes, result.Skipped)
+		}
+	}
+
 	if *depfilePath != "" {
 		timestampPath := filepath.Join(config.RepoDir, "repository", "timestamp.json")
 		for i, str := range deps {
@@ -343,6 +355,29 @@ func Run(cfg *build.Config, args []string) error {
 	return nil
 }
 
+// publishArchive publishes the package archive at path to r, closing the
+// archive before returning.
+func publishArchive(r *repo.Repo, path string, verbose bool) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("open %s: %s", path, err)
+	}
+	defer f.Close()
+
+	archive, err := build.NewPackageArchive(f)
+	if err != nil {
+		return fmt.Errorf("open package archive %s: %s", path, err)
+	}
+	if verbose {
+		p := archive.Package()
+		fmt.Printf("adding package %s/%s\n", p.Name, p.Version)
+	}
+	if err := r.PublishArchive(archive); err != nil {
+		return fmt.Errorf("publish %s: %s", path, err)
+	}
+	return nil
+}
+
 func eachEntry(path string, cb func(dest, src string) error) error {
 	f, err := os.Open(path)
 	if err != nil {
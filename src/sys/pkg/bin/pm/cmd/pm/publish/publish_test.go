@@ -65,6 +65,63 @@ func TestPublishArchive(t *testing.T) {
 	}
 }
 
+func TestPublishPackageArchives(t *testing.T) {
+	var archives []string
+	var blobs []string
+	for _, name := range []string{"a", "b"} {
+		cfg := build.TestConfig()
+		defer os.RemoveAll(filepath.Dir(cfg.TempDir))
+		cfg.PkgName = name
+		build.BuildTestPackage(cfg)
+		m, err := cfg.OutputManifest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, blob := range m.Blobs {
+			blobs = append(blobs, blob.Merkle.String())
+		}
+
+		archivePath := filepath.Join(t.TempDir(), name+".far")
+		f, err := os.Create(archivePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := build.WritePackageArchive(f, m); err != nil {
+			t.Fatal(err)
+		}
+		if err := f.Close(); err != nil {
+			t.Fatal(err)
+		}
+		archives = append(archives, "-f", archivePath)
+	}
+
+	cfg := build.TestConfig()
+	defer os.RemoveAll(filepath.Dir(cfg.TempDir))
+	repoDir := t.TempDir()
+	if err := Run(cfg, append([]string{"-repo", repoDir, "-a"}, archives...)); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := repo.New(repoDir, filepath.Join(repoDir, "repository", "blobs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	targets, err := r.Targets()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a/0", "b/0"} {
+		if _, ok := targets[name]; !ok {
+			t.Errorf("package %s not found in %v", name, targets)
+		}
+	}
+	for _, blob := range blobs {
+		if !r.HasBlob(blob) {
+			t.Errorf("blob %s was not published", blob)
+		}
+	}
+}
+
 func TestPublishListOfPackages(t *testing.T) {
 	cfg := build.TestConfig()
 	defer os.RemoveAll(filepath.Dir(cfg.TempDir))
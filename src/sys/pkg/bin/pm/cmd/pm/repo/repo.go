@@ -0,0 +1,256 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// Package repo contains the `pm repo` command
+package repo
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/build"
+	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/repo"
+)
+
+const usage = `Usage: %s repo <subcommand> [-help]
+
+Subcommands:
+    verify   - check the metadata and blobs of a local repository
+    refresh  - re-sign metadata of a local repository before it expires
+    list     - list the packages in a local repository
+    diff     - compare the packages of two repository states
+`
+
+const verifyUsage = `Usage: %s repo verify [-json] -repo <repository directory>
+check the signatures, expiration and consistency of the repository metadata,
+and that every target and package blob is present and intact
+`
+
+const refreshUsage = `Usage: %s repo refresh [-within <duration>] -repo <repository directory>
+re-sign the repository metadata that expires within the given duration, with
+the expiration configured when the repository was created, without changing
+the published targets
+`
+
+const listUsage = `Usage: %s repo list [-json] -repo <repository directory> [pattern...]
+list the packages in the repository whose names match any of the given glob
+patterns, or all packages if none are given
+`
+
+const diffUsage = `Usage: %s repo diff [-json] <old> <new>
+report the packages added, removed and updated between two repository states,
+and the size of the blobs only the new state references. Each state is either
+a repository directory or a targets metadata file inside its "repository"
+directory, e.g. an older "<version>.targets.json"
+`
+
+func Run(cfg *build.Config, args []string) error {
+	if len(args) == 0 {
+		fmt.Fprintf(os.Stderr, usage, filepath.Base(os.Args[0]))
+		return fmt.Errorf("missing subcommand")
+	}
+	switch args[0] {
+	case "verify":
+		return runVerify(args[1:])
+	case "refresh":
+		return runRefresh(args[1:])
+	case "list":
+		return runList(args[1:])
+	case "diff":
+		return runDiff(args[1:])
+	case "-h", "-help", "--help":
+		fmt.Fprintf(os.Stderr, usage, filepath.Base(os.Args[0]))
+		return nil
+	default:
+		fmt.Fprintf(os.Stderr, usage, filepath.Base(os.Args[0]))
+		return fmt.Errorf("unknown subcommand %q", args[0])
+	}
+}
+
+func runVerify(args []string) error {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+
+	config := &repo.Config{}
+	config.Vars(fs)
+	jsonOutput := fs.Bool("json", false, "Print the report as JSON.")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, verifyUsage, filepath.Base(os.Args[0]))
+		fmt.Fprintln(os.Stderr)
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if len(fs.Args()) != 0 {
+		fmt.Fprintf(os.Stderr, "WARNING: unused arguments: %s\n", fs.Args())
+	}
+	config.ApplyDefaults()
+
+	report, err := repo.VerifyRepository(config.RepoDir, time.Now())
+	if err != nil {
+		return err
+	}
+
+	if *jsonOutput {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			return err
+		}
+	} else {
+		for _, role := range report.Roles {
+			fmt.Printf("%-10s version %d, %d/%d keys, expires %s\n",
+				role.Role, role.Version, role.Threshold, role.Keys, role.Expires.Format(time.RFC3339))
+		}
+		fmt.Printf("%d targets, %d blobs, %d delegations\n", report.Targets, report.Blobs, report.Delegations)
+		for _, problem := range report.Problems {
+			fmt.Println(problem)
+		}
+	}
+
+	if !report.OK() {
+		return fmt.Errorf("repository has %d problems", len(report.Problems))
+	}
+	return nil
+}
+
+func runRefresh(args []string) error {
+	fs := flag.NewFlagSet("refresh", flag.ExitOnError)
+
+	config := &repo.Config{}
+	config.Vars(fs)
+	within := fs.Duration("within", 7*24*time.Hour, "Refresh the metadata that expires within this duration.")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, refreshUsage, filepath.Base(os.Args[0]))
+		fmt.Fprintln(os.Stderr)
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if len(fs.Args()) != 0 {
+		fmt.Fprintf(os.Stderr, "WARNING: unused arguments: %s\n", fs.Args())
+	}
+	config.ApplyDefaults()
+
+	if _, err := os.Stat(config.RepoDir); err != nil {
+		return fmt.Errorf("repository path %q is not valid: %s", config.RepoDir, err)
+	}
+	r, err := repo.New(config.RepoDir, filepath.Join(config.RepoDir, "repository", "blobs"))
+	if err != nil {
+		return err
+	}
+	refreshed, err := r.Refresh(time.Now().Add(*within), config.TimeVersioned)
+	if err != nil {
+		return err
+	}
+	if len(refreshed) == 0 {
+		fmt.Println("no metadata expires within", *within)
+		return nil
+	}
+	expirations, err := r.Expirations()
+	if err != nil {
+		return err
+	}
+	for _, role := range refreshed {
+		fmt.Printf("refreshed %s, expires %s\n", role, expirations[role].Format(time.RFC3339))
+	}
+	return nil
+}
+
+func runList(args []string) error {
+	fs := flag.NewFlagSet("list", flag.ExitOnError)
+
+	config := &repo.Config{}
+	config.Vars(fs)
+	jsonOutput := fs.Bool("json", false, "Print the packages as JSON.")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, listUsage, filepath.Base(os.Args[0]))
+		fmt.Fprintln(os.Stderr)
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	config.ApplyDefaults()
+
+	if _, err := os.Stat(config.RepoDir); err != nil {
+		return fmt.Errorf("repository path %q is not valid: %s", config.RepoDir, err)
+	}
+	r, err := repo.New(config.RepoDir, filepath.Join(config.RepoDir, "repository", "blobs"))
+	if err != nil {
+		return err
+	}
+	pkgs, err := r.ListPackages(fs.Args()...)
+	if err != nil {
+		return err
+	}
+
+	if *jsonOutput {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(pkgs)
+	}
+	for _, p := range pkgs {
+		published := "-"
+		if p.Published != nil {
+			published = p.Published.Format(time.RFC3339)
+		}
+		fmt.Printf("%s/%s\t%s\t%d\t%s\n", p.Name, p.Variant, p.Merkle, p.Size, published)
+	}
+	return nil
+}
+
+func runDiff(args []string) error {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+
+	jsonOutput := fs.Bool("json", false, "Print the differences as JSON.")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, diffUsage, filepath.Base(os.Args[0]))
+		fmt.Fprintln(os.Stderr)
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if len(fs.Args()) != 2 {
+		fs.Usage()
+		return fmt.Errorf("expected two repository states, got %d", len(fs.Args()))
+	}
+
+	diff, err := repo.DiffRepositories(fs.Arg(0), fs.Arg(1))
+	if err != nil {
+		return err
+	}
+
+	if *jsonOutput {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(diff)
+	}
+	for _, c := range diff.Added {
+		fmt.Printf("+ %s\t%s\t%d\n", c.Target, c.New, c.DeltaBytes)
+	}
+	for _, c := range diff.Removed {
+		fmt.Printf("- %s\t%s\n", c.Target, c.Old)
+	}
+	for _, c := range diff.Updated {
+		fmt.Printf("~ %s\t%s -> %s\t%d\n", c.Target, c.Old, c.New, c.DeltaBytes)
+	}
+	fmt.Printf("%d blobs added (%d bytes), %d blobs removed (%d bytes)\n",
+		diff.AddedBlobs, diff.AddedBlobBytes, diff.RemovedBlobs, diff.RemovedBlobBytes)
+	return nil
+}
@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
 	"sync"
 	"time"
 
@@ -29,6 +30,7 @@ type ManifestWatcher struct {
 	missing         MissingManifests
 	batch           *ManifestBatch
 	publishList     *string
+	publishDir      bool
 	quiet           *bool
 	runningRoutines sync.WaitGroup
 }
@@ -97,28 +99,46 @@ func (mw *ManifestWatcher) publishManifests(pkgManifestPaths []string) {
 
 func (mw *ManifestWatcher) publishManifestList() error {
 	mw.logV("[pm incremental] publishing %q", *mw.publishList)
-	f, err := os.Open(*mw.publishList)
+	pkgManifestPaths, err := mw.readManifestList()
 	if err != nil {
 		return fmt.Errorf("[pm incremental] cannot read list of package manifests %q: %s", *mw.publishList, err)
 	}
-	defer f.Close()
 
 	mw.missing.Lock()
 	mw.missing.m = make(map[string]bool)
 	mw.missing.Unlock()
 
+	mw.logV("[pm incremental] read from manifestList %d packages", len(pkgManifestPaths))
+	mw.publishManifests(pkgManifestPaths)
+	return nil
+}
+
+// readManifestList returns the package manifest paths listed in the publish
+// list file, or found in the publish directory.
+func (mw *ManifestWatcher) readManifestList() ([]string, error) {
+	if mw.publishDir {
+		return filepath.Glob(filepath.Join(*mw.publishList, "*.json"))
+	}
+
+	f, err := os.Open(*mw.publishList)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
 	pkgManifestPaths := make([]string, 0, 100)
 	s := bufio.NewScanner(f)
 	for s.Scan() {
 		m := s.Text()
 		pkgManifestPaths = append(pkgManifestPaths, m)
 	}
-	if err := s.Err(); err != nil {
-		return fmt.Errorf("[pm incremental] cannot read list of package manifests %q: %s", *mw.publishList, err)
-	}
-	mw.logV("[pm incremental] read from manifestList %d packages", len(pkgManifestPaths))
-	mw.publishManifests(pkgManifestPaths)
-	return nil
+	return pkgManifestPaths, s.Err()
+}
+
+// inPublishDir returns true if path is a package manifest directly inside the
+// watched publish directory.
+func (mw *ManifestWatcher) inPublishDir(path string) bool {
+	return mw.publishDir && filepath.Dir(path) == filepath.Clean(*mw.publishList) && filepath.Ext(path) == ".json"
 }
 
 func (mw *ManifestWatcher) processQueue() {
@@ -198,6 +218,9 @@ func (mw *ManifestWatcher) start() error {
 	if mw.watcher == nil {
 		return fmt.Errorf("Unexpected error, ManifestWatcher invalid state")
 	}
+	if fi, err := os.Stat(*mw.publishList); err == nil && fi.IsDir() {
+		mw.publishDir = true
+	}
 	if err := mw.watcher.Add(*mw.publishList); err != nil {
 		return fmt.Errorf("failed to watch %s: %s", *mw.publishList, err)
 	}
@@ -220,6 +243,15 @@ func (mw *ManifestWatcher) start() error {
 					log.Printf("[pm incremental] WARNING: error while publishing list of manifests: %s", err)
 				}
 			default:
+				if mw.inPublishDir(event.Name) {
+					if event.Op&(fswatch.Create|fswatch.Write) != 0 {
+						mw.logV("[pm incremental] manifest %s added to %s", event.Name, *mw.publishList)
+						mw.enqueue(event.Name)
+					}
+					// Manifests removed from the directory are no longer
+					// watched, but remain published.
+					continue
+				}
 				if event.Op == fswatch.Remove {
 					mw.logV("[pm incremental] manifest %q removed, adding to polling watcher", event.Name)
 					mw.missing.Lock()
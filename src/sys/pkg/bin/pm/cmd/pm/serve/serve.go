@@ -6,6 +6,7 @@ package serve
 
 import (
 	"compress/gzip"
+	"crypto/tls"
 	"flag"
 	"fmt"
 	"io/ioutil"
@@ -14,7 +15,6 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
-	"strings"
 	"sync"
 	"time"
 
@@ -34,10 +34,26 @@ var (
 	auto          = fs.Bool("a", true, "Host auto endpoint for realtime client updates")
 	quiet         = fs.Bool("q", false, "Don't print out information about requests")
 	encryptionKey = fs.String("e", "", "Path to a symmetric blob encryption key *UNSAFE*")
-	publishList   = fs.String("p", "", "path to a package list file to be auto-published")
+	publishList   = fs.String("p", "", "path to a package list file, or a directory of package manifests, to be auto-published")
 	portFile      = fs.String("f", "", "path to a file to write the HTTP listen port")
 	configVersion = fs.Int("c", 1, "component framework version for config.json")
 	persist       = fs.Bool("persist", false, "request clients to persist TUF metadata for this repository (supported only with `-c 2`)")
+	tlsCert       = fs.String("tls-cert", "", "path to a PEM encoded TLS certificate; serve HTTPS instead of HTTP (requires -tls-key)")
+	tlsKey        = fs.String("tls-key", "", "path to the PEM encoded private key for -tls-cert")
+	authToken     = fs.String("auth-token", "", "bearer token required for mutating requests")
+	authTokenFile = fs.String("auth-token-file", "", "path to a file of bearer tokens, one per line, accepted like -auth-token")
+	authBlobs     = fs.Bool("auth-blobs", false, "also require a bearer token to fetch blobs")
+	connRate      = fs.Int64("conn-rate-limit", 0, "maximum bytes per second sent over each client connection (unlimited if 0)")
+	totalRate     = fs.Int64("rate-limit", 0, "maximum bytes per second sent to all clients together (unlimited if 0)")
+	maxDownloads  = fs.Int("max-blob-downloads", 0, "maximum number of blobs sent at the same time; further blob requests wait (unlimited if 0)")
+	uploads       = fs.Bool("upload", false, "accept uploads from remote publishers below /upload/ (requires -auth-token or -auth-token-file)")
+	deliveryCache = fs.String("delivery-blob-cache", "", "directory caching the delivery blobs converted on the fly for /blobs/1/ (default $repo/delivery-blob-cache)")
+	refreshEvery  = fs.Duration("refresh-interval", 0, "how often to check for repository metadata about to expire and re-sign it (disabled if 0)")
+	refreshWithin = fs.Duration("refresh-within", 24*time.Hour, "with -refresh-interval, re-sign metadata that expires within this duration")
+	accessLogPath = fs.String("access-log", "", "path to write a JSON lines access log to, or - for stdout")
+	accessLogSize = fs.Int64("access-log-max-size", 100<<20, "size in bytes beyond which the -access-log file is rotated (never if 0)")
+	accessLogKeep = fs.Int("access-log-backups", 5, "number of rotated -access-log files to keep")
+	tlsSelfSigned = fs.Bool("tls-self-signed", false, "serve HTTPS with a generated self-signed certificate, printing its SHA-256 fingerprint")
 	config        = &repo.Config{}
 	initOnce      sync.Once
 )
@@ -91,6 +107,40 @@ func Run(cfg *build.Config, args []string, addrChan chan string) error {
 
 	mux := http.NewServeMux()
 
+	// repoMu serializes auto-publishing with reads of the repository metadata.
+	var repoMu sync.Mutex
+	metrics := pmhttp.NewMetrics(func() (map[string]string, error) {
+		repoMu.Lock()
+		defer repoMu.Unlock()
+		return repo.PackageMerkles()
+	})
+	mux.Handle("/metrics", metrics)
+	mux.Handle("/stats", metrics.StatsHandler())
+
+	if *refreshEvery > 0 {
+		stopRefresh := make(chan struct{})
+		defer close(stopRefresh)
+		go func() {
+			ticker := time.NewTicker(*refreshEvery)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+				case <-stopRefresh:
+					return
+				}
+				repoMu.Lock()
+				refreshed, err := repo.Refresh(time.Now().Add(*refreshWithin), config.TimeVersioned)
+				repoMu.Unlock()
+				if err != nil {
+					log.Printf("[pm serve] refreshing metadata: %s", err)
+				} else if len(refreshed) != 0 && !*quiet {
+					log.Printf("[pm serve] refreshed metadata of %v", refreshed)
+				}
+			}
+		}()
+	}
+
 	if *auto {
 		as := pmhttp.NewAutoServer()
 
@@ -151,6 +201,8 @@ func Run(cfg *build.Config, args []string, addrChan chan string) error {
 			go func() {
 				defer wg.Done()
 				for manifests := range mw.PublishEvents {
+					start := time.Now()
+					repoMu.Lock()
 					_, err = repo.PublishManifests(manifests)
 					if err != nil {
 						log.Fatalf("[pm auto] unable to publish manifests %v: %s", manifests, err)
@@ -158,6 +210,8 @@ func Run(cfg *build.Config, args []string, addrChan chan string) error {
 					if err := repo.CommitUpdates(config.TimeVersioned); err != nil {
 						log.Fatalf("[pm auto] committing repo: %s", err)
 					}
+					repoMu.Unlock()
+					metrics.RecordPublish(time.Since(start))
 				}
 			}()
 			if err := mw.start(); err != nil {
@@ -166,6 +220,30 @@ func Run(cfg *build.Config, args []string, addrChan chan string) error {
 		}
 	}
 
+	// Encrypted blobs cannot be converted, so only delivery blobs already in
+	// the repository are served for them.
+	if *encryptionKey == "" {
+		cacheDir := *deliveryCache
+		if cacheDir == "" {
+			cacheDir = filepath.Join(config.RepoDir, "delivery-blob-cache")
+		}
+		mux.Handle(pmhttp.DeliveryBlobPrefix, &pmhttp.DeliveryBlobServer{
+			BlobsDir: filepath.Join(*repoServeDir, "blobs"),
+			CacheDir: cacheDir,
+		})
+	}
+
+	mux.Handle(pmhttp.BlobPresencePath, &pmhttp.BlobPresenceServer{
+		BlobsDir: filepath.Join(*repoServeDir, "blobs"),
+	})
+
+	if *uploads {
+		if *authToken == "" && *authTokenFile == "" {
+			return fmt.Errorf("-upload requires -auth-token or -auth-token-file")
+		}
+		mux.Handle(pmhttp.UploadPrefix, &pmhttp.UploadServer{Dir: *repoServeDir})
+	}
+
 	dirServer := http.FileServer(http.Dir(*repoServeDir))
 	mux.Handle("/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		switch r.URL.Path {
@@ -201,8 +279,46 @@ func Run(cfg *build.Config, args []string, addrChan chan string) error {
 		return fmt.Errorf("[pm auto] invalid component version specified: %v", *configVersion)
 	}
 
+	var handler http.Handler = mux
+	if *connRate < 0 || *totalRate < 0 || *maxDownloads < 0 {
+		return fmt.Errorf("-conn-rate-limit, -rate-limit and -max-blob-downloads must not be negative")
+	}
+	if *connRate > 0 || *totalRate > 0 || *maxDownloads > 0 {
+		handler = pmhttp.NewDownloadLimiter(pmhttp.DownloadLimits{
+			ConnectionRate:   *connRate,
+			TotalRate:        *totalRate,
+			MaxBlobDownloads: *maxDownloads,
+		}).Wrap(handler)
+	}
+	if *authToken != "" || *authTokenFile != "" {
+		tokens, err := loadAuthTokens()
+		if err != nil {
+			return err
+		}
+		auth := pmhttp.NewTokenAuth(tokens)
+		auth.ProtectBlobs = *authBlobs
+		handler = auth.Wrap(handler)
+	} else if *authBlobs {
+		return fmt.Errorf("-auth-blobs requires -auth-token or -auth-token-file")
+	}
+
+	var accessLog *pmhttp.AccessLog
+	switch *accessLogPath {
+	case "":
+	case "-":
+		accessLog = pmhttp.NewAccessLog(os.Stdout)
+	default:
+		f, err := pmhttp.OpenRotatingFile(*accessLogPath, *accessLogSize, *accessLogKeep)
+		if err != nil {
+			return fmt.Errorf("opening access log: %s", err)
+		}
+		defer f.Close()
+		accessLog = pmhttp.NewAccessLog(f)
+	}
+
 	server.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if !strings.HasPrefix(r.RequestURI, "/blobs") && strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+		start := time.Now()
+		if pmhttp.ShouldGZIP(r) {
 			gw := &pmhttp.GZIPWriter{
 				w,
 				gzip.NewWriter(w),
@@ -212,7 +328,13 @@ func Run(cfg *build.Config, args []string, addrChan chan string) error {
 			w = gw
 		}
 		lw := &pmhttp.LoggingWriter{w, 0, 0}
-		mux.ServeHTTP(lw, r)
+		handler.ServeHTTP(lw, r)
+		metrics.RecordRequest(r, lw.Status, lw.ResponseSize)
+		if accessLog != nil {
+			if err := accessLog.Log(r, start, lw.Status, lw.ResponseSize); err != nil {
+				log.Printf("writing access log: %s", err)
+			}
+		}
 		if !*quiet {
 			fmt.Printf("%s [pm serve] %s \"%s %s %s\" %d %d\n",
 				time.Now().Format("2006-01-02 15:04:05"),
@@ -225,10 +347,20 @@ func Run(cfg *build.Config, args []string, addrChan chan string) error {
 		}
 	})
 
+	tlsConfig, err := loadTLSConfig()
+	if err != nil {
+		return err
+	}
+
 	listener, err := net.Listen("tcp", *listen)
 	if err != nil {
 		return err
 	}
+	scheme := "http"
+	if tlsConfig != nil {
+		listener = tls.NewListener(listener, tlsConfig)
+		scheme = "https"
+	}
 
 	addr := listener.Addr().String()
 	if addrChan != nil {
@@ -250,9 +382,69 @@ func Run(cfg *build.Config, args []string, addrChan chan string) error {
 	}
 
 	if !*quiet {
-		fmt.Printf("%s [pm serve] serving %s at http://%s\n",
-			time.Now().Format("2006-01-02 15:04:05"), config.RepoDir, addr)
+		fmt.Printf("%s [pm serve] serving %s at %s://%s\n",
+			time.Now().Format("2006-01-02 15:04:05"), config.RepoDir, scheme, addr)
 	}
 
 	return server.Serve(listener)
 }
+
+// loadAuthTokens returns the bearer tokens given by -auth-token and
+// -auth-token-file.
+func loadAuthTokens() ([]string, error) {
+	var tokens []string
+	if *authToken != "" {
+		tokens = append(tokens, *authToken)
+	}
+	if *authTokenFile != "" {
+		fileTokens, err := pmhttp.LoadTokens(*authTokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading auth tokens: %s", err)
+		}
+		if len(fileTokens) == 0 {
+			return nil, fmt.Errorf("auth token file %q contains no tokens", *authTokenFile)
+		}
+		tokens = append(tokens, fileTokens...)
+	}
+	return tokens, nil
+}
+
+// loadTLSConfig returns the TLS configuration requested by the -tls-* flags, or
+// nil if the server should use plain HTTP.
+func loadTLSConfig() (*tls.Config, error) {
+	if *tlsSelfSigned {
+		if *tlsCert != "" || *tlsKey != "" {
+			return nil, fmt.Errorf("-tls-self-signed cannot be combined with -tls-cert or -tls-key")
+		}
+		host, _, err := net.SplitHostPort(*listen)
+		if err != nil {
+			return nil, fmt.Errorf("parsing listen address %q: %s", *listen, err)
+		}
+		hosts := []string{"localhost", "127.0.0.1", "::1"}
+		if host != "" {
+			hosts = append(hosts, host)
+		}
+		cert, err := pmhttp.GenerateSelfSignedCert(hosts)
+		if err != nil {
+			return nil, fmt.Errorf("generating self-signed certificate: %s", err)
+		}
+		fingerprint, err := pmhttp.CertFingerprint(cert)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Printf("[pm serve] self-signed certificate SHA-256 fingerprint: %s\n", fingerprint)
+		return &tls.Config{Certificates: []tls.Certificate{cert}, NextProtos: []string{"h2", "http/1.1"}}, nil
+	}
+
+	if *tlsCert == "" && *tlsKey == "" {
+		return nil, nil
+	}
+	if *tlsCert == "" || *tlsKey == "" {
+		return nil, fmt.Errorf("-tls-cert and -tls-key must be given together")
+	}
+	cert, err := tls.LoadX509KeyPair(*tlsCert, *tlsKey)
+	if err != nil {
+		return nil, fmt.Errorf("loading TLS certificate: %s", err)
+	}
+	return &tls.Config{Certificates: []tls.Certificate{cert}, NextProtos: []string{"h2", "http/1.1"}}, nil
+}
@@ -13,6 +13,7 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -253,6 +254,150 @@ func TestServer(t *testing.T) {
 		}
 	})
 
+	t.Run("reports blob presence", func(t *testing.T) {
+		m, err := cfg.OutputManifest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		blob := m.Blobs[0]
+
+		res, err := http.Head(baseURL + "/blobs/" + blob.Merkle.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusOK || res.ContentLength != int64(blob.Size) {
+			t.Errorf("HEAD blob: got status %d and length %d, want 200 and %d", res.StatusCode, res.ContentLength, blob.Size)
+		}
+
+		missing := strings.Repeat("0", 64)
+		body, err := json.Marshal(pmhttp.BlobPresenceRequest{Blobs: []string{blob.Merkle.String(), missing}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, err = http.Post(baseURL+pmhttp.BlobPresencePath, "application/json", bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		var presence pmhttp.BlobPresenceResponse
+		if err := json.NewDecoder(res.Body).Decode(&presence); err != nil {
+			t.Fatal(err)
+		}
+		if len(presence.Present) != 1 || presence.Present[0] != blob.Merkle.String() ||
+			len(presence.Missing) != 1 || presence.Missing[0] != missing {
+			t.Errorf("got %+v, want %s present and %s missing", presence, blob.Merkle, missing)
+		}
+	})
+
+	t.Run("serves delivery blobs", func(t *testing.T) {
+		m, err := cfg.OutputManifest()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, blob := range m.Blobs {
+			res, err := http.Get(baseURL + pmhttp.DeliveryBlobPrefix + blob.Merkle.String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			res.Body.Close()
+			if res.StatusCode != http.StatusOK {
+				t.Errorf("delivery blob %s: got status %d", blob.Merkle, res.StatusCode)
+			}
+			if got, want := res.ContentLength, int64(blob.Size)+build.DeliveryBlobType1HeaderLength; got != want {
+				t.Errorf("delivery blob length: got %d, want %d", got, want)
+			}
+		}
+		if _, err := os.Stat(filepath.Join(repoDir, "delivery-blob-cache", m.Blobs[0].Merkle.String())); err != nil {
+			t.Errorf("delivery blob was not cached: %s", err)
+		}
+	})
+
+	t.Run("serves stats", func(t *testing.T) {
+		res, err := http.Get(baseURL + "/stats")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+
+		var stats pmhttp.Stats
+		if err := json.NewDecoder(res.Body).Decode(&stats); err != nil {
+			t.Fatal(err)
+		}
+		// The package blobs were all fetched above, including the meta.far.
+		if got := stats.PackageResolves["testpackage/0"]; got == 0 {
+			t.Errorf("got no resolves of testpackage/0 in %+v", stats)
+		}
+		if stats.Publishes == 0 {
+			t.Errorf("got no publishes in %+v", stats)
+		}
+	})
+
+	t.Run("serves byte ranges", func(t *testing.T) {
+		m, err := cfg.OutputManifest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		blob := m.Blobs[0]
+		blobContent, err := ioutil.ReadFile(blob.SourcePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		targetsContent, err := ioutil.ReadFile(filepath.Join(repoDir, "repository", "targets.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, tc := range []struct {
+			path, rangeHeader, contentRange string
+			want                            []byte
+		}{
+			{
+				path:         "/blobs/" + blob.Merkle.String(),
+				rangeHeader:  "bytes=2-",
+				contentRange: fmt.Sprintf("bytes 2-%d/%d", len(blobContent)-1, len(blobContent)),
+				want:         blobContent[2:],
+			},
+			{
+				path:         "/targets.json",
+				rangeHeader:  "bytes=-5",
+				contentRange: fmt.Sprintf("bytes %d-%d/%d", len(targetsContent)-5, len(targetsContent)-1, len(targetsContent)),
+				want:         targetsContent[len(targetsContent)-5:],
+			},
+		} {
+			req, err := http.NewRequest("GET", baseURL+tc.path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Range", tc.rangeHeader)
+			// Ask for gzip explicitly, which must not apply to a partial response.
+			req.Header.Set("Accept-Encoding", "gzip")
+			res, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := ioutil.ReadAll(res.Body)
+			res.Body.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.StatusCode != http.StatusPartialContent {
+				t.Errorf("GET %s: got %d, want %d", tc.path, res.StatusCode, http.StatusPartialContent)
+				continue
+			}
+			if got := res.Header.Get("Content-Encoding"); got != "" {
+				t.Errorf("GET %s: got content-encoding %q, want none", tc.path, got)
+			}
+			if got := res.Header.Get("Content-Range"); got != tc.contentRange {
+				t.Errorf("GET %s: got content-range %q, want %q", tc.path, got, tc.contentRange)
+			}
+			if !bytes.Equal(got, tc.want) {
+				t.Errorf("GET %s: got %q, want %q", tc.path, got, tc.want)
+			}
+		}
+	})
+
 	t.Run("auto-publishes new package version", func(t *testing.T) {
 		build.BuildTestPackage(cfg)
 
@@ -612,6 +757,83 @@ func TestServeAutoIncremental(t *testing.T) {
 	})
 }
 
+func TestServeAutoIncrementalDir(t *testing.T) {
+	defer resetFlags()
+	defer resetServer()
+	defer pushPopMonitorPollInterval(20 * time.Millisecond)()
+	cfg := build.TestConfig()
+	defer os.RemoveAll(filepath.Dir(cfg.TempDir))
+
+	repoDir := t.TempDir()
+	manifestDir := t.TempDir()
+
+	repo, err := repo.New(repoDir, filepath.Join(repoDir, "repository", "blobs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.AddTargets([]string{}, json.RawMessage{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.CommitUpdates(false); err != nil {
+		t.Fatal(err)
+	}
+
+	addrChan := make(chan string)
+	var w sync.WaitGroup
+	w.Add(1)
+	go func() {
+		defer w.Done()
+		err := Run(cfg, []string{"-l", "127.0.0.1:0", "-repo", repoDir, "-p", manifestDir}, addrChan)
+		if err != nil && err != http.ErrServerClosed {
+			t.Error(err)
+		}
+	}()
+	defer func() {
+		server.Close()
+		w.Wait()
+	}()
+	addr := <-addrChan
+	baseURL := fmt.Sprintf("http://%s", addr)
+
+	t.Run("auto-publishes manifests added to the directory", func(t *testing.T) {
+		if hasTarget(t, baseURL, "testpackage/0") {
+			t.Fatalf("prematurely found target package")
+		}
+
+		cli := newTestAutoClient(t, baseURL)
+		defer cli.close()
+
+		cli.verifyNoPendingEvents()
+
+		build.BuildTestPackage(cfg)
+		m, err := cfg.OutputManifest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Write the manifest elsewhere first, so it appears in the directory
+		// complete.
+		tmpPath := filepath.Join(t.TempDir(), "testpackage.json")
+		if err := build.WritePackageManifest(m, tmpPath, false); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Rename(tmpPath, filepath.Join(manifestDir, "testpackage.json")); err != nil {
+			t.Fatal(err)
+		}
+
+		event := cli.readEvent()
+		if got, want := event.Event, "timestamp.json"; got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+
+		if !hasTarget(t, baseURL, "testpackage/0") {
+			t.Fatal("missing target package")
+		}
+	})
+}
+
 func hasTarget(t *testing.T, baseURL, target string) bool {
 	res, err := http.Get(baseURL + "/targets.json")
 	if err != nil {
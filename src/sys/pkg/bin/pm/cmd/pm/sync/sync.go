@@ -0,0 +1,102 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// Package sync contains the `pm sync` command
+package sync
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/build"
+	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/pmhttp"
+	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/repo"
+)
+
+const usage = `Usage: %s sync -repo <repository directory> -dst <gs://bucket/prefix | s3://bucket/prefix | https://host/upload | directory>
+upload a local repository to cloud storage, a remote repository served by
+"pm serve -upload", or another directory
+
+S3 credentials and the region are taken from the AWS_ACCESS_KEY_ID,
+AWS_SECRET_ACCESS_KEY, AWS_SESSION_TOKEN and AWS_REGION environment variables.
+`
+
+func Run(cfg *build.Config, args []string) error {
+	fs := flag.NewFlagSet("sync", flag.ExitOnError)
+
+	config := &repo.Config{}
+	config.Vars(fs)
+	dst := fs.String("dst", "", "Destination to sync the repository to, a gs://bucket[/prefix] or s3://bucket[/prefix] URL, an http(s) upload URL or a local directory")
+	blobsDir := fs.String("blobs", "", "Directory of the repository's blobs, if not <repo>/repository/blobs")
+	tokenFile := fs.String("token-file", "", "Path to a file whose first token authenticates uploads to an http(s) destination")
+	jobs := fs.Int("j", runtime.NumCPU(), "Number of parallel uploads")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, usage, filepath.Base(os.Args[0]))
+		fmt.Fprintln(os.Stderr)
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if len(fs.Args()) != 0 {
+		fmt.Fprintf(os.Stderr, "WARNING: unused arguments: %s\n", fs.Args())
+	}
+	config.ApplyDefaults()
+
+	if *dst == "" {
+		return fmt.Errorf("no destination supplied")
+	}
+	if _, err := os.Stat(config.RepoDir); err != nil {
+		return fmt.Errorf("repository path %q is not valid: %s", config.RepoDir, err)
+	}
+	if *blobsDir == "" {
+		*blobsDir = filepath.Join(config.RepoDir, "repository", "blobs")
+	}
+	r, err := repo.New(config.RepoDir, *blobsDir)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	var storage repo.Storage
+	switch {
+	case strings.HasPrefix(*dst, "gs://"):
+		if storage, err = repo.NewGCSStorage(ctx, *dst); err != nil {
+			return err
+		}
+	case strings.HasPrefix(*dst, "s3://"):
+		if storage, err = repo.NewS3Storage(*dst, *jobs); err != nil {
+			return err
+		}
+	case strings.HasPrefix(*dst, "http://"), strings.HasPrefix(*dst, "https://"):
+		var token string
+		if *tokenFile != "" {
+			tokens, err := pmhttp.LoadTokens(*tokenFile)
+			if err != nil {
+				return err
+			}
+			if len(tokens) == 0 {
+				return fmt.Errorf("no token in %s", *tokenFile)
+			}
+			token = tokens[0]
+		}
+		if storage, err = repo.NewHTTPStorage(*dst, token, *jobs); err != nil {
+			return err
+		}
+	default:
+		storage = &repo.DirStorage{Root: *dst}
+	}
+
+	result, err := r.Sync(ctx, storage, *jobs)
+	fmt.Printf("uploaded %d objects (%d bytes), %d already up to date\n",
+		result.Uploaded, result.UploadedBytes, result.Skipped)
+	return err
+}
@@ -14,13 +14,15 @@ import (
 	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/build"
 )
 
-const usage = `Usage: %s verify
-ensure that the package metadata appears valid
+const usage = `Usage: %s verify [-blobs <directory>]
+ensure that the package metadata appears valid, and with -blobs, that the
+blobs listed in the sealed meta.far match those in the directory
 `
 
 // Run ensures that the package metadata appears valid
 func Run(cfg *build.Config, args []string) error {
 	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	blobsDir := fs.String("blobs", "", "Directory of blobs named by merkle root to check against the meta/contents of the sealed meta.far")
 
 	fs.Usage = func() {
 		fmt.Fprintf(os.Stderr, usage, filepath.Base(os.Args[0]))
@@ -36,5 +38,11 @@ func Run(cfg *build.Config, args []string) error {
 		fmt.Fprintf(os.Stderr, "WARNING: unused arguments: %s\n", fs.Args())
 	}
 
-	return build.Validate(cfg)
+	if err := build.Validate(cfg); err != nil {
+		return err
+	}
+	if *blobsDir != "" {
+		return build.VerifyMetaFARBlobs(cfg.MetaFAR(), *blobsDir)
+	}
+	return nil
 }
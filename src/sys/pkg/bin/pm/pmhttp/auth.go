@@ -0,0 +1,88 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package pmhttp
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// TokenAuth requires requests to carry one of a set of bearer tokens in their
+// Authorization header. Requests that may mutate server state always require
+// a token; blob fetches only do if ProtectBlobs is set.
+type TokenAuth struct {
+	tokens       []string
+	ProtectBlobs bool
+}
+
+// NewTokenAuth returns a TokenAuth accepting any of the given tokens.
+func NewTokenAuth(tokens []string) *TokenAuth {
+	return &TokenAuth{tokens: tokens}
+}
+
+// LoadTokens reads bearer tokens from the file at path, one per line. Blank
+// lines and lines starting with '#' are ignored.
+func LoadTokens(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var tokens []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		tokens = append(tokens, line)
+	}
+	return tokens, scanner.Err()
+}
+
+// Wrap returns a handler that rejects unauthorized requests with 401, and
+// passes all others to h.
+func (a *TokenAuth) Wrap(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if a.requiresToken(r) && !a.authorized(r) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="pm"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+func (a *TokenAuth) requiresToken(r *http.Request) bool {
+	switch {
+	case r.Method == http.MethodGet, r.Method == http.MethodHead, r.Method == http.MethodOptions:
+	// Blob presence requests only read the repository.
+	case r.Method == http.MethodPost && r.URL.Path == BlobPresencePath:
+	default:
+		return true
+	}
+	return a.ProtectBlobs && strings.HasPrefix(r.URL.Path, "/blobs")
+}
+
+func (a *TokenAuth) authorized(r *http.Request) bool {
+	const prefix = "Bearer "
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, prefix) {
+		return false
+	}
+	got := []byte(strings.TrimPrefix(header, prefix))
+	ok := false
+	for _, token := range a.tokens {
+		// Check every token, so the time taken does not reveal which matched.
+		if subtle.ConstantTimeCompare(got, []byte(token)) == 1 {
+			ok = true
+		}
+	}
+	return ok
+}
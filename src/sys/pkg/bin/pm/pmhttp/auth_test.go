@@ -0,0 +1,67 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package pmhttp
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestTokenAuth(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	for _, tc := range []struct {
+		name          string
+		protectBlobs  bool
+		method, path  string
+		authorization string
+		want          int
+	}{
+		{"metadata without token", false, "GET", "/targets.json", "", http.StatusOK},
+		{"blob without token", false, "GET", "/blobs/0123", "", http.StatusOK},
+		{"post without token", false, "POST", "/", "", http.StatusUnauthorized},
+		{"post with wrong token", false, "POST", "/", "Bearer nope", http.StatusUnauthorized},
+		{"post with token", false, "POST", "/", "Bearer second", http.StatusOK},
+		{"protected blob without token", true, "GET", "/blobs/0123", "", http.StatusUnauthorized},
+		{"protected blob with basic auth", true, "GET", "/blobs/0123", "Basic first", http.StatusUnauthorized},
+		{"protected blob with token", true, "GET", "/blobs/0123", "Bearer first", http.StatusOK},
+		{"metadata with protected blobs", true, "GET", "/targets.json", "", http.StatusOK},
+		{"blob presence without token", false, "POST", BlobPresencePath, "", http.StatusOK},
+		{"protected blob presence without token", true, "POST", BlobPresencePath, "", http.StatusUnauthorized},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			auth := NewTokenAuth([]string{"first", "second"})
+			auth.ProtectBlobs = tc.protectBlobs
+			r := httptest.NewRequest(tc.method, tc.path, nil)
+			if tc.authorization != "" {
+				r.Header.Set("Authorization", tc.authorization)
+			}
+			w := httptest.NewRecorder()
+			auth.Wrap(ok).ServeHTTP(w, r)
+			if w.Code != tc.want {
+				t.Errorf("got status %d, want %d", w.Code, tc.want)
+			}
+		})
+	}
+}
+
+func TestLoadTokens(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens")
+	if err := ioutil.WriteFile(path, []byte("# dev tokens\nfirst\n\n  second  \n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	got, err := LoadTokens(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"first", "second"}, got); diff != "" {
+		t.Errorf("tokens (-want +got):\n%s", diff)
+	}
+}
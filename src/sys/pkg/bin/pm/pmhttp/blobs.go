@@ -0,0 +1,71 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package pmhttp
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// BlobPresencePath is the path of the endpoint that reports which of a list of
+// blobs a repository has.
+const BlobPresencePath = "/blobs/present"
+
+// maxBlobPresenceRequest bounds the size of a blob presence request body, which
+// is enough for tens of thousands of merkle roots.
+const maxBlobPresenceRequest = 4 << 20
+
+// BlobPresenceRequest is the body of a POST to BlobPresencePath.
+type BlobPresenceRequest struct {
+	Blobs []string `json:"blobs"`
+}
+
+// BlobPresenceResponse is the response to a BlobPresenceRequest. Every
+// requested blob is listed in either Present or Missing, in the order of the
+// request.
+type BlobPresenceResponse struct {
+	Present []string `json:"present"`
+	Missing []string `json:"missing"`
+}
+
+// BlobPresenceServer answers blob presence requests for the blobs in BlobsDir,
+// so clients can find out which blobs they need to fetch, or upload, with a
+// single request.
+type BlobPresenceServer struct {
+	BlobsDir string
+}
+
+func (b *BlobPresenceServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req BlobPresenceRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBlobPresenceRequest)).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("invalid request: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	resp := BlobPresenceResponse{Present: []string{}, Missing: []string{}}
+	for _, merkle := range req.Blobs {
+		if d, err := hex.DecodeString(merkle); err != nil || len(d) != 32 {
+			http.Error(w, fmt.Sprintf("invalid merkle root %q", merkle), http.StatusBadRequest)
+			return
+		}
+		if fi, err := os.Stat(filepath.Join(b.BlobsDir, merkle)); err == nil && fi.Mode().IsRegular() {
+			resp.Present = append(resp.Present, merkle)
+		} else {
+			resp.Missing = append(resp.Missing, merkle)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,59 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package pmhttp
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestBlobPresenceServer(t *testing.T) {
+	dir := t.TempDir()
+	present := strings.Repeat("a", 64)
+	missing := strings.Repeat("b", 64)
+	if err := ioutil.WriteFile(filepath.Join(dir, present), []byte("blob"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	b := &BlobPresenceServer{BlobsDir: dir}
+
+	post := func(method, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		b.ServeHTTP(w, httptest.NewRequest(method, BlobPresencePath, strings.NewReader(body)))
+		return w
+	}
+
+	w := post("POST", `{"blobs": ["`+missing+`", "`+present+`"]}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", w.Code, w.Body.String())
+	}
+	var got BlobPresenceResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	want := BlobPresenceResponse{Present: []string{present}, Missing: []string{missing}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("response (-want +got):\n%s", diff)
+	}
+
+	for _, tc := range []struct {
+		method, body string
+		want         int
+	}{
+		{"GET", "", http.StatusMethodNotAllowed},
+		{"POST", "not json", http.StatusBadRequest},
+		{"POST", `{"blobs": ["../` + present + `"]}`, http.StatusBadRequest},
+	} {
+		if w := post(tc.method, tc.body); w.Code != tc.want {
+			t.Errorf("%s %q: got status %d, want %d", tc.method, tc.body, w.Code, tc.want)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package pmhttp
+
+import (
+	"encoding/hex"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/build"
+)
+
+// DeliveryBlobPrefix is the path below which type 1 delivery blobs are served.
+const DeliveryBlobPrefix = "/blobs/1/"
+
+// DeliveryBlobServer serves the type 1 delivery blobs of the blobs in a
+// repository at DeliveryBlobPrefix + merkle. Delivery blobs already present in
+// the repository, in the "1" subdirectory of BlobsDir, are served as they are.
+// The others are converted from the uncompressed blobs in BlobsDir when first
+// requested, and kept in CacheDir for later requests.
+type DeliveryBlobServer struct {
+	BlobsDir string
+	CacheDir string
+}
+
+func (d *DeliveryBlobServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	merkle := strings.TrimPrefix(r.URL.Path, DeliveryBlobPrefix)
+	if b, err := hex.DecodeString(merkle); err != nil || len(b) != 32 || merkle != strings.ToLower(merkle) {
+		http.NotFound(w, r)
+		return
+	}
+
+	path := filepath.Join(d.BlobsDir, "1", merkle)
+	if _, err := os.Stat(path); err != nil {
+		path, err = d.convert(merkle)
+		if os.IsNotExist(err) {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			log.Printf("converting delivery blob %s: %s", merkle, err)
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+	http.ServeFile(w, r, path)
+}
+
+// convert writes the delivery blob of the given blob to the cache, unless it
+// is already there, and returns its path.
+func (d *DeliveryBlobServer) convert(merkle string) (string, error) {
+	path := filepath.Join(d.CacheDir, merkle)
+	if _, err := os.Stat(path); err == nil {
+		return path, nil
+	}
+
+	src, err := os.Open(filepath.Join(d.BlobsDir, merkle))
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+	fi, err := src.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(d.CacheDir, os.ModePerm); err != nil {
+		return "", err
+	}
+	// Concurrent conversions of the same blob each write their own temporary
+	// file, and the last one to finish replaces the others' identical output.
+	f, err := ioutil.TempFile(d.CacheDir, merkle)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(f.Name())
+	err = build.WriteDeliveryBlobType1(f, src, uint64(fi.Size()))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", err
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
@@ -0,0 +1,64 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package pmhttp
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/build"
+)
+
+func TestDeliveryBlobServer(t *testing.T) {
+	blobsDir := t.TempDir()
+	converted := strings.Repeat("a", 64)
+	prebuilt := strings.Repeat("b", 64)
+	if err := ioutil.WriteFile(filepath.Join(blobsDir, converted), []byte("blob content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(blobsDir, "1"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(blobsDir, "1", prebuilt), []byte("prebuilt"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	d := &DeliveryBlobServer{BlobsDir: blobsDir, CacheDir: filepath.Join(t.TempDir(), "cache")}
+	get := func(merkle string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		d.ServeHTTP(w, httptest.NewRequest("GET", DeliveryBlobPrefix+merkle, nil))
+		return w
+	}
+
+	var want bytes.Buffer
+	if err := build.WriteDeliveryBlobType1(&want, strings.NewReader("blob content"), 12); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		w := get(converted)
+		if w.Code != http.StatusOK || !bytes.Equal(w.Body.Bytes(), want.Bytes()) {
+			t.Errorf("got %d %q, want the converted delivery blob", w.Code, w.Body.Bytes())
+		}
+	}
+	if _, err := os.Stat(filepath.Join(d.CacheDir, converted)); err != nil {
+		t.Errorf("converted delivery blob was not cached: %s", err)
+	}
+
+	if w := get(prebuilt); w.Code != http.StatusOK || w.Body.String() != "prebuilt" {
+		t.Errorf("got %d %q, want the delivery blob in the repository", w.Code, w.Body.String())
+	}
+
+	for _, merkle := range []string{strings.Repeat("c", 64), "not-a-merkle", strings.Repeat("A", 64)} {
+		if w := get(merkle); w.Code != http.StatusNotFound {
+			t.Errorf("%s: got status %d, want 404", merkle, w.Code)
+		}
+	}
+}
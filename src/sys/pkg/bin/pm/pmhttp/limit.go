@@ -0,0 +1,209 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package pmhttp
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DownloadLimits configures a DownloadLimiter. Zero values disable the
+// corresponding limit.
+type DownloadLimits struct {
+	// ConnectionRate is the maximum rate, in bytes per second, at which
+	// responses are sent over each client connection.
+	ConnectionRate int64
+	// TotalRate is the maximum rate, in bytes per second, at which responses
+	// are sent to all clients together.
+	TotalRate int64
+	// MaxBlobDownloads is the maximum number of blobs sent at the same time.
+	// Further blob requests wait for a download to finish.
+	MaxBlobDownloads int
+}
+
+// DownloadLimiter enforces DownloadLimits on the responses of a handler, so a
+// client pulling a large update does not saturate the uplink of the host.
+type DownloadLimiter struct {
+	limits DownloadLimits
+	total  *rateLimiter
+	blobs  chan struct{}
+
+	mu    sync.Mutex
+	conns map[string]*connLimiter
+}
+
+// connLimiter is the rate limiter of a client connection, shared by its
+// in-flight requests.
+type connLimiter struct {
+	*rateLimiter
+	requests int
+}
+
+// NewDownloadLimiter returns a DownloadLimiter enforcing limits.
+func NewDownloadLimiter(limits DownloadLimits) *DownloadLimiter {
+	l := &DownloadLimiter{limits: limits, conns: map[string]*connLimiter{}}
+	if limits.TotalRate > 0 {
+		l.total = newRateLimiter(limits.TotalRate)
+	}
+	if limits.MaxBlobDownloads > 0 {
+		l.blobs = make(chan struct{}, limits.MaxBlobDownloads)
+	}
+	return l
+}
+
+// Wrap returns a handler that passes requests to h, delaying blob downloads
+// while too many are in progress, and throttling all response bodies.
+func (l *DownloadLimiter) Wrap(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if l.blobs != nil && r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/blobs/") {
+			select {
+			case l.blobs <- struct{}{}:
+				defer func() { <-l.blobs }()
+			case <-r.Context().Done():
+				return
+			}
+		}
+
+		lw := &limitedWriter{ResponseWriter: w, ctx: r.Context(), total: l.total}
+		if l.limits.ConnectionRate > 0 {
+			// Requests multiplexed over a connection share its remote
+			// address, and so its limit.
+			conn := l.acquireConn(r.RemoteAddr)
+			defer l.releaseConn(r.RemoteAddr)
+			lw.conn = conn.rateLimiter
+		}
+		if lw.total == nil && lw.conn == nil {
+			h.ServeHTTP(w, r)
+			return
+		}
+		h.ServeHTTP(lw, r)
+	})
+}
+
+func (l *DownloadLimiter) acquireConn(addr string) *connLimiter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	c, ok := l.conns[addr]
+	if !ok {
+		c = &connLimiter{rateLimiter: newRateLimiter(l.limits.ConnectionRate)}
+		l.conns[addr] = c
+	}
+	c.requests++
+	return c
+}
+
+func (l *DownloadLimiter) releaseConn(addr string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if c := l.conns[addr]; c != nil {
+		c.requests--
+		if c.requests == 0 {
+			delete(l.conns, addr)
+		}
+	}
+}
+
+// limitedWriter writes to a ResponseWriter no faster than its rate limiters
+// allow.
+type limitedWriter struct {
+	http.ResponseWriter
+	ctx   context.Context
+	conn  *rateLimiter
+	total *rateLimiter
+}
+
+func (lw *limitedWriter) Write(b []byte) (int, error) {
+	written := 0
+	for len(b) > 0 {
+		chunk := len(b)
+		for _, rl := range []*rateLimiter{lw.conn, lw.total} {
+			if rl != nil && chunk > rl.burst {
+				chunk = rl.burst
+			}
+		}
+		for _, rl := range []*rateLimiter{lw.conn, lw.total} {
+			if rl == nil {
+				continue
+			}
+			if err := rl.wait(lw.ctx, chunk); err != nil {
+				return written, err
+			}
+		}
+		n, err := lw.ResponseWriter.Write(b[:chunk])
+		written += n
+		if err != nil {
+			return written, err
+		}
+		b = b[chunk:]
+	}
+	return written, nil
+}
+
+func (lw *limitedWriter) Flush() {
+	if f, ok := lw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+var _ http.Flusher = &limitedWriter{}
+
+// rateLimiter is a token bucket refilled with rate tokens per second, up to
+// burst tokens.
+type rateLimiter struct {
+	rate  float64
+	burst int
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// newRateLimiter returns a rateLimiter for bytesPerSecond, allowing bursts of
+// a tenth of a second of data, but at least 4KiB.
+func newRateLimiter(bytesPerSecond int64) *rateLimiter {
+	burst := int(bytesPerSecond / 10)
+	if burst < 4<<10 {
+		burst = 4 << 10
+	}
+	return &rateLimiter{
+		rate:   float64(bytesPerSecond),
+		burst:  burst,
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// wait takes n tokens, which must not be more than the burst, waiting for them
+// to become available unless ctx is done first. Waiting callers are served in
+// the order they called wait.
+func (rl *rateLimiter) wait(ctx context.Context, n int) error {
+	rl.mu.Lock()
+	now := time.Now()
+	rl.tokens += now.Sub(rl.last).Seconds() * rl.rate
+	if rl.tokens > float64(rl.burst) {
+		rl.tokens = float64(rl.burst)
+	}
+	rl.last = now
+	// Taking the tokens before they are available reserves them, so the
+	// next caller waits for its own tokens after these.
+	rl.tokens -= float64(n)
+	delay := time.Duration(-rl.tokens / rl.rate * float64(time.Second))
+	rl.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package pmhttp
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDownloadLimiterRate(t *testing.T) {
+	body := bytes.Repeat([]byte("x"), 20<<10)
+	l := NewDownloadLimiter(DownloadLimits{TotalRate: 40 << 10})
+	h := l.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(body)
+	}))
+
+	start := time.Now()
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/blobs/a", nil))
+	elapsed := time.Since(start)
+
+	if !bytes.Equal(w.Body.Bytes(), body) {
+		t.Errorf("got %d bytes, want %d", w.Body.Len(), len(body))
+	}
+	// After the initial burst of 4KiB, the remaining 16KiB take 400ms.
+	if elapsed < 300*time.Millisecond {
+		t.Errorf("response took %s, want at least 300ms", elapsed)
+	}
+}
+
+func TestDownloadLimiterConcurrency(t *testing.T) {
+	release := make(chan struct{})
+	var active, maxActive int32
+	l := NewDownloadLimiter(DownloadLimits{MaxBlobDownloads: 1})
+	server := httptest.NewServer(l.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&active, 1)
+		defer atomic.AddInt32(&active, -1)
+		if n > atomic.LoadInt32(&maxActive) {
+			atomic.StoreInt32(&maxActive, n)
+		}
+		if r.URL.Path != "/targets.json" {
+			<-release
+		}
+		w.Write([]byte(r.URL.Path))
+	})))
+	defer server.Close()
+
+	get := func(path string) error {
+		res, err := http.Get(server.URL + path)
+		if err != nil {
+			return err
+		}
+		defer res.Body.Close()
+		_, err = ioutil.ReadAll(res.Body)
+		return err
+	}
+	errs := make(chan error, 2)
+	for _, path := range []string{"/blobs/a", "/blobs/b"} {
+		go func(path string) { errs <- get(path) }(path)
+	}
+
+	// Other requests are not held up by the blob downloads.
+	time.Sleep(100 * time.Millisecond)
+	if err := get("/targets.json"); err != nil {
+		t.Fatal(err)
+	}
+	close(release)
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := atomic.LoadInt32(&maxActive); got != 2 {
+		// One blob download, and the metadata request.
+		t.Errorf("got up to %d concurrent requests, want 2", got)
+	}
+}
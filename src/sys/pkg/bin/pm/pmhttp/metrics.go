@@ -0,0 +1,174 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package pmhttp
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PublishLatencyBuckets are the upper bounds, in seconds, of the publish
+// latency histogram.
+var PublishLatencyBuckets = []float64{0.1, 0.5, 1, 5, 10, 30, 60}
+
+// Metrics collects statistics about the requests handled and the packages
+// published by a package server.
+type Metrics struct {
+	mu sync.Mutex
+
+	requests    map[int]uint64
+	bytesServed uint64
+	blobFetches map[string]uint64
+
+	publishCount   uint64
+	publishSeconds float64
+	publishBuckets []uint64
+
+	// packageMerkles maps package meta.far merkle roots to package names, so
+	// that fetches of a meta.far can be counted as resolves of its package.
+	packageMerkles func() (map[string]string, error)
+}
+
+// Stats is a snapshot of the statistics collected by Metrics.
+type Stats struct {
+	Requests            map[string]uint64 `json:"requests"`
+	BytesServed         uint64            `json:"bytes_served"`
+	PackageResolves     map[string]uint64 `json:"package_resolves"`
+	Publishes           uint64            `json:"publishes"`
+	PublishSecondsTotal float64           `json:"publish_seconds_total"`
+}
+
+// NewMetrics returns an empty Metrics, which uses packageMerkles to find the
+// packages whose meta.far blobs have been fetched.
+func NewMetrics(packageMerkles func() (map[string]string, error)) *Metrics {
+	return &Metrics{
+		requests:       map[int]uint64{},
+		blobFetches:    map[string]uint64{},
+		publishBuckets: make([]uint64, len(PublishLatencyBuckets)),
+		packageMerkles: packageMerkles,
+	}
+}
+
+// RecordRequest records a request that was responded to with the given status
+// and response body size.
+func (m *Metrics) RecordRequest(r *http.Request, status int, size int64) {
+	if status == 0 {
+		status = http.StatusOK
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requests[status]++
+	m.bytesServed += uint64(size)
+	if status == http.StatusOK && r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/blobs/") {
+		// Fetches of delivery blobs count as fetches of the blob they contain.
+		merkle := strings.TrimPrefix(r.URL.Path, "/blobs/")
+		merkle = strings.TrimPrefix(merkle, strings.TrimPrefix(DeliveryBlobPrefix, "/blobs/"))
+		m.blobFetches[merkle]++
+	}
+}
+
+// RecordPublish records a publish that took the given time.
+func (m *Metrics) RecordPublish(d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.publishCount++
+	m.publishSeconds += d.Seconds()
+	for i, le := range PublishLatencyBuckets {
+		if d.Seconds() <= le {
+			m.publishBuckets[i]++
+		}
+	}
+}
+
+// Stats returns a snapshot of the collected statistics.
+func (m *Metrics) Stats() Stats {
+	var packages map[string]string
+	if m.packageMerkles != nil {
+		var err error
+		if packages, err = m.packageMerkles(); err != nil {
+			log.Printf("[pm serve] metrics: unable to read package targets: %s", err)
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stats := Stats{
+		Requests:            map[string]uint64{},
+		BytesServed:         m.bytesServed,
+		PackageResolves:     map[string]uint64{},
+		Publishes:           m.publishCount,
+		PublishSecondsTotal: m.publishSeconds,
+	}
+	for status, n := range m.requests {
+		stats.Requests[strconv.Itoa(status)] = n
+	}
+	for merkle, n := range m.blobFetches {
+		if name, ok := packages[merkle]; ok {
+			stats.PackageResolves[name] += n
+		}
+	}
+	return stats
+}
+
+// ServeHTTP serves the collected statistics in the Prometheus text exposition
+// format.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	stats := m.Stats()
+	m.mu.Lock()
+	buckets := append([]uint64(nil), m.publishBuckets...)
+	m.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	fmt.Fprintln(w, "# HELP pm_http_requests_total Number of HTTP requests handled, by status code.")
+	fmt.Fprintln(w, "# TYPE pm_http_requests_total counter")
+	writeLabeled(w, "pm_http_requests_total", "code", stats.Requests)
+
+	fmt.Fprintln(w, "# HELP pm_http_response_bytes_total Number of response body bytes served.")
+	fmt.Fprintln(w, "# TYPE pm_http_response_bytes_total counter")
+	fmt.Fprintf(w, "pm_http_response_bytes_total %d\n", stats.BytesServed)
+
+	fmt.Fprintln(w, "# HELP pm_package_resolves_total Number of meta.far fetches, by package.")
+	fmt.Fprintln(w, "# TYPE pm_package_resolves_total counter")
+	writeLabeled(w, "pm_package_resolves_total", "package", stats.PackageResolves)
+
+	fmt.Fprintln(w, "# HELP pm_publish_duration_seconds Time taken to publish and commit packages.")
+	fmt.Fprintln(w, "# TYPE pm_publish_duration_seconds histogram")
+	for i, le := range PublishLatencyBuckets {
+		fmt.Fprintf(w, "pm_publish_duration_seconds_bucket{le=\"%s\"} %d\n", strconv.FormatFloat(le, 'g', -1, 64), buckets[i])
+	}
+	fmt.Fprintf(w, "pm_publish_duration_seconds_bucket{le=\"+Inf\"} %d\n", stats.Publishes)
+	fmt.Fprintf(w, "pm_publish_duration_seconds_sum %s\n", strconv.FormatFloat(stats.PublishSecondsTotal, 'g', -1, 64))
+	fmt.Fprintf(w, "pm_publish_duration_seconds_count %d\n", stats.Publishes)
+}
+
+// StatsHandler returns a handler serving the collected statistics as JSON.
+func (m *Metrics) StatsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(m.Stats())
+	})
+}
+
+// writeLabeled writes one sample per entry of values, labeled with the entry
+// key, in a stable order.
+func writeLabeled(w io.Writer, name, label string, values map[string]uint64) {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(w, "%s{%s=%q} %d\n", name, label, k, values[k])
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package pmhttp
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestMetrics(t *testing.T) {
+	m := NewMetrics(func() (map[string]string, error) {
+		return map[string]string{"aaaa": "foo/0"}, nil
+	})
+	for _, req := range []struct {
+		path   string
+		status int
+		size   int64
+	}{
+		{"/targets.json", 0, 100},
+		{"/blobs/aaaa", http.StatusOK, 10},
+		{"/blobs/aaaa", http.StatusOK, 10},
+		{"/blobs/bbbb", http.StatusOK, 20},
+		{"/blobs/cccc", http.StatusNotFound, 5},
+	} {
+		m.RecordRequest(httptest.NewRequest("GET", req.path, nil), req.status, req.size)
+	}
+	m.RecordPublish(2 * time.Second)
+
+	want := Stats{
+		Requests:            map[string]uint64{"200": 4, "404": 1},
+		BytesServed:         145,
+		PackageResolves:     map[string]uint64{"foo/0": 2},
+		Publishes:           1,
+		PublishSecondsTotal: 2,
+	}
+	if diff := cmp.Diff(want, m.Stats()); diff != "" {
+		t.Errorf("stats (-want +got):\n%s", diff)
+	}
+
+	t.Run("prometheus", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		m.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+		body, err := io.ReadAll(w.Result().Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, line := range []string{
+			`pm_http_requests_total{code="200"} 4`,
+			`pm_http_requests_total{code="404"} 1`,
+			`pm_http_response_bytes_total 145`,
+			`pm_package_resolves_total{package="foo/0"} 2`,
+			`pm_publish_duration_seconds_bucket{le="1"} 0`,
+			`pm_publish_duration_seconds_bucket{le="5"} 1`,
+			`pm_publish_duration_seconds_bucket{le="+Inf"} 1`,
+			`pm_publish_duration_seconds_sum 2`,
+			`pm_publish_duration_seconds_count 1`,
+		} {
+			if !strings.Contains(string(body), line+"\n") {
+				t.Errorf("metrics missing %q:\n%s", line, body)
+			}
+		}
+	})
+
+	t.Run("json", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		m.StatsHandler().ServeHTTP(w, httptest.NewRequest("GET", "/stats", nil))
+		var got Stats
+		if err := json.NewDecoder(w.Result().Body).Decode(&got); err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("stats (-want +got):\n%s", diff)
+		}
+	})
+}
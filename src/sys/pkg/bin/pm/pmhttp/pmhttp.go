@@ -8,8 +8,24 @@ import (
 	"compress/gzip"
 	"log"
 	"net/http"
+	"strings"
 )
 
+// ShouldGZIP returns true if the response to the given request may be gzip
+// encoded. Blobs are never compressed, and neither are responses to range
+// requests: the byte ranges of RFC 7233 refer to the representation being
+// served, so compressing a partial response would make it impossible for
+// clients to resume a download.
+func ShouldGZIP(r *http.Request) bool {
+	if strings.HasPrefix(r.RequestURI, "/blobs") || strings.HasPrefix(r.RequestURI, UploadPrefix) {
+		return false
+	}
+	if r.Header.Get("Range") != "" {
+		return false
+	}
+	return strings.Contains(r.Header.Get("Accept-Encoding"), "gzip")
+}
+
 type GZIPWriter struct {
 	http.ResponseWriter
 	*gzip.Writer
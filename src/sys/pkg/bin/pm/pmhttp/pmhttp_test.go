@@ -72,3 +72,30 @@ func TestLoggingWriter(t *testing.T) {
 		t.Errorf("wrong response length, expected %d, got %d", len(msg), lwResponseSize)
 	}
 }
+
+func TestShouldGZIP(t *testing.T) {
+	for _, tc := range []struct {
+		uri, acceptEncoding, rangeHeader string
+		want                             bool
+	}{
+		{"/targets.json", "gzip", "", true},
+		{"/targets.json", "", "", false},
+		{"/targets.json", "gzip", "bytes=0-10", false},
+		{"/blobs/0123", "gzip", "", false},
+	} {
+		r, err := http.NewRequest("GET", tc.uri, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.RequestURI = tc.uri
+		if tc.acceptEncoding != "" {
+			r.Header.Set("Accept-Encoding", tc.acceptEncoding)
+		}
+		if tc.rangeHeader != "" {
+			r.Header.Set("Range", tc.rangeHeader)
+		}
+		if got := ShouldGZIP(r); got != tc.want {
+			t.Errorf("ShouldGZIP(%s, Accept-Encoding %q, Range %q) = %v, want %v", tc.uri, tc.acceptEncoding, tc.rangeHeader, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package pmhttp
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+)
+
+func TestSelfSignedCert(t *testing.T) {
+	cert, err := GenerateSelfSignedCert([]string{"127.0.0.1", "localhost"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fingerprint, err := CertFingerprint(cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(fingerprint), 32*3-1; got != want {
+		t.Errorf("got fingerprint %q of length %d, want %d", fingerprint, got, want)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, "hello")
+		}),
+	}
+	defer server.Close()
+	go server.Serve(tls.NewListener(listener, &tls.Config{Certificates: []tls.Certificate{cert}}))
+
+	// A client that trusts the certificate can fetch over TLS.
+	pool := x509.NewCertPool()
+	pool.AddCert(cert.Leaf)
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}}
+	res, err := client.Get(fmt.Sprintf("https://%s/", listener.Addr()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "hello" {
+		t.Errorf("got %q, want %q", body, "hello")
+	}
+	if got, _ := CertFingerprint(tls.Certificate{Certificate: [][]byte{res.TLS.PeerCertificates[0].Raw}}); got != fingerprint {
+		t.Errorf("got peer fingerprint %s, want %s", got, fingerprint)
+	}
+}
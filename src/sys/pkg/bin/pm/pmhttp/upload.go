@@ -0,0 +1,462 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package pmhttp
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	tufData "github.com/theupdateframework/go-tuf/data"
+	"github.com/theupdateframework/go-tuf/verify"
+
+	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/build"
+	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/upload"
+)
+
+// UploadPrefix is the path below which a repository accepts objects from
+// remote publishers. The rest of the path names the object relative to the
+// served repository directory, e.g. "/upload/blobs/<merkle>".
+//
+// A HEAD request returns the size of a stored object in Content-Length and its
+// checksum in upload.ChecksumHeader, or 404. A PUT request stores the request
+// body as the object, replacing it atomically, if the body matches the
+// Content-Length and upload.ChecksumHeader of the request, and is content the
+// object may have; see UploadServer.
+const UploadPrefix = "/upload/"
+
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+// errUploadForbidden is returned for names that objects cannot be uploaded as.
+var errUploadForbidden = errors.New("objects cannot be uploaded with this name")
+
+// topLevelRoles are the TUF roles whose metadata can be uploaded.
+var topLevelRoles = map[string]bool{"root": true, "targets": true, "snapshot": true, "timestamp": true}
+
+// UploadServer stores objects uploaded below UploadPrefix in Dir. Only the
+// objects of a repository can be uploaded, and only with content that
+// matches their names:
+//
+//   - "blobs/<merkle>" must be a blob with that merkle root.
+//   - "targets/.../<hash>.<name>", a consistent snapshot target file, must
+//     have that SHA-256 or SHA-512 hash.
+//   - "<role>.json" and "<version>.<role>.json", for a top-level role, must be
+//     metadata of that role and version signed as the root metadata in Dir
+//     requires. Unversioned metadata cannot be replaced by an older version. A
+//     new root version must be the next one, and also be signed as the
+//     previous version requires; the first root metadata uploaded to an empty
+//     Dir only needs to be signed as it requires itself.
+//   - "<hash>.root.json", a consistent snapshot of root metadata, must have
+//     that SHA-256 or SHA-512 hash and be a copy of root metadata already
+//     stored as "root.json" or "<version>.root.json".
+//
+// The server should still only be reachable by trusted publishers, e.g.
+// behind TokenAuth.
+type UploadServer struct {
+	Dir string
+
+	// mu serializes metadata uploads, which are checked against the
+	// metadata already stored.
+	mu sync.Mutex
+}
+
+func (u *UploadServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name, ok := uploadName(r.URL.Path)
+	if !ok {
+		http.Error(w, "invalid object name", http.StatusBadRequest)
+		return
+	}
+	p := filepath.Join(u.Dir, filepath.FromSlash(name))
+
+	switch r.Method {
+	case http.MethodHead:
+		size, sum, err := fileChecksum(p)
+		if os.IsNotExist(err) {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+		w.Header().Set(upload.ChecksumHeader, fmt.Sprintf("%08x", sum))
+		w.WriteHeader(http.StatusOK)
+	case http.MethodPut:
+		check, isMetadata, err := u.uploadCheck(name)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		want, err := strconv.ParseUint(r.Header.Get(upload.ChecksumHeader), 16, 32)
+		if err != nil || r.ContentLength < 0 {
+			http.Error(w, "uploads require Content-Length and "+upload.ChecksumHeader, http.StatusBadRequest)
+			return
+		}
+		if isMetadata {
+			u.mu.Lock()
+			defer u.mu.Unlock()
+		}
+		if err := storeUpload(p, r.Body, r.ContentLength, uint32(want), check); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", "HEAD, PUT")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// uploadName returns the object name of an upload request path, and false if
+// it is not a plain relative path. Names with components starting with "." are
+// rejected, as those are reserved for temporary files.
+func uploadName(p string) (string, bool) {
+	name := strings.TrimPrefix(p, UploadPrefix)
+	if name == "" || name != path.Clean(name) || path.IsAbs(name) {
+		return "", false
+	}
+	for _, elem := range strings.Split(name, "/") {
+		if strings.HasPrefix(elem, ".") {
+			return "", false
+		}
+	}
+	return name, true
+}
+
+// uploadCheck returns the check that the content of the named object must pass
+// before it is stored, and whether the object is TUF metadata, or
+// errUploadForbidden.
+func (u *UploadServer) uploadCheck(name string) (func(tmp string, size int64) error, bool, error) {
+	if dir, base := path.Split(name); dir == "blobs/" {
+		want, err := build.DecodeMerkleRoot([]byte(base))
+		if err != nil || want.String() != base {
+			return nil, false, errUploadForbidden
+		}
+		return func(tmp string, size int64) error {
+			return build.VerifyBlob(tmp, want, size)
+		}, false, nil
+	}
+
+	if strings.HasPrefix(name, "targets/") {
+		want, newHash, ok := hashPrefix(path.Base(name))
+		if !ok {
+			return nil, false, errUploadForbidden
+		}
+		return func(tmp string, size int64) error {
+			return checkFileHash(tmp, newHash(), want)
+		}, false, nil
+	}
+
+	if want, newHash, ok := hashPrefix(name); ok {
+		if name != want+".root.json" {
+			return nil, false, errUploadForbidden
+		}
+		return func(tmp string, size int64) error {
+			if err := checkFileHash(tmp, newHash(), want); err != nil {
+				return err
+			}
+			b, err := ioutil.ReadFile(tmp)
+			if err != nil {
+				return err
+			}
+			return u.checkRootCopy(b)
+		}, true, nil
+	}
+
+	if strings.Contains(name, "/") || !strings.HasSuffix(name, ".json") {
+		return nil, false, errUploadForbidden
+	}
+	role := strings.TrimSuffix(name, ".json")
+	version := 0
+	if i := strings.IndexByte(role, '.'); i >= 0 {
+		v, err := strconv.Atoi(role[:i])
+		if err != nil || v < 1 || strconv.Itoa(v) != role[:i] {
+			return nil, false, errUploadForbidden
+		}
+		version, role = v, role[i+1:]
+	}
+	if !topLevelRoles[role] {
+		return nil, false, errUploadForbidden
+	}
+	return func(tmp string, size int64) error {
+		b, err := ioutil.ReadFile(tmp)
+		if err != nil {
+			return err
+		}
+		if role == "root" {
+			return u.checkRoot(b, version)
+		}
+		return u.checkMetadata(name, b, role, version)
+	}, true, nil
+}
+
+// hashPrefix returns the hex SHA-256 or SHA-512 hash that the consistent
+// snapshot file name starts with, and the hash function it is from.
+func hashPrefix(name string) (string, func() hash.Hash, bool) {
+	i := strings.IndexByte(name, '.')
+	if i < 0 {
+		return "", nil, false
+	}
+	prefix := name[:i]
+	if _, err := hex.DecodeString(prefix); err != nil || strings.ToLower(prefix) != prefix {
+		return "", nil, false
+	}
+	switch len(prefix) {
+	case 2 * sha256.Size:
+		return prefix, sha256.New, true
+	case 2 * sha512.Size:
+		return prefix, sha512.New, true
+	}
+	return "", nil, false
+}
+
+// checkFileHash returns an error unless the file at p hashes to want, in hex.
+func checkFileHash(p string, h hash.Hash, want string) error {
+	f, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := io.Copy(h, f); err != nil {
+		return err
+	}
+	if got := hex.EncodeToString(h.Sum(nil)); got != want {
+		return fmt.Errorf("content has hash %s, want %s", got, want)
+	}
+	return nil
+}
+
+// checkRoot returns an error unless b is root metadata that can follow the
+// stored root metadata, of the given version if it is not zero.
+func (u *UploadServer) checkRoot(b []byte, version int) error {
+	root, err := parseRoot(b)
+	if err != nil {
+		return err
+	}
+	if version != 0 && root.Version != version {
+		return fmt.Errorf("root metadata has version %d, want %d", root.Version, version)
+	}
+	db, err := rootDB(root)
+	if err != nil {
+		return err
+	}
+	var signed tufData.Signed
+	if err := json.Unmarshal(b, &signed); err != nil {
+		return err
+	}
+	if err := db.Verify(&signed, "root", 0); err != nil {
+		return fmt.Errorf("root metadata: %w", err)
+	}
+
+	trusted, err := u.trustedRoot()
+	if err != nil || trusted == nil {
+		return err
+	}
+	if root.Version != trusted.Version && root.Version != trusted.Version+1 {
+		return fmt.Errorf("root metadata has version %d, want %d or %d", root.Version, trusted.Version, trusted.Version+1)
+	}
+	if db, err = rootDB(trusted); err != nil {
+		return err
+	}
+	if err := db.VerifySignatures(&signed, "root"); err != nil {
+		return fmt.Errorf("root metadata version %d is not signed by version %d: %w", root.Version, trusted.Version, err)
+	}
+	return nil
+}
+
+// checkRootCopy returns an error unless b is identical to the stored
+// "root.json" or "<version>.root.json" of its version.
+func (u *UploadServer) checkRootCopy(b []byte) error {
+	root, err := parseRoot(b)
+	if err != nil {
+		return err
+	}
+	for _, name := range []string{"root.json", fmt.Sprintf("%d.root.json", root.Version)} {
+		stored, err := ioutil.ReadFile(filepath.Join(u.Dir, name))
+		if err == nil && bytes.Equal(stored, b) {
+			return nil
+		}
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return fmt.Errorf("root metadata version %d is not stored", root.Version)
+}
+
+// checkMetadata returns an error unless b is metadata for role, signed as the
+// stored root metadata requires, of the given version if it is not zero, and
+// otherwise not older than the stored metadata with the same name.
+func (u *UploadServer) checkMetadata(name string, b []byte, role string, version int) error {
+	trusted, err := u.trustedRoot()
+	if err != nil {
+		return err
+	}
+	if trusted == nil {
+		return fmt.Errorf("no root metadata to verify %s metadata against", role)
+	}
+	db, err := rootDB(trusted)
+	if err != nil {
+		return err
+	}
+	minVersion := version
+	if version == 0 {
+		if minVersion, err = storedVersion(filepath.Join(u.Dir, name)); err != nil {
+			return err
+		}
+	}
+	var meta struct {
+		Version int `json:"version"`
+	}
+	if err := db.Unmarshal(b, &meta, role, minVersion); err != nil {
+		return fmt.Errorf("%s metadata: %w", role, err)
+	}
+	if version != 0 && meta.Version != version {
+		return fmt.Errorf("%s metadata has version %d, want %d", role, meta.Version, version)
+	}
+	return nil
+}
+
+// trustedRoot returns the root metadata with the highest version stored in
+// Dir, or nil if there is none.
+func (u *UploadServer) trustedRoot() (*tufData.Root, error) {
+	paths, err := filepath.Glob(filepath.Join(u.Dir, "*.root.json"))
+	if err != nil {
+		return nil, err
+	}
+	paths = append(paths, filepath.Join(u.Dir, "root.json"))
+	var trusted *tufData.Root
+	for _, p := range paths {
+		b, err := ioutil.ReadFile(p)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		root, err := parseRoot(b)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", filepath.Base(p), err)
+		}
+		if trusted == nil || root.Version > trusted.Version {
+			trusted = root
+		}
+	}
+	return trusted, nil
+}
+
+func parseRoot(b []byte) (*tufData.Root, error) {
+	var signed tufData.Signed
+	if err := json.Unmarshal(b, &signed); err != nil {
+		return nil, err
+	}
+	var root tufData.Root
+	if err := json.Unmarshal(signed.Signed, &root); err != nil {
+		return nil, err
+	}
+	return &root, nil
+}
+
+// rootDB returns a verifier for the keys and roles of root.
+func rootDB(root *tufData.Root) (*verify.DB, error) {
+	db := verify.NewDB()
+	for id, key := range root.Keys {
+		if err := db.AddKey(id, key); err != nil {
+			return nil, fmt.Errorf("root key %s: %w", id, err)
+		}
+	}
+	for name, role := range root.Roles {
+		if err := db.AddRole(name, role); err != nil {
+			return nil, fmt.Errorf("root role %s: %w", name, err)
+		}
+	}
+	return db, nil
+}
+
+// storedVersion returns the version of the metadata stored at p, or 0 if there
+// is none.
+func storedVersion(p string) (int, error) {
+	b, err := ioutil.ReadFile(p)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	var signed tufData.Signed
+	if err := json.Unmarshal(b, &signed); err != nil {
+		return 0, fmt.Errorf("%s: %w", filepath.Base(p), err)
+	}
+	var meta struct {
+		Version int `json:"version"`
+	}
+	if err := json.Unmarshal(signed.Signed, &meta); err != nil {
+		return 0, fmt.Errorf("%s: %w", filepath.Base(p), err)
+	}
+	return meta.Version, nil
+}
+
+// storeUpload writes rd to p, failing unless it has the given size and
+// checksum, and passes check.
+func storeUpload(p string, rd io.Reader, size int64, sum uint32, check func(tmp string, size int64) error) error {
+	if err := os.MkdirAll(filepath.Dir(p), os.ModePerm); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(p), ".upload")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	h := crc32.New(crc32cTable)
+	n, err := io.Copy(io.MultiWriter(f, h), io.LimitReader(rd, size+1))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if n != size || h.Sum32() != sum {
+		return fmt.Errorf("received %d bytes with checksum %08x, want %d bytes with checksum %08x", n, h.Sum32(), size, sum)
+	}
+	if err := check(f.Name(), size); err != nil {
+		return err
+	}
+	if err := os.Chmod(f.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), p)
+}
+
+func fileChecksum(p string) (int64, uint32, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+	if fi, err := f.Stat(); err != nil {
+		return 0, 0, err
+	} else if !fi.Mode().IsRegular() {
+		return 0, 0, os.ErrNotExist
+	}
+	h := crc32.New(crc32cTable)
+	n, err := io.Copy(h, f)
+	return n, h.Sum32(), err
+}
@@ -0,0 +1,180 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package pmhttp
+
+import (
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/repo"
+	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/upload"
+	"go.fuchsia.dev/fuchsia/src/sys/pkg/lib/merkle"
+)
+
+func uploadRequest(u *UploadServer, method, name, body, checksum string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, UploadPrefix+name, strings.NewReader(body))
+	if checksum != "" {
+		req.Header.Set(upload.ChecksumHeader, checksum)
+	}
+	w := httptest.NewRecorder()
+	u.ServeHTTP(w, req)
+	return w
+}
+
+func checksum(content string) string {
+	return fmt.Sprintf("%08x", crc32.Checksum([]byte(content), crc32cTable))
+}
+
+func TestUploadServer(t *testing.T) {
+	dir := t.TempDir()
+	u := &UploadServer{Dir: dir}
+	do := func(method, name, body, checksum string) *httptest.ResponseRecorder {
+		return uploadRequest(u, method, name, body, checksum)
+	}
+
+	content := "blob content"
+	sum := checksum(content)
+	var tree merkle.Tree
+	if _, err := tree.ReadFrom(strings.NewReader(content)); err != nil {
+		t.Fatal(err)
+	}
+	blob := "blobs/" + hex.EncodeToString(tree.Root())
+
+	if w := do("HEAD", blob, "", ""); w.Code != http.StatusNotFound {
+		t.Errorf("HEAD before upload: got status %d, want 404", w.Code)
+	}
+	if w := do("PUT", blob, content, sum); w.Code != http.StatusNoContent {
+		t.Fatalf("PUT: got status %d: %s", w.Code, w.Body.String())
+	}
+	got, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(blob)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != content {
+		t.Errorf("stored %q, want %q", got, content)
+	}
+	w := do("HEAD", blob, "", "")
+	if w.Code != http.StatusOK || w.Header().Get(upload.ChecksumHeader) != sum || w.Header().Get("Content-Length") != fmt.Sprint(len(content)) {
+		t.Errorf("HEAD: got status %d and headers %v", w.Code, w.Header())
+	}
+
+	hash := sha512.Sum512([]byte(content))
+	target := "targets/a/" + hex.EncodeToString(hash[:]) + ".0"
+	if w := do("PUT", target, content, sum); w.Code != http.StatusNoContent {
+		t.Fatalf("PUT %s: got status %d: %s", target, w.Code, w.Body.String())
+	}
+
+	other := "other content"
+	otherBlob := "blobs/" + strings.Repeat("a", 64)
+	for _, tc := range []struct {
+		name, method, path, body, checksum string
+		want                               int
+	}{
+		{"checksum mismatch", "PUT", blob, other, sum, http.StatusBadRequest},
+		{"missing checksum", "PUT", blob, content, "", http.StatusBadRequest},
+		{"wrong blob", "PUT", otherBlob, other, checksum(other), http.StatusBadRequest},
+		{"wrong target hash", "PUT", "targets/a/" + strings.Repeat("b", 128) + ".0", other, checksum(other), http.StatusBadRequest},
+		{"not a merkle root", "PUT", "blobs/b", content, sum, http.StatusForbidden},
+		{"uppercase merkle root", "PUT", strings.ToUpper(blob), content, sum, http.StatusForbidden},
+		{"unhashed target", "PUT", "targets/a/0", content, sum, http.StatusForbidden},
+		{"delegated metadata", "PUT", "a.json", content, sum, http.StatusForbidden},
+		{"other file", "PUT", "config.json", content, sum, http.StatusForbidden},
+		{"parent directory", "PUT", "../b", content, sum, http.StatusBadRequest},
+		{"hidden file", "PUT", "blobs/.b", content, sum, http.StatusBadRequest},
+		{"GET", "GET", blob, "", "", http.StatusMethodNotAllowed},
+	} {
+		if w := do(tc.method, tc.path, tc.body, tc.checksum); w.Code != tc.want {
+			t.Errorf("%s: got status %d, want %d", tc.name, w.Code, tc.want)
+		}
+	}
+	if _, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(otherBlob))); err == nil {
+		t.Error("rejected upload was stored")
+	}
+}
+
+func TestUploadServerMetadata(t *testing.T) {
+	repoDir := t.TempDir()
+	r, err := repo.New(repoDir, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.AddTargets([]string{}, json.RawMessage{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.CommitUpdates(false); err != nil {
+		t.Fatal(err)
+	}
+	read := func(name string) string {
+		b, err := ioutil.ReadFile(filepath.Join(repoDir, "repository", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(b)
+	}
+	oldTimestamp := read("timestamp.json")
+
+	u := &UploadServer{Dir: t.TempDir()}
+	put := func(name, body string) int {
+		return uploadRequest(u, "PUT", name, body, checksum(body)).Code
+	}
+
+	if got := put("timestamp.json", oldTimestamp); got != http.StatusBadRequest {
+		t.Errorf("metadata before root: got status %d, want %d", got, http.StatusBadRequest)
+	}
+	for _, name := range []string{"1.root.json", "root.json", "timestamp.json"} {
+		if got := put(name, read(name)); got != http.StatusNoContent {
+			t.Fatalf("PUT %s: got status %d", name, got)
+		}
+	}
+	rootHash := sha512.Sum512([]byte(read("root.json")))
+	if got := put(hex.EncodeToString(rootHash[:])+".root.json", read("root.json")); got != http.StatusNoContent {
+		t.Errorf("consistent snapshot of root.json: got status %d", got)
+	}
+	timestampHash := sha512.Sum512([]byte(oldTimestamp))
+	if got := put(hex.EncodeToString(timestampHash[:])+".root.json", oldTimestamp); got != http.StatusBadRequest {
+		t.Errorf("consistent snapshot of other metadata: got status %d, want %d", got, http.StatusBadRequest)
+	}
+	tampered := strings.Replace(oldTimestamp, `"version":1`, `"version":5`, 1)
+	if tampered == oldTimestamp {
+		t.Fatal("could not find the timestamp version")
+	}
+	for _, tc := range []struct{ name, path, body string }{
+		{"tampered", "timestamp.json", tampered},
+		{"wrong role", "snapshot.json", oldTimestamp},
+		{"wrong version", "2.snapshot.json", read("1.snapshot.json")},
+	} {
+		if got := put(tc.path, tc.body); got != http.StatusBadRequest {
+			t.Errorf("%s: got status %d, want %d", tc.name, got, http.StatusBadRequest)
+		}
+	}
+
+	// Rotated keys are trusted once the new root metadata is uploaded.
+	if err := r.RotateKeys([]string{"root", "timestamp"}, false); err != nil {
+		t.Fatal(err)
+	}
+	if got := put("timestamp.json", read("timestamp.json")); got != http.StatusBadRequest {
+		t.Errorf("metadata signed by a rotated key: got status %d, want %d", got, http.StatusBadRequest)
+	}
+	for _, name := range []string{"2.root.json", "root.json", "timestamp.json"} {
+		if got := put(name, read(name)); got != http.StatusNoContent {
+			t.Fatalf("PUT %s: got status %d", name, got)
+		}
+	}
+	if got := put("timestamp.json", oldTimestamp); got != http.StatusBadRequest {
+		t.Errorf("rollback: got status %d, want %d", got, http.StatusBadRequest)
+	}
+}
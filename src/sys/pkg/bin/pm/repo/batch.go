@@ -0,0 +1,127 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package repo
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/build"
+)
+
+// PackageTiming records how long publishing one package of a batch took.
+type PackageTiming struct {
+	// Path is the path of the package manifest.
+	Path string
+	// Name is the target name of the package.
+	Name string
+	// Blobs is the number of content blobs of the package.
+	Blobs int
+	// Skipped is true if the package was already published.
+	Skipped bool
+	// Duration is the time spent publishing the content blobs of the
+	// package, summed across workers, and adding its target. A blob shared
+	// by several packages counts towards each of them.
+	Duration time.Duration
+}
+
+// batchPackage is a package of a batch that needs publishing.
+type batchPackage struct {
+	manifest *build.PackageManifest
+	timing   *PackageTiming
+	meta     build.PackageBlobInfo
+}
+
+// PublishManifestsParallel is PublishManifests, with the content blobs of the
+// packages published by the given number of concurrent workers. A blob shared
+// by several packages is published once. The package targets are added in the
+// order of paths once their blobs are published, so a single CommitUpdates
+// signs the metadata of the whole batch. The returned timings are in the order
+// of paths.
+func (r *Repo) PublishManifestsParallel(paths []string, workers int) ([]string, []PackageTiming, error) {
+	targets, err := r.Targets()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var deps []string
+	timings := make([]PackageTiming, len(paths))
+	var pkgs []*batchPackage
+	// Each distinct content blob is published once, on behalf of every
+	// package that contains it.
+	var blobs []build.PackageBlobInfo
+	owners := map[build.MerkleRoot][]*PackageTiming{}
+	for i, path := range paths {
+		m, err := build.LoadPackageManifest(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		p := m.Package
+		if err := p.Validate(); err != nil {
+			return nil, nil, fmt.Errorf("%s: Validate() failed: %v", path, err)
+		}
+		deps = append(deps, path)
+		pkg := &batchPackage{manifest: m, timing: &timings[i]}
+		var content []build.PackageBlobInfo
+		for _, blob := range m.Blobs {
+			deps = append(deps, blob.SourcePath)
+			if blob.Path == "meta/" {
+				pkg.meta = blob
+			} else {
+				content = append(content, blob)
+			}
+		}
+		if pkg.meta.Path == "" {
+			return nil, nil, fmt.Errorf("%s: package manifest has no meta.far", path)
+		}
+		timings[i] = PackageTiming{Path: path, Name: p.Name + "/" + p.Version, Blobs: len(content)}
+
+		exists, err := r.hasTarget(p.Name, p.Version, pkg.meta.Merkle.String(), targets)
+		if err != nil {
+			return nil, nil, err
+		}
+		if exists {
+			timings[i].Skipped = true
+			continue
+		}
+		pkgs = append(pkgs, pkg)
+		for _, blob := range content {
+			if _, ok := owners[blob.Merkle]; !ok {
+				blobs = append(blobs, blob)
+			}
+			owners[blob.Merkle] = append(owners[blob.Merkle], &timings[i])
+		}
+	}
+
+	var mu sync.Mutex
+	err = forEach(context.Background(), len(blobs), workers, func(ctx context.Context, i int) error {
+		blob := blobs[i]
+		start := time.Now()
+		if err := r.publishBlob(blob.Merkle.String(), blob.SourcePath, int64(blob.Size)); err != nil {
+			return fmt.Errorf("publishing blob %s: %w", blob.Merkle, err)
+		}
+		elapsed := time.Since(start)
+		mu.Lock()
+		defer mu.Unlock()
+		for _, timing := range owners[blob.Merkle] {
+			timing.Duration += elapsed
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, pkg := range pkgs {
+		start := time.Now()
+		if err := r.addManifestPackage(pkg.manifest, pkg.meta, nil); err != nil {
+			return nil, nil, err
+		}
+		pkg.timing.Duration += time.Since(start)
+	}
+	return deps, timings, nil
+}
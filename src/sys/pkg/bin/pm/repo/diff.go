@@ -0,0 +1,188 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package repo
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	tufData "github.com/theupdateframework/go-tuf/data"
+)
+
+// PackageChange describes a package target that differs between two
+// repository states.
+type PackageChange struct {
+	// Target is the target name, e.g. "system_image/0".
+	Target string `json:"target"`
+	// Old is the meta.far merkle root in the old state, if the target existed.
+	Old string `json:"old,omitempty"`
+	// New is the meta.far merkle root in the new state, if the target exists.
+	New string `json:"new,omitempty"`
+	// DeltaBytes is the total size of the blobs of the new package, including
+	// its subpackages, that no package in the old state references. This is
+	// what a device that has the old state needs to fetch for the package.
+	DeltaBytes int64 `json:"delta_bytes"`
+}
+
+// RepoDiff describes the differences between the package targets of two
+// repository states.
+type RepoDiff struct {
+	Added   []PackageChange `json:"added"`
+	Removed []PackageChange `json:"removed"`
+	Updated []PackageChange `json:"updated"`
+	// AddedBlobs is the number of blobs referenced by the new state only.
+	AddedBlobs int `json:"added_blobs"`
+	// AddedBlobBytes is the total size of the AddedBlobs.
+	AddedBlobBytes int64 `json:"added_blob_bytes"`
+	// RemovedBlobs is the number of blobs referenced by the old state only.
+	RemovedBlobs int `json:"removed_blobs"`
+	// RemovedBlobBytes is the total size of the RemovedBlobs.
+	RemovedBlobBytes int64 `json:"removed_blob_bytes"`
+}
+
+// repoState is the package targets of a repository state together with the
+// blobs they refer to.
+type repoState struct {
+	targets map[string]customTargetMetadata
+	blobs   BlobStore
+}
+
+// readRepoState reads the package targets at path, which is either a
+// repository directory, whose committed targets.json is used, or a targets
+// metadata file, e.g. an older "<version>.targets.json" of a consistent
+// snapshot repository. The blobs are expected in the "blobs" directory next
+// to the metadata.
+func readRepoState(path string) (*repoState, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	metaPath := path
+	if fi.IsDir() {
+		metaPath = filepath.Join(path, "repository", "targets.json")
+	}
+	b, err := ioutil.ReadFile(metaPath)
+	if err != nil {
+		return nil, err
+	}
+	var signed tufData.Signed
+	if err := json.Unmarshal(b, &signed); err != nil {
+		return nil, fmt.Errorf("%s: %w", metaPath, err)
+	}
+	var targets tufData.Targets
+	if err := json.Unmarshal(signed.Signed, &targets); err != nil {
+		return nil, fmt.Errorf("%s: %w", metaPath, err)
+	}
+	pkgs, err := packageTargets(targets.Targets)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", metaPath, err)
+	}
+	return &repoState{
+		targets: pkgs,
+		blobs:   &DirBlobStore{Dir: filepath.Join(filepath.Dir(metaPath), "blobs")},
+	}, nil
+}
+
+// reachable returns the blobs referenced by the package target custom.
+func (s *repoState) reachable(custom customTargetMetadata) (map[string]struct{}, error) {
+	blobs := map[string]struct{}{}
+	for _, meta := range append([]string{custom.Merkle}, custom.Subpackages...) {
+		if err := markPackage(s.blobs, meta, blobs); err != nil {
+			return nil, err
+		}
+	}
+	return blobs, nil
+}
+
+// DiffRepositories compares the package targets of two repository states, each
+// given as a repository directory or a targets metadata file, and reports the
+// added, removed and updated packages along with the blob-level delta between
+// the states. Neither repository is modified.
+func DiffRepositories(oldPath, newPath string) (*RepoDiff, error) {
+	oldState, err := readRepoState(oldPath)
+	if err != nil {
+		return nil, err
+	}
+	newState, err := readRepoState(newPath)
+	if err != nil {
+		return nil, err
+	}
+	return diffStates(oldState, newState)
+}
+
+func diffStates(oldState, newState *repoState) (*RepoDiff, error) {
+	diff := &RepoDiff{Added: []PackageChange{}, Removed: []PackageChange{}, Updated: []PackageChange{}}
+
+	oldBlobs := map[string]struct{}{}
+	for name, custom := range oldState.targets {
+		blobs, err := oldState.reachable(custom)
+		if err != nil {
+			return nil, fmt.Errorf("target %s: %w", name, err)
+		}
+		for root := range blobs {
+			oldBlobs[root] = struct{}{}
+		}
+		if _, ok := newState.targets[name]; !ok {
+			diff.Removed = append(diff.Removed, PackageChange{Target: name, Old: custom.Merkle})
+		}
+	}
+
+	newBlobs := map[string]struct{}{}
+	sizes := map[string]int64{}
+	for name, custom := range newState.targets {
+		old, existed := oldState.targets[name]
+		blobs, err := newState.reachable(custom)
+		if err != nil {
+			return nil, fmt.Errorf("target %s: %w", name, err)
+		}
+		change := PackageChange{Target: name, New: custom.Merkle}
+		for root := range blobs {
+			newBlobs[root] = struct{}{}
+			if _, ok := oldBlobs[root]; ok {
+				continue
+			}
+			size, ok := sizes[root]
+			if !ok {
+				if size, err = newState.blobs.Stat(root); err != nil {
+					return nil, fmt.Errorf("target %s: %w", name, err)
+				}
+				sizes[root] = size
+			}
+			change.DeltaBytes += size
+		}
+		switch {
+		case !existed:
+			diff.Added = append(diff.Added, change)
+		case old.Merkle != custom.Merkle:
+			change.Old = old.Merkle
+			diff.Updated = append(diff.Updated, change)
+		}
+	}
+
+	for _, size := range sizes {
+		diff.AddedBlobs++
+		diff.AddedBlobBytes += size
+	}
+	for root := range oldBlobs {
+		if _, ok := newBlobs[root]; ok {
+			continue
+		}
+		size, err := oldState.blobs.Stat(root)
+		if err != nil {
+			return nil, err
+		}
+		diff.RemovedBlobs++
+		diff.RemovedBlobBytes += size
+	}
+
+	for _, changes := range [][]PackageChange{diff.Added, diff.Removed, diff.Updated} {
+		sort.Slice(changes, func(i, j int) bool { return changes[i].Target < changes[j].Target })
+	}
+	return diff, nil
+}
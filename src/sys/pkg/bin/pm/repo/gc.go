@@ -0,0 +1,184 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package repo
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/build"
+	far "go.fuchsia.dev/fuchsia/src/sys/pkg/lib/far/go"
+)
+
+// GCResult describes the blobs found, and possibly removed, by a garbage
+// collection of the repository blob store.
+type GCResult struct {
+	// Reachable is the number of blobs referenced by the package targets.
+	Reachable int
+	// Unreferenced lists the merkle roots of the blobs no target references.
+	Unreferenced []string
+	// UnreferencedBytes is the total on-disk size of the unreferenced blobs.
+	UnreferencedBytes int64
+}
+
+// ErrSharedBlobStore is returned by GC for a repository whose blob store is
+// not its own repository/blobs directory, since other repositories may be
+// publishing the blobs it holds.
+var ErrSharedBlobStore = errors.New("repo: the blob store may be shared with other repositories")
+
+// GCOptions configure a garbage collection.
+type GCOptions struct {
+	// DryRun only reports the unreferenced blobs, without removing them.
+	DryRun bool
+
+	// SharedStore allows collecting a blob store other than the
+	// repository's own repository/blobs directory. Every other repository
+	// that uses the store must then be listed in Others.
+	SharedStore bool
+
+	// Others are the other repositories that publish blobs from this
+	// repository's blob store. The blobs they reach are kept.
+	Others []*Repo
+}
+
+// GC finds the blobs in the repository blob store that are not reachable from
+// any package target, including through the subpackages recorded in the
+// target, and removes them unless opts.DryRun is set. Both the staged and the
+// committed targets are roots, so blobs stay available while the committed
+// metadata still refers to them. GC fails without removing anything if a
+// referenced meta.far is missing or unreadable.
+func (r *Repo) GC(opts GCOptions) (GCResult, error) {
+	if r.encryptionKey != nil {
+		return GCResult{}, errors.New("repo: garbage collection is not supported with blob encryption")
+	}
+	if !opts.SharedStore && !r.ownsBlobStore() {
+		return GCResult{}, ErrSharedBlobStore
+	}
+
+	reachable := map[string]struct{}{}
+	for _, repo := range append([]*Repo{r}, opts.Others...) {
+		if err := repo.markTargets(r.blobs, reachable); err != nil {
+			return GCResult{}, err
+		}
+	}
+
+	stored, err := r.blobs.List()
+	if err != nil {
+		return GCResult{}, err
+	}
+	result := GCResult{Reachable: len(reachable)}
+	for _, root := range stored {
+		if _, ok := reachable[root]; ok {
+			continue
+		}
+		size, err := r.blobs.Stat(root)
+		if err != nil {
+			return GCResult{}, err
+		}
+		result.Unreferenced = append(result.Unreferenced, root)
+		result.UnreferencedBytes += size
+	}
+	sort.Strings(result.Unreferenced)
+
+	if opts.DryRun {
+		return result, nil
+	}
+	for _, root := range result.Unreferenced {
+		if err := r.blobs.Remove(root); err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// ownsBlobStore returns whether the repository's blobs are stored in its own
+// repository/blobs directory, which no other repository writes to.
+func (r *Repo) ownsBlobStore() bool {
+	d, ok := r.blobs.(*DirBlobStore)
+	if !ok {
+		return false
+	}
+	own, err := filepath.Abs(filepath.Join(r.path, "repository", "blobs"))
+	if err != nil {
+		return false
+	}
+	dir, err := filepath.Abs(d.Dir)
+	return err == nil && dir == own
+}
+
+// markTargets adds every blob in blobs reachable from the repository's staged
+// or committed package targets to reachable.
+func (r *Repo) markTargets(blobs BlobStore, reachable map[string]struct{}) error {
+	targets, err := r.Targets()
+	if err != nil {
+		return err
+	}
+	staged, err := packageTargets(targets)
+	if err != nil {
+		return err
+	}
+	committed, err := r.committedTargets()
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for _, pkgs := range []map[string]customTargetMetadata{staged, committed} {
+		for name, custom := range pkgs {
+			for _, meta := range append([]string{custom.Merkle}, custom.Subpackages...) {
+				if err := markPackage(blobs, meta, reachable); err != nil {
+					return fmt.Errorf("%s: target %s: %w", r.path, name, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// markPackage adds the given meta.far in blobs and the content blobs it lists to
+// reachable.
+func markPackage(blobs BlobStore, meta string, reachable map[string]struct{}) error {
+	if _, ok := reachable[meta]; ok {
+		return nil
+	}
+	rd, err := blobs.Open(meta)
+	if err != nil {
+		return err
+	}
+	b, err := ioutil.ReadAll(rd)
+	rd.Close()
+	if err != nil {
+		return err
+	}
+	reachable[meta] = struct{}{}
+
+	metaFar, err := far.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return fmt.Errorf("reading meta.far %s: %w", meta, err)
+	}
+	contentsBytes, err := metaFar.ReadFile("meta/contents")
+	if err != nil {
+		return fmt.Errorf("reading meta/contents of %s: %w", meta, err)
+	}
+	contents, err := build.ParseMetaContents(bytes.NewReader(contentsBytes))
+	if err != nil {
+		return fmt.Errorf("parsing meta/contents of %s: %w", meta, err)
+	}
+	for _, root := range contents {
+		reachable[root.String()] = struct{}{}
+	}
+	return nil
+}
+
+// isMerkleRoot returns true if name is a hex encoded merkle root, as opposed to
+// e.g. a temporary file left behind by an interrupted AddBlob.
+func isMerkleRoot(name string) bool {
+	b, err := hex.DecodeString(name)
+	return err == nil && len(b) == 32
+}
@@ -0,0 +1,84 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"strings"
+
+	"cloud.google.com/go/storage"
+)
+
+// GCSStorage stores objects in a Google Cloud Storage bucket, below an
+// optional prefix.
+type GCSStorage struct {
+	bucket *storage.BucketHandle
+	prefix string
+}
+
+// NewGCSStorage returns a GCSStorage for a URL of the form
+// gs://bucket[/prefix], using the default application credentials.
+func NewGCSStorage(ctx context.Context, rawURL string) (*GCSStorage, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "gs" || u.Host == "" {
+		return nil, fmt.Errorf("repo: %q is not a gs://bucket[/prefix] URL", rawURL)
+	}
+	client, err := storage.NewClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &GCSStorage{
+		bucket: client.Bucket(u.Host),
+		prefix: strings.Trim(u.Path, "/"),
+	}, nil
+}
+
+func (g *GCSStorage) object(name string) *storage.ObjectHandle {
+	return g.bucket.Object(path.Join(g.prefix, name))
+}
+
+func (g *GCSStorage) Attrs(ctx context.Context, name string) (ObjectAttrs, error) {
+	attrs, err := g.object(name).Attrs(ctx)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return ObjectAttrs{}, ErrObjectNotExist
+	}
+	if err != nil {
+		return ObjectAttrs{}, err
+	}
+	return ObjectAttrs{Size: attrs.Size, CRC32C: attrs.CRC32C}, nil
+}
+
+// Put uploads the object, having GCS reject it if its checksum does not match.
+func (g *GCSStorage) Put(ctx context.Context, name string, r io.Reader, attrs ObjectAttrs) error {
+	// Canceling the context, rather than closing the writer, abandons a
+	// failed upload.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	w := g.object(name).NewWriter(ctx)
+	w.CRC32C = attrs.CRC32C
+	w.SendCRC32C = true
+	if strings.HasSuffix(name, ".json") {
+		w.ContentType = "application/json"
+	}
+	for _, m := range topLevelMetadata {
+		if name == m {
+			// Clients must always see the latest top-level metadata.
+			w.CacheControl = "no-cache"
+		}
+	}
+	if _, err := io.Copy(w, r); err != nil {
+		return err
+	}
+	return w.Close()
+}
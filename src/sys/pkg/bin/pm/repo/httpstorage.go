@@ -0,0 +1,237 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package repo
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/upload"
+)
+
+// HTTPStorage stores objects on an HTTP server: a HEAD of "<base>/<name>"
+// returns the stored size and checksum, and a PUT stores a new object. The
+// server is either a repository served by `pm serve` with uploads enabled, or
+// any server speaking the same protocol, authenticated with a bearer token; or
+// Amazon S3, see NewS3Storage. Requests share a pool of connections, which use
+// HTTP/2 where the server supports it. Requests failing with network errors or
+// server errors are retried.
+type HTTPStorage struct {
+	base   *url.URL
+	proto  httpProtocol
+	client *http.Client
+
+	// Attempts is the number of times a request is tried before giving up.
+	Attempts int
+	// Backoff is the delay before the first retry, doubling for every
+	// following one.
+	Backoff time.Duration
+}
+
+// httpProtocol adapts HTTPStorage to the authentication and checksum headers
+// of a server.
+type httpProtocol interface {
+	// authorize authenticates a request, once all its other headers are set.
+	authorize(req *http.Request) error
+	// requestChecksum asks for the checksum of the object in a HEAD
+	// response.
+	requestChecksum(req *http.Request)
+	// checksum returns the checksum of the object in a HEAD response.
+	checksum(res *http.Response) (uint32, error)
+	setChecksum(req *http.Request, sum uint32)
+}
+
+// uploadProtocol is the protocol of `pm serve -upload`.
+type uploadProtocol struct {
+	token string
+}
+
+func (p uploadProtocol) authorize(req *http.Request) error {
+	if p.token != "" {
+		req.Header.Set("Authorization", "Bearer "+p.token)
+	}
+	return nil
+}
+
+func (uploadProtocol) requestChecksum(req *http.Request) {}
+
+func (uploadProtocol) setChecksum(req *http.Request, sum uint32) {
+	req.Header.Set(upload.ChecksumHeader, fmt.Sprintf("%08x", sum))
+}
+
+func (uploadProtocol) checksum(res *http.Response) (uint32, error) {
+	sum, err := strconv.ParseUint(res.Header.Get(upload.ChecksumHeader), 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s header: %w", upload.ChecksumHeader, err)
+	}
+	return uint32(sum), nil
+}
+
+// NewHTTPStorage returns an HTTPStorage for objects below the http or https
+// URL base, e.g. "https://host:8083/upload", keeping up to conns idle
+// connections to reuse between requests.
+func NewHTTPStorage(base, token string, conns int) (*HTTPStorage, error) {
+	u, err := url.Parse(base)
+	if err != nil {
+		return nil, err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("repo: %q is not an http(s) URL", base)
+	}
+	return newHTTPStorage(u, uploadProtocol{token: token}, conns), nil
+}
+
+func newHTTPStorage(u *url.URL, proto httpProtocol, conns int) *HTTPStorage {
+	u.Path = strings.TrimSuffix(u.Path, "/")
+	transport := &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		ForceAttemptHTTP2:   true,
+		DisableCompression:  true,
+		MaxIdleConns:        conns,
+		MaxIdleConnsPerHost: conns,
+		IdleConnTimeout:     90 * time.Second,
+		TLSHandshakeTimeout: 10 * time.Second,
+	}
+	return &HTTPStorage{
+		base:     u,
+		proto:    proto,
+		client:   &http.Client{Transport: transport},
+		Attempts: 5,
+		Backoff:  200 * time.Millisecond,
+	}
+}
+
+func (h *HTTPStorage) url(name string) string {
+	u := *h.base
+	u.Path += "/" + name
+	return u.String()
+}
+
+// do sends the request built by newRequest, retrying transient failures.
+// newRequest is called for every attempt, so it can provide a fresh body.
+func (h *HTTPStorage) do(ctx context.Context, newRequest func() (*http.Request, error)) (*http.Response, error) {
+	backoff := h.Backoff
+	var lastErr error
+	for attempt := 0; attempt < h.Attempts; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+			backoff *= 2
+		}
+		req, err := newRequest()
+		if err != nil {
+			return nil, err
+		}
+		req = req.WithContext(ctx)
+		if err := h.proto.authorize(req); err != nil {
+			return nil, err
+		}
+		res, err := h.client.Do(req)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			lastErr = err
+			continue
+		}
+		if res.StatusCode >= 500 || res.StatusCode == http.StatusTooManyRequests {
+			lastErr = responseError(req, res)
+			continue
+		}
+		return res, nil
+	}
+	return nil, lastErr
+}
+
+// responseError returns an error describing, and closes, an unsuccessful
+// response.
+func responseError(req *http.Request, res *http.Response) error {
+	defer res.Body.Close()
+	msg, _ := ioutil.ReadAll(io.LimitReader(res.Body, 512))
+	return fmt.Errorf("repo: %s %s: %s: %s", req.Method, req.URL, res.Status, bytes.TrimSpace(msg))
+}
+
+func (h *HTTPStorage) Attrs(ctx context.Context, name string) (ObjectAttrs, error) {
+	var req *http.Request
+	res, err := h.do(ctx, func() (*http.Request, error) {
+		var err error
+		req, err = http.NewRequest(http.MethodHead, h.url(name), nil)
+		if err != nil {
+			return nil, err
+		}
+		h.proto.requestChecksum(req)
+		return req, nil
+	})
+	if err != nil {
+		return ObjectAttrs{}, err
+	}
+	defer res.Body.Close()
+	switch res.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return ObjectAttrs{}, ErrObjectNotExist
+	default:
+		return ObjectAttrs{}, responseError(req, res)
+	}
+	sum, err := h.proto.checksum(res)
+	if err != nil {
+		return ObjectAttrs{}, fmt.Errorf("repo: HEAD %s: %w", req.URL, err)
+	}
+	return ObjectAttrs{Size: res.ContentLength, CRC32C: sum}, nil
+}
+
+// Put uploads the object, having the server reject it if its size or checksum
+// does not match. Unless r is an io.Seeker, its content is buffered in memory
+// so that the upload can be retried.
+func (h *HTTPStorage) Put(ctx context.Context, name string, r io.Reader, attrs ObjectAttrs) error {
+	var body io.ReadSeeker
+	if s, ok := r.(io.ReadSeeker); ok {
+		body = s
+	} else {
+		b, err := ioutil.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+	start, err := body.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+
+	var req *http.Request
+	res, err := h.do(ctx, func() (*http.Request, error) {
+		if _, err := body.Seek(start, io.SeekStart); err != nil {
+			return nil, err
+		}
+		var err error
+		req, err = http.NewRequest(http.MethodPut, h.url(name), ioutil.NopCloser(body))
+		if err != nil {
+			return nil, err
+		}
+		req.ContentLength = attrs.Size
+		h.proto.setChecksum(req, attrs.CRC32C)
+		return req, nil
+	})
+	if err != nil {
+		return err
+	}
+	if res.StatusCode/100 != 2 {
+		return responseError(req, res)
+	}
+	res.Body.Close()
+	return nil
+}
@@ -0,0 +1,279 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package repo
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	tufData "github.com/theupdateframework/go-tuf/data"
+	"github.com/theupdateframework/go-tuf/verify"
+
+	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/build"
+)
+
+// TargetConflict describes a target that is published with different package
+// merkle roots by the repositories being merged.
+type TargetConflict struct {
+	Target  string
+	Merkles map[string]string // repository directory -> merkle
+}
+
+// ErrTargetConflicts is returned by Merge if any target would be published with
+// more than one package merkle root.
+type ErrTargetConflicts struct {
+	Conflicts []TargetConflict
+}
+
+func (e ErrTargetConflicts) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "repo: %d conflicting targets:", len(e.Conflicts))
+	for _, c := range e.Conflicts {
+		dirs := make([]string, 0, len(c.Merkles))
+		for dir := range c.Merkles {
+			dirs = append(dirs, dir)
+		}
+		sort.Strings(dirs)
+		fmt.Fprintf(&b, "\n  %s:", c.Target)
+		for _, dir := range dirs {
+			fmt.Fprintf(&b, " %s in %s;", c.Merkles[dir], dir)
+		}
+	}
+	return b.String()
+}
+
+// mergeSource is a repository being merged, with its published package
+// targets and the verified blobs they reach.
+type mergeSource struct {
+	dir     string
+	targets map[string]customTargetMetadata
+	blobs   []string
+}
+
+// committedTargets reads the package targets from the committed targets.json
+// of the repository, without modifying the repository.
+func (r *Repo) committedTargets() (map[string]customTargetMetadata, error) {
+	rd, err := r.meta.OpenCommitted("targets.json")
+	if err != nil {
+		return nil, err
+	}
+	var signed tufData.Signed
+	err = json.NewDecoder(rd).Decode(&signed)
+	rd.Close()
+	if err != nil {
+		return nil, fmt.Errorf("targets.json: %w", err)
+	}
+	var targets tufData.Targets
+	if err := json.Unmarshal(signed.Signed, &targets); err != nil {
+		return nil, fmt.Errorf("targets.json: %w", err)
+	}
+	return packageTargets(targets.Targets)
+}
+
+// readVerifiedTargets reads the package targets from the committed
+// targets.json of the repository at dir, without modifying the repository,
+// after checking the signatures of its root.json and targets.json against the
+// keys and thresholds of that root.json. Expiration is not checked, as merged
+// targets are signed again with this repository's keys.
+func readVerifiedTargets(dir string) (map[string]customTargetMetadata, error) {
+	repoDir := filepath.Join(dir, "repository")
+	rootMeta, err := readSignedMetadata(filepath.Join(repoDir, "root.json"))
+	if err != nil {
+		return nil, err
+	}
+	var root tufData.Root
+	if err := json.Unmarshal(rootMeta.signed.Signed, &root); err != nil {
+		return nil, fmt.Errorf("%s: %w", dir, err)
+	}
+	db := verify.NewDB()
+	for id, key := range root.Keys {
+		if err := db.AddKey(id, key); err != nil {
+			return nil, fmt.Errorf("%s: root key %s: %w", dir, id, err)
+		}
+	}
+	for name, role := range root.Roles {
+		if err := db.AddRole(name, role); err != nil {
+			return nil, fmt.Errorf("%s: root role %s: %w", dir, name, err)
+		}
+	}
+	if err := db.VerifySignatures(&rootMeta.signed, "root"); err != nil {
+		return nil, fmt.Errorf("%s: root.json: %w", dir, err)
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(repoDir, "targets.json"))
+	if err != nil {
+		return nil, err
+	}
+	var targets tufData.Targets
+	if err := db.UnmarshalIgnoreExpired(b, &targets, "targets", 0); err != nil {
+		return nil, fmt.Errorf("%s: targets.json: %w", dir, err)
+	}
+	return packageTargets(targets.Targets)
+}
+
+// reachableBlobs returns the blobs in the repository at dir that are reachable
+// from the given package targets, in order, having checked that each matches
+// its merkle root. Every meta.far is checked before it is read.
+func reachableBlobs(dir string, targets map[string]customTargetMetadata) ([]string, error) {
+	blobsDir := filepath.Join(dir, "repository", "blobs")
+	store := &DirBlobStore{blobsDir}
+	verified := map[string]struct{}{}
+	check := func(root string) error {
+		if _, ok := verified[root]; ok {
+			return nil
+		}
+		want, err := build.DecodeMerkleRoot([]byte(root))
+		if err != nil {
+			return err
+		}
+		if err := build.VerifyBlob(filepath.Join(blobsDir, root), want, -1); err != nil {
+			return err
+		}
+		verified[root] = struct{}{}
+		return nil
+	}
+
+	names := make([]string, 0, len(targets))
+	for name := range targets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	reachable := map[string]struct{}{}
+	for _, name := range names {
+		custom := targets[name]
+		for _, meta := range append([]string{custom.Merkle}, custom.Subpackages...) {
+			if err := check(meta); err != nil {
+				return nil, fmt.Errorf("%s: target %s: %w", dir, name, err)
+			}
+			if err := markPackage(store, meta, reachable); err != nil {
+				return nil, fmt.Errorf("%s: target %s: %w", dir, name, err)
+			}
+		}
+	}
+
+	blobs := make([]string, 0, len(reachable))
+	for root := range reachable {
+		if err := check(root); err != nil {
+			return nil, fmt.Errorf("%s: %w", dir, err)
+		}
+		blobs = append(blobs, root)
+	}
+	sort.Strings(blobs)
+	return blobs, nil
+}
+
+// packageTargets returns the custom package metadata of every target that has
+// any.
+func packageTargets(files tufData.TargetFiles) (map[string]customTargetMetadata, error) {
+	pkgs := make(map[string]customTargetMetadata, len(files))
+	for name, file := range files {
+		if file.Custom == nil {
+			continue
+		}
+		var custom customTargetMetadata
+		if err := json.Unmarshal(*file.Custom, &custom); err != nil {
+			return nil, fmt.Errorf("target %s: %w", name, err)
+		}
+		if custom.Merkle == "" {
+			continue
+		}
+		pkgs[name] = custom
+	}
+	return pkgs, nil
+}
+
+// Merge adds the package targets of the repositories at the given directories,
+// and the blobs they reach, to this repository. The metadata of each
+// repository must be signed as its own root.json requires, and every blob must
+// match its merkle root. Nothing is added if any check fails or if any target
+// name would refer to different packages. The caller is responsible for committing the
+// updates, which signs the merged metadata with this repository's keys.
+func (r *Repo) Merge(dirs []string) error {
+	existing, err := r.Targets()
+	if err != nil {
+		return err
+	}
+	own, err := packageTargets(existing)
+	if err != nil {
+		return err
+	}
+
+	var sources []mergeSource
+	for _, dir := range dirs {
+		targets, err := readVerifiedTargets(dir)
+		if err != nil {
+			return err
+		}
+		blobs, err := reachableBlobs(dir, targets)
+		if err != nil {
+			return err
+		}
+		sources = append(sources, mergeSource{dir: dir, targets: targets, blobs: blobs})
+	}
+
+	// Check every target across all repositories before changing anything.
+	seen := map[string]map[string]string{}
+	for name, custom := range own {
+		seen[name] = map[string]string{r.path: custom.Merkle}
+	}
+	for _, src := range sources {
+		for name, custom := range src.targets {
+			if seen[name] == nil {
+				seen[name] = map[string]string{}
+			}
+			seen[name][src.dir] = custom.Merkle
+		}
+	}
+	var conflicts []TargetConflict
+	for name, merkles := range seen {
+		distinct := map[string]struct{}{}
+		for _, m := range merkles {
+			distinct[m] = struct{}{}
+		}
+		if len(distinct) > 1 {
+			conflicts = append(conflicts, TargetConflict{Target: name, Merkles: merkles})
+		}
+	}
+	if len(conflicts) > 0 {
+		sort.Slice(conflicts, func(i, j int) bool { return conflicts[i].Target < conflicts[j].Target })
+		return ErrTargetConflicts{Conflicts: conflicts}
+	}
+
+	for _, src := range sources {
+		blobsDir := filepath.Join(src.dir, "repository", "blobs")
+		for _, root := range src.blobs {
+			if err := r.publishBlob(root, filepath.Join(blobsDir, root), -1); err != nil {
+				return fmt.Errorf("merging blob %s from %s: %w", root, src.dir, err)
+			}
+		}
+
+		names := make([]string, 0, len(src.targets))
+		for name := range src.targets {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			custom := src.targets[name]
+			if _, ok := own[name]; ok {
+				continue
+			}
+			f, err := r.blobs.Open(custom.Merkle)
+			if err != nil {
+				return fmt.Errorf("merging target %s from %s: %w", name, src.dir, err)
+			}
+			err = r.addPackage(name, f, custom.Merkle, custom)
+			f.Close()
+			if err != nil {
+				return err
+			}
+			own[name] = custom
+		}
+	}
+	return nil
+}
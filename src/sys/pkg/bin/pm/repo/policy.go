@@ -0,0 +1,183 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package repo
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/theupdateframework/go-tuf/util"
+)
+
+const day = 24 * time.Hour
+
+// Duration is a time.Duration that is encoded in JSON as a string such as
+// "720h".
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// RolePolicy configures the signing keys and metadata expiration of a
+// top-level role.
+type RolePolicy struct {
+	// Keys is the number of keys generated for the role.
+	Keys int `json:"keys"`
+	// Threshold is the number of those keys that must sign the role metadata.
+	Threshold int `json:"threshold"`
+	// Expires is how long role metadata is valid for after it is signed.
+	Expires Duration `json:"expires"`
+}
+
+// Policy is the RolePolicy of each top-level role of a repository.
+type Policy map[string]RolePolicy
+
+// ErrInvalidPolicy is returned when a Policy cannot be applied to a repository.
+type ErrInvalidPolicy struct {
+	Role   string
+	Reason string
+}
+
+func (e ErrInvalidPolicy) Error() string {
+	return fmt.Sprintf("repo: invalid policy for role %q: %s", e.Role, e.Reason)
+}
+
+// DefaultPolicy returns the policy of development repositories: a single key
+// per role, root and targets metadata that are valid for a year and three
+// months respectively, and snapshot and timestamp metadata valid for 30 days.
+func DefaultPolicy() Policy {
+	return Policy{
+		"root":      {Keys: 1, Threshold: 1, Expires: Duration(365 * day)},
+		"targets":   {Keys: 1, Threshold: 1, Expires: Duration(90 * day)},
+		"snapshot":  {Keys: 1, Threshold: 1, Expires: Duration(30 * day)},
+		"timestamp": {Keys: 1, Threshold: 1, Expires: Duration(30 * day)},
+	}
+}
+
+// Validate returns an error unless p configures every top-level role with a
+// positive threshold that its keys can meet, and a positive expiration.
+func (p Policy) Validate() error {
+	for role := range p {
+		if role != "root" && !contains(roles, role) {
+			return ErrInvalidPolicy{role, "not a top-level role"}
+		}
+	}
+	for _, role := range append([]string{"root"}, roles...) {
+		rp, ok := p[role]
+		switch {
+		case !ok:
+			return ErrInvalidPolicy{role, "missing"}
+		case rp.Threshold < 1:
+			return ErrInvalidPolicy{role, "threshold must be at least 1"}
+		case rp.Keys < rp.Threshold:
+			return ErrInvalidPolicy{role, fmt.Sprintf("%d keys cannot meet threshold %d", rp.Keys, rp.Threshold)}
+		case rp.Expires <= 0:
+			return ErrInvalidPolicy{role, "expiration must be positive"}
+		}
+	}
+	return nil
+}
+
+// expires returns the expiration of role metadata signed now.
+func (p Policy) expires(role string) time.Time {
+	// TUF-1.0 section 4.4.2 states that the expiration must be in the
+	// ISO-8601 format in the UTC timezone with no nanoseconds.
+	return time.Now().Add(time.Duration(p[role].Expires)).UTC().Round(time.Second)
+}
+
+func contains(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Repo) policyPath() string {
+	return filepath.Join(r.path, "policy.json")
+}
+
+// loadPolicy reads the policy of the repository, falling back to the default
+// policy for repositories created without one.
+func (r *Repo) loadPolicy() error {
+	if r.path == "" {
+		r.policy = DefaultPolicy()
+		return nil
+	}
+	b, err := ioutil.ReadFile(r.policyPath())
+	if os.IsNotExist(err) {
+		r.policy = DefaultPolicy()
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	policy := DefaultPolicy()
+	if err := json.Unmarshal(b, &policy); err != nil {
+		return fmt.Errorf("%s: %w", r.policyPath(), err)
+	}
+	if err := policy.Validate(); err != nil {
+		return fmt.Errorf("%s: %w", r.policyPath(), err)
+	}
+	r.policy = policy
+	return nil
+}
+
+// Policy returns the key and expiration policy of the repository.
+func (r *Repo) Policy() Policy {
+	return r.policy
+}
+
+// InitWithPolicy is Init, generating keys for a new repository and setting the
+// expiration of its metadata as the given policy configures.
+func (r *Repo) InitWithPolicy(p Policy) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	if r.hasCommittedRoot() {
+		return os.ErrExist
+	}
+	r.policy = p
+	return r.Init()
+}
+
+// SetPolicy sets the policy used to generate keys when the repository is
+// initialized, and to set the expiration of metadata it signs. The policy is
+// saved with the repository, so it applies to all later publishing.
+func (r *Repo) SetPolicy(p Policy) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	if r.path != "" {
+		if err := util.AtomicallyWriteFile(r.policyPath(), append(b, '\n'), 0644); err != nil {
+			return err
+		}
+	}
+	r.policy = p
+	return nil
+}
@@ -0,0 +1,93 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package repo
+
+import (
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// PackageInfo describes a package published in a repository.
+type PackageInfo struct {
+	// Name is the package name.
+	Name string `json:"name"`
+	// Variant is the package variant, e.g. "0".
+	Variant string `json:"variant"`
+	// Merkle is the merkle root of the package meta.far.
+	Merkle string `json:"merkle"`
+	// Size is the size of the package meta.far.
+	Size int64 `json:"size"`
+	// Published is when the package was published, if the repository
+	// recorded it.
+	Published *time.Time `json:"published,omitempty"`
+	// Subpackages are the meta.far merkle roots of the packages reachable
+	// through the subpackages of the package.
+	Subpackages []string `json:"subpackages,omitempty"`
+}
+
+// ListPackages returns the packages in the current, possibly staged, targets
+// metadata whose name matches one of the given path.Match patterns, or all of
+// them if no pattern is given. The packages are sorted by name, then variant.
+func (r *Repo) ListPackages(patterns ...string) ([]PackageInfo, error) {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, err
+		}
+	}
+
+	targets, err := r.Targets()
+	if err != nil {
+		return nil, err
+	}
+	pkgs, err := packageTargets(targets)
+	if err != nil {
+		return nil, err
+	}
+
+	infos := []PackageInfo{}
+	for target, custom := range pkgs {
+		name, variant := target, ""
+		if i := strings.LastIndex(target, "/"); i >= 0 {
+			name, variant = target[:i], target[i+1:]
+		}
+		if !matchesAny(name, patterns) {
+			continue
+		}
+		info := PackageInfo{
+			Name:        name,
+			Variant:     variant,
+			Merkle:      custom.Merkle,
+			Size:        custom.Size,
+			Subpackages: custom.Subpackages,
+		}
+		if custom.Published != 0 {
+			published := time.Unix(custom.Published, 0).UTC()
+			info.Published = &published
+		}
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		if infos[i].Name != infos[j].Name {
+			return infos[i].Name < infos[j].Name
+		}
+		return infos[i].Variant < infos[j].Variant
+	})
+	return infos, nil
+}
+
+func matchesAny(name string, patterns []string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		// The patterns were validated by ListPackages.
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
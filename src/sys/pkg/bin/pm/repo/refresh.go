@@ -0,0 +1,116 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package repo
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	tuf "github.com/theupdateframework/go-tuf"
+	"github.com/theupdateframework/go-tuf/sign"
+)
+
+// Expirations returns the expiration of the current, possibly staged,
+// metadata of each top-level role.
+func (r *Repo) Expirations() (map[string]time.Time, error) {
+	expirations := map[string]time.Time{}
+	for _, role := range append([]string{"root"}, roles...) {
+		signed, err := r.SignedMeta(role + ".json")
+		if err != nil {
+			return nil, err
+		}
+		var meta struct {
+			Expires time.Time `json:"expires"`
+		}
+		if err := json.Unmarshal(signed.Signed, &meta); err != nil {
+			return nil, fmt.Errorf("%s.json: %w", role, err)
+		}
+		expirations[role] = meta.Expires
+	}
+	return expirations, nil
+}
+
+// Refresh re-signs the metadata of the top-level roles that expire before the
+// given deadline, with the expiration the repository policy configures and
+// without changing its content. As the snapshot and timestamp metadata
+// describe the other metadata, they are re-signed whenever anything is. The
+// roles whose metadata was re-signed are returned, in the order of root,
+// targets, snapshot and timestamp.
+//
+// Refreshing root metadata requires the root keys.
+func (r *Repo) Refresh(deadline time.Time, dateVersioning bool) ([]string, error) {
+	expirations, err := r.Expirations()
+	if err != nil {
+		return nil, err
+	}
+	expiring := map[string]bool{}
+	for role, expires := range expirations {
+		if expires.Before(deadline) {
+			expiring[role] = true
+		}
+	}
+	if len(expiring) == 0 {
+		return nil, nil
+	}
+
+	var refreshed []string
+	if expiring["root"] {
+		if err := r.refreshRoot(); err != nil {
+			return nil, fmt.Errorf("refreshing root metadata: %w", err)
+		}
+		refreshed = append(refreshed, "root")
+	}
+	if expiring["targets"] {
+		// Adding no targets signs a new version of the targets metadata.
+		if err := r.AddTargets([]string{}, json.RawMessage{}); err != nil {
+			return nil, fmt.Errorf("refreshing targets metadata: %w", err)
+		}
+		refreshed = append(refreshed, "targets")
+	}
+	if err := r.CommitUpdates(dateVersioning); err != nil {
+		return nil, err
+	}
+	return append(refreshed, "snapshot", "timestamp"), nil
+}
+
+// refreshRoot stages a new version of the root metadata with a new expiration.
+// The TUF library only sets the root expiration when keys change, so the new
+// version is signed here and the library reopened to pick it up.
+func (r *Repo) refreshRoot() error {
+	root, err := r.rootMetadata()
+	if err != nil {
+		return err
+	}
+	root.Version++
+	root.Expires = r.policy.expires("root")
+
+	signers, err := r.meta.GetSigners("root")
+	if err != nil {
+		return err
+	}
+	if len(signers) == 0 {
+		return tuf.ErrInsufficientKeys{Name: "root.json"}
+	}
+	signed, err := sign.Marshal(root, signers...)
+	if err != nil {
+		return err
+	}
+	// The signed portion is already in canonical form.
+	b, err := json.Marshal(signed)
+	if err != nil {
+		return err
+	}
+	if err := r.meta.SetMeta("root.json", b); err != nil {
+		return err
+	}
+
+	repo, err := tuf.NewRepo(r.meta, "sha512")
+	if err != nil {
+		return err
+	}
+	r.Repo = repo
+	return nil
+}
@@ -8,7 +8,6 @@ import (
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
-	"crypto/sha512"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
@@ -17,6 +16,8 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
+	"sync"
 	"syscall"
 	"time"
 
@@ -40,8 +41,15 @@ func NewAddErr(m string, e error) ErrFileAddFailed {
 }
 
 type customTargetMetadata struct {
-	Merkle string `json:"merkle"`
-	Size   int64  `json:"size"`
+	Merkle   string            `json:"merkle"`
+	Size     int64             `json:"size"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+	// Subpackages lists the meta.far merkle roots of every package reachable
+	// through the subpackages of this package.
+	Subpackages []string `json:"subpackages,omitempty"`
+	// Published is when the package was published, in seconds since the Unix
+	// epoch.
+	Published int64 `json:"published,omitempty"`
 }
 
 // TimeProvider provides the service to get Unix timestamp.
@@ -50,12 +58,27 @@ type TimeProvider interface {
 	UnixTimestamp() int
 }
 
+// PublishStats records how much blob content was written to, and how much was
+// skipped because it was already present in, the repository blob store.
+type PublishStats struct {
+	BlobsWritten int
+	BytesWritten int64
+	BlobsSkipped int
+	BytesSkipped int64
+}
+
 type Repo struct {
 	*tuf.Repo
 	path          string
-	blobsDir      string
+	meta          MetadataStore
+	blobs         BlobStore
 	encryptionKey []byte
 	timeProvider  TimeProvider
+	policy        Policy
+
+	// statsMu guards stats, which blobs published concurrently update.
+	statsMu sync.Mutex
+	stats   PublishStats
 }
 
 var NotCreatingNonExistentRepoError = errors.New("repo does not exist and createIfNotExist is false, so not creating one")
@@ -85,19 +108,34 @@ func New(path, blobsDir string) (*Repo, error) {
 		return nil, fmt.Errorf("repository path %q: %w", path, syscall.ENOTDIR)
 	}
 
-	repo, err := tuf.NewRepo(tuf.FileSystemStore(path, passphrase), "sha512")
-	if err != nil {
+	if err := os.MkdirAll(blobsDir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Join(path, "staged", "targets"), os.ModePerm); err != nil {
 		return nil, err
 	}
-	r := &Repo{repo, path, blobsDir, nil, &SystemTimeProvider{}}
 
-	if err := os.MkdirAll(blobsDir, os.ModePerm); err != nil {
+	return NewWithStores(path, FileSystemMetadataStore(path), &DirBlobStore{blobsDir})
+}
+
+// NewWithStores initializes a new Repo structure that reads and writes metadata
+// and blobs in the given stores. The repository policy is read from, and
+// written to, the given path, or only kept in memory if the path is empty.
+func NewWithStores(path string, meta MetadataStore, blobs BlobStore) (*Repo, error) {
+	repo, err := tuf.NewRepo(meta, "sha512")
+	if err != nil {
 		return nil, err
 	}
-	if err := os.MkdirAll(r.stagedFilesPath(), os.ModePerm); err != nil {
+	r := &Repo{
+		Repo:         repo,
+		path:         path,
+		meta:         meta,
+		blobs:        blobs,
+		timeProvider: &SystemTimeProvider{},
+	}
+	if err := r.loadPolicy(); err != nil {
 		return nil, err
 	}
-
 	return r, nil
 }
 
@@ -122,7 +160,7 @@ func (r *Repo) Init() error {
 // location and createIfNotExists is true.
 // If a repository already exists, either os.ErrExist, or a TUF error are returned.
 func (r *Repo) OptionallyInitAtLocation(createIfNotExists bool) error {
-	if _, err := os.Stat(filepath.Join(r.path, "repository", "root.json")); err == nil {
+	if r.hasCommittedRoot() {
 		return os.ErrExist
 	}
 
@@ -141,53 +179,99 @@ func (r *Repo) OptionallyInitAtLocation(createIfNotExists bool) error {
 
 	rk, err := r.Repo.RootKeys()
 	if err != nil || len(rk) == 0 {
-		err = r.GenKeys()
+		if err := r.GenKeys(); err != nil {
+			return err
+		}
 	}
 
-	return err
+	// Record the policy the repository was created with, so later publishing
+	// follows it.
+	return r.SetPolicy(r.policy)
+}
+
+// hasCommittedRoot returns whether the repository has committed root metadata,
+// and so has been initialized.
+func (r *Repo) hasCommittedRoot() bool {
+	rd, err := r.meta.OpenCommitted("root.json")
+	if err != nil {
+		return false
+	}
+	rd.Close()
+	return true
 }
 
 // GenKeys will generate a full suite of the necessary keys for signing a
-// repository.
+// repository, with as many keys and the signature threshold for each role
+// that the repository policy configures.
 func (r *Repo) GenKeys() error {
-	if _, err := r.GenKey("root"); err != nil {
-		return err
-	}
-	for _, role := range roles {
-		if _, err := r.GenKey(role); err != nil {
+	for _, role := range append([]string{"root"}, roles...) {
+		for i := 0; i < r.policy[role].Keys; i++ {
+			if _, err := r.GenKeyWithExpires(role, r.policy.expires("root")); err != nil {
+				return err
+			}
+		}
+		if err := r.SetThreshold(role, r.policy[role].Threshold); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
+// AddTargets is tuf.Repo.AddTargets, with the targets metadata expiring as the
+// repository policy configures.
+func (r *Repo) AddTargets(paths []string, custom json.RawMessage) error {
+	return r.AddTargetsWithExpires(paths, custom, r.policy.expires("targets"))
+}
+
+// RemoveTargets is tuf.Repo.RemoveTargets, with the targets metadata expiring as
+// the repository policy configures.
+func (r *Repo) RemoveTargets(paths []string) error {
+	return r.RemoveTargetsWithExpires(paths, r.policy.expires("targets"))
+}
+
 // AddPackage adds a package with the given name with the content from the given
 // reader. The package blob is also added. If merkle is non-empty, it is used,
 // otherwise the package merkleroot is computed on the fly.
 func (r *Repo) AddPackage(name string, rd io.Reader, merkle string) error {
+	return r.addPackage(name, rd, merkle, customTargetMetadata{})
+}
+
+// addPackage is AddPackage, additionally recording the package metadata and
+// subpackages of custom in the target's custom metadata.
+func (r *Repo) addPackage(name string, rd io.Reader, merkle string, custom customTargetMetadata) error {
 	root, size, err := r.AddBlob(merkle, rd)
 	if err != nil {
 		return NewAddErr("adding package blob", err)
 	}
 
-	stagingPath := filepath.Join(r.stagedFilesPath(), name)
-	os.MkdirAll(filepath.Dir(stagingPath), os.ModePerm)
-
 	// add merkle root as custom JSON
-	metadata := customTargetMetadata{Merkle: root, Size: size}
+	metadata := customTargetMetadata{
+		Merkle:      root,
+		Size:        size,
+		Metadata:    custom.Metadata,
+		Subpackages: custom.Subpackages,
+		Published:   custom.Published,
+	}
+	if metadata.Published == 0 {
+		metadata.Published = int64(r.timeProvider.UnixTimestamp())
+	}
 	jsonStr, err := json.Marshal(metadata)
 	if err != nil {
 		return NewAddErr(fmt.Sprintf("serializing %v", metadata), err)
 	}
 
-	blobPath := filepath.Join(r.blobsDir, root)
-
-	if err := linkOrCopy(blobPath, stagingPath); err != nil {
+	blob, err := r.blobs.Open(root)
+	if err != nil {
+		return NewAddErr("opening package blob", err)
+	}
+	err = r.meta.StageTarget(name, blob)
+	blob.Close()
+	if err != nil {
 		return NewAddErr("creating file in staging directory", err)
 	}
 
 	// add file with custom JSON to repository
-	if err := r.AddTarget(name, json.RawMessage(jsonStr)); err != nil {
+	if err := r.AddTargetWithExpires(name, json.RawMessage(jsonStr), r.policy.expires("targets")); err != nil {
 		return fmt.Errorf("failed adding target %s to TUF repo: %s", name, err)
 	}
 
@@ -213,9 +297,79 @@ func cryptingWriter(dst io.Writer, key []byte) (io.WriteCloser, error) {
 // HasBlob returns true if the given merkleroot is already in the repository
 // blob store.
 func (r *Repo) HasBlob(root string) bool {
-	blobPath := filepath.Join(r.blobsDir, root)
-	fi, err := os.Stat(blobPath)
-	return err == nil && fi.Mode().IsRegular()
+	_, err := r.blobs.Stat(root)
+	return err == nil
+}
+
+// Stats returns the blob statistics accumulated by this Repo since it was
+// created.
+func (r *Repo) Stats() PublishStats {
+	r.statsMu.Lock()
+	defer r.statsMu.Unlock()
+	return r.stats
+}
+
+func (r *Repo) countWritten(size int64) {
+	r.statsMu.Lock()
+	defer r.statsMu.Unlock()
+	r.stats.BlobsWritten++
+	r.stats.BytesWritten += size
+}
+
+func (r *Repo) countSkipped(size int64) {
+	r.statsMu.Lock()
+	defer r.statsMu.Unlock()
+	r.stats.BlobsSkipped++
+	r.stats.BytesSkipped += size
+}
+
+// skipBlob records that the blob identified by the given merkleroot was
+// already in the repository blob store and did not need to be written.
+func (r *Repo) skipBlob(root string) {
+	var size int64
+	if n, err := r.blobs.Stat(root); err == nil {
+		size = n
+		if r.encryptionKey != nil {
+			size -= aes.BlockSize
+		}
+	}
+	r.countSkipped(size)
+}
+
+// publishBlob adds the blob identified by the given merkleroot from the file
+// at sourcePath, without opening the source if the blob store already has it.
+// The source must match the merkle root, and size unless it is negative.
+func (r *Repo) publishBlob(root, sourcePath string, size int64) error {
+	if r.HasBlob(root) {
+		r.skipBlob(root)
+		return nil
+	}
+	want, err := build.DecodeMerkleRoot([]byte(root))
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(sourcePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, _, err = r.writeBlob(func(dst io.Writer) (string, int64, error) {
+		cw := &countingWriter{w: dst}
+		err := build.VerifyBlobReader(sourcePath, io.TeeReader(f, cw), want, size)
+		return root, cw.n, err
+	})
+	return err
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
 }
 
 // AddBlob writes the content of the given reader to the blob identified by the
@@ -224,56 +378,54 @@ func (r *Repo) HasBlob(root string) bool {
 // blob encryption is used.
 func (r *Repo) AddBlob(root string, rd io.Reader) (string, int64, error) {
 	if root != "" {
-		dstPath := filepath.Join(r.blobsDir, root)
-		if fi, err := os.Stat(dstPath); err == nil {
-			fileSize := fi.Size()
-
+		if fileSize, err := r.blobs.Stat(root); err == nil {
 			if r.encryptionKey != nil {
 				fileSize -= aes.BlockSize
 			}
 
+			r.countSkipped(fileSize)
 			return root, fileSize, nil
 		}
+	}
 
-		var dst io.WriteCloser
-		var err error
-		dst, err = os.OpenFile(dstPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0666)
-		if err != nil {
-			return root, 0, err
+	return r.writeBlob(func(dst io.Writer) (string, int64, error) {
+		if root != "" {
+			n, err := io.Copy(dst, rd)
+			return root, n, err
 		}
-		defer dst.Close()
-		if r.encryptionKey != nil {
-			dst, err = cryptingWriter(dst, r.encryptionKey)
-			if err != nil {
-				return root, 0, err
-			}
-		}
-		n, err := io.Copy(dst, rd)
-		return root, n, err
-	}
+		var tree merkle.Tree
+		n, err := tree.ReadFrom(io.TeeReader(rd, dst))
+		return hex.EncodeToString(tree.Root()), n, err
+	})
+}
 
-	var tree merkle.Tree
-	f, err := ioutil.TempFile(r.blobsDir, "blob")
+// writeBlob stores the plaintext content that write writes as the blob with
+// the merkle root that write returns. Nothing is stored if write fails.
+func (r *Repo) writeBlob(write func(dst io.Writer) (string, int64, error)) (string, int64, error) {
+	w, err := r.blobs.Create()
 	if err != nil {
 		return "", 0, err
 	}
 
-	var dst io.WriteCloser = f
+	var dst io.Writer = w
 	if r.encryptionKey != nil {
 		dst, err = cryptingWriter(dst, r.encryptionKey)
 		if err != nil {
+			w.Abort()
 			return "", 0, err
 		}
 	}
 
-	n, err := tree.ReadFrom(io.TeeReader(rd, dst))
+	root, n, err := write(dst)
 	if err != nil {
-		f.Close()
-		return "", n, err
+		w.Abort()
+		return root, n, err
 	}
-	f.Close()
-	root = hex.EncodeToString(tree.Root())
-	return root, n, os.Rename(f.Name(), filepath.Join(r.blobsDir, root))
+	if err := w.Commit(root); err != nil {
+		return root, n, err
+	}
+	r.countWritten(n)
+	return root, n, nil
 }
 
 // CommitUpdates finalizes the changes to the update repository that have been
@@ -323,6 +475,27 @@ func (r *Repo) hasTarget(name, version, merkle string, targets tufData.TargetFil
 	return custom.Merkle == merkle, nil
 }
 
+// PackageMerkles returns the names of the package targets in the repository,
+// keyed by their meta.far merkle root.
+func (r *Repo) PackageMerkles() (map[string]string, error) {
+	targets, err := r.Targets()
+	if err != nil {
+		return nil, err
+	}
+	merkles := make(map[string]string, len(targets))
+	for name, target := range targets {
+		if target.Custom == nil {
+			continue
+		}
+		var custom customTargetMetadata
+		if err := json.Unmarshal(*target.Custom, &custom); err != nil {
+			return nil, fmt.Errorf("target %s: %w", name, err)
+		}
+		merkles[custom.Merkle] = name
+	}
+	return merkles, nil
+}
+
 // PublishManifests publishes the packages and blobs identified in the package
 // output manifests at the given paths, returning all input files involved, or an
 // error.
@@ -333,7 +506,7 @@ func (r *Repo) PublishManifests(paths []string) ([]string, error) {
 	}
 	var deps []string
 	for _, path := range paths {
-		pkgDeps, err := r.publishManifest(path, targets)
+		pkgDeps, err := r.publishManifest(path, targets, nil)
 		if err != nil {
 			return nil, err
 		}
@@ -350,13 +523,14 @@ func (r *Repo) PublishManifest(path string) ([]string, error) {
 	if err != nil {
 		return nil, err
 	}
-	return r.publishManifest(path, targets)
+	return r.publishManifest(path, targets, nil)
 }
 
 // publishManifest publishes the package and blobs identified in the package
 // output manifest at the given path, using a pre-loaded targets, and returning
-// all input files involved, or an error.
-func (r *Repo) publishManifest(path string, targets tufData.TargetFiles) ([]string, error) {
+// all input files involved, or an error. The meta.far merkle roots of any
+// subpackages are recorded in the package target.
+func (r *Repo) publishManifest(path string, targets tufData.TargetFiles, subpackages []string) ([]string, error) {
 	deps := []string{path}
 	packageManifest, err := build.LoadPackageManifest(path)
 	if err != nil {
@@ -384,26 +558,9 @@ func (r *Repo) publishManifest(path string, targets tufData.TargetFiles) ([]stri
 	// publish the package if it's not already in targets.json
 	for _, blob := range packageManifest.Blobs {
 		if blob.Path == "meta/" {
-			p := packageManifest.Package
-			if err := p.Validate(); err != nil {
-				return nil, fmt.Errorf("Validate() failed: %v", err)
-			}
-			name := p.Name + "/" + p.Version
-			f, err := os.Open(blob.SourcePath)
-			if err != nil {
-				return nil, err
-			}
-			err = r.AddPackage(name, f, blob.Merkle.String())
-			f.Close()
+			err = r.addManifestPackage(packageManifest, blob, subpackages)
 		} else {
-			if !r.HasBlob(blob.Merkle.String()) {
-				f, err := os.Open(blob.SourcePath)
-				if err != nil {
-					return nil, err
-				}
-				_, _, err = r.AddBlob(blob.Merkle.String(), f)
-				f.Close()
-			}
+			err = r.publishBlob(blob.Merkle.String(), blob.SourcePath, int64(blob.Size))
 		}
 		if err != nil {
 			return nil, err
@@ -412,43 +569,156 @@ func (r *Repo) publishManifest(path string, targets tufData.TargetFiles) ([]stri
 	return deps, nil
 }
 
-func (r *Repo) commitUpdates() error {
-	// TUF-1.0 section 4.4.2 states that the expiration must be in the
-	// ISO-8601 format in the UTC timezone with no nanoseconds.
-	expires := time.Now().AddDate(0, 0, 30).UTC().Round(time.Second)
-	if err := r.SnapshotWithExpires(expires); err != nil {
-		return fmt.Errorf("snapshot: %s", err)
+// addManifestPackage adds the package target of a package manifest, once its
+// content blobs are published, recording the given subpackage meta.far merkle
+// roots. The meta.far is checked against the merkle root in the manifest.
+func (r *Repo) addManifestPackage(m *build.PackageManifest, meta build.PackageBlobInfo, subpackages []string) error {
+	p := m.Package
+	if err := p.Validate(); err != nil {
+		return fmt.Errorf("Validate() failed: %v", err)
 	}
-	if err := r.TimestampWithExpires(expires); err != nil {
-		return fmt.Errorf("timestamp: %s", err)
+	if err := build.VerifyBlob(meta.SourcePath, meta.Merkle, int64(meta.Size)); err != nil {
+		return err
 	}
-	if err := r.Commit(); err != nil {
-		return fmt.Errorf("commit: %s", err)
+	f, err := os.Open(meta.SourcePath)
+	if err != nil {
+		return err
 	}
-
-	return r.fixupRootConsistentSnapshot()
+	defer f.Close()
+	return r.addPackage(p.Name+"/"+p.Version, f, meta.Merkle.String(), customTargetMetadata{
+		Metadata:    m.Metadata,
+		Subpackages: subpackages,
+	})
 }
 
-func (r *Repo) stagedFilesPath() string {
-	return filepath.Join(r.path, "staged", "targets")
+// PublishManifestWithSubpackages publishes the package and blobs identified
+// in the package output manifest at the given path, together with the blobs of
+// every package reachable through its subpackages, returning all input files
+// involved, or an error. Every manifest is loaded and checked before anything
+// is added, and the package target is only added once all the blobs it refers
+// to are in the repository.
+func (r *Repo) PublishManifestWithSubpackages(path string) ([]string, error) {
+	closure, err := build.LoadPackageManifestClosure(path)
+	if err != nil {
+		return nil, err
+	}
+	targets, err := r.Targets()
+	if err != nil {
+		return nil, err
+	}
+
+	subpackagePaths := make([]string, 0, len(closure))
+	for p := range closure {
+		if p != path {
+			subpackagePaths = append(subpackagePaths, p)
+		}
+	}
+	sort.Strings(subpackagePaths)
+
+	// The closure has checked every subpackage meta.far against the merkle
+	// root its parent declares, so the declared roots identify the closure.
+	seen := map[string]struct{}{}
+	var subpackages []string
+	for _, m := range closure {
+		for _, sub := range m.Subpackages {
+			if _, ok := seen[sub.Merkle.String()]; !ok {
+				seen[sub.Merkle.String()] = struct{}{}
+				subpackages = append(subpackages, sub.Merkle.String())
+			}
+		}
+	}
+	sort.Strings(subpackages)
+
+	var deps []string
+	for _, p := range subpackagePaths {
+		deps = append(deps, p)
+		for _, blob := range closure[p].Blobs {
+			deps = append(deps, blob.SourcePath)
+			if err := r.publishBlob(blob.Merkle.String(), blob.SourcePath, int64(blob.Size)); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	pkgDeps, err := r.publishManifest(path, targets, subpackages)
+	if err != nil {
+		return nil, err
+	}
+	return append(pkgDeps, deps...), nil
 }
 
-// when the repository is "pre-initialized" by a root.json from the build, but
-// no root keys are available to the publishing step, the commit process does
-// not produce a consistent snapshot file for the root json manifest. This
-// method implements that production.
-func (r *Repo) fixupRootConsistentSnapshot() error {
-	b, err := ioutil.ReadFile(filepath.Join(r.path, "repository", "root.json"))
+// PublishArchive publishes the package and blobs contained in the given
+// package archive, skipping the package if it is already published.
+func (r *Repo) PublishArchive(archive *build.PackageArchive) error {
+	targets, err := r.Targets()
+	if err != nil {
+		return err
+	}
+
+	p := archive.Package()
+	if err := p.Validate(); err != nil {
+		return fmt.Errorf("Validate() failed: %v", err)
+	}
+	metaMerkle := archive.MetaMerkle()
+	targetExists, err := r.hasTarget(p.Name, p.Version, metaMerkle.String(), targets)
 	if err != nil {
 		return err
 	}
-	sum512 := sha512.Sum512(b)
-	rootSnap := filepath.Join(r.path, "repository", fmt.Sprintf("%x.root.json", sum512))
-	if _, err := os.Stat(rootSnap); os.IsNotExist(err) {
-		if err := ioutil.WriteFile(rootSnap, b, 0666); err != nil {
+	if targetExists {
+		return nil
+	}
+
+	for _, root := range archive.Blobs() {
+		if root == metaMerkle {
+			continue
+		}
+		if r.HasBlob(root.String()) {
+			r.skipBlob(root.String())
+			continue
+		}
+		rd, err := openVerifiedArchiveBlob(archive, root)
+		if err != nil {
+			return err
+		}
+		if _, _, err := r.AddBlob(root.String(), rd); err != nil {
 			return err
 		}
 	}
+
+	rd, err := openVerifiedArchiveBlob(archive, metaMerkle)
+	if err != nil {
+		return err
+	}
+	return r.AddPackage(p.Name+"/"+p.Version, rd, metaMerkle.String())
+}
+
+// openVerifiedArchiveBlob opens the given blob of the archive after checking
+// that its content matches its merkle root, since AddBlob trusts the root it
+// is given.
+func openVerifiedArchiveBlob(archive *build.PackageArchive, root build.MerkleRoot) (io.Reader, error) {
+	rd, err := archive.OpenBlob(root)
+	if err != nil {
+		return nil, err
+	}
+	if err := build.VerifyBlobReader("package archive blob "+root.String(), rd, root, rd.Size()); err != nil {
+		return nil, err
+	}
+	if _, err := rd.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return rd, nil
+}
+
+func (r *Repo) commitUpdates() error {
+	if err := r.SnapshotWithExpires(r.policy.expires("snapshot")); err != nil {
+		return fmt.Errorf("snapshot: %s", err)
+	}
+	if err := r.TimestampWithExpires(r.policy.expires("timestamp")); err != nil {
+		return fmt.Errorf("timestamp: %s", err)
+	}
+	if err := r.Commit(); err != nil {
+		return fmt.Errorf("commit: %s", err)
+	}
 	return nil
 }
 
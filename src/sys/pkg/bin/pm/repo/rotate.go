@@ -0,0 +1,193 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package repo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	tuf "github.com/theupdateframework/go-tuf"
+	tufData "github.com/theupdateframework/go-tuf/data"
+	"github.com/theupdateframework/go-tuf/encrypted"
+	"github.com/theupdateframework/go-tuf/pkg/keys"
+)
+
+// persistedKeys mirrors the format of the go-tuf key store files.
+type persistedKeys struct {
+	Encrypted bool            `json:"encrypted"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// rootMetadata returns the current, possibly staged, root metadata.
+func (r *Repo) rootMetadata() (*tufData.Root, error) {
+	signed, err := r.SignedMeta("root.json")
+	if err != nil {
+		return nil, err
+	}
+	var root tufData.Root
+	if err := json.Unmarshal(signed.Signed, &root); err != nil {
+		return nil, err
+	}
+	return &root, nil
+}
+
+// RotateKeys replaces the keys of the given top-level roles with newly
+// generated ones, and commits metadata signed with the new keys. As TUF
+// requires for clients to trust it, the new root.json is signed by both the old
+// and the new root keys. The private keys that were replaced are then removed
+// from the key store, so later metadata is signed only with the new keys.
+//
+// Fuchsia repositories do not use delegated targets, so only top-level
+// metadata is re-signed. Keys can only be rotated in repositories that keep
+// their keys in the file system.
+func (r *Repo) RotateKeys(roles []string, dateVersioning bool) error {
+	if _, ok := r.meta.(*fileSystemMetadataStore); !ok {
+		return errors.New("repo: key rotation requires a file system metadata store")
+	}
+	root, err := r.rootMetadata()
+	if err != nil {
+		return err
+	}
+	rotateTargets := false
+	for _, role := range roles {
+		if _, ok := root.Roles[role]; !ok {
+			return fmt.Errorf("repo: cannot rotate keys of unknown role %q", role)
+		}
+		if role == "targets" {
+			rotateTargets = true
+		}
+	}
+
+	// The key store only signs root.json with the root keys it has loaded, and
+	// generating a key does not load the existing ones. Re-signing root.json
+	// loads them, so the new root is also signed by the old keys.
+	if err := r.Sign("root.json"); err != nil {
+		return err
+	}
+
+	for _, role := range roles {
+		oldIDs := append([]string(nil), root.Roles[role].KeyIDs...)
+		for i := 0; i < r.policy[role].Keys; i++ {
+			if _, err := r.GenKeyWithExpires(role, r.policy.expires("root")); err != nil {
+				return fmt.Errorf("generating %s key: %w", role, err)
+			}
+		}
+		for _, id := range oldIDs {
+			// A key may have several IDs, all of which are revoked with
+			// the first.
+			if err := r.RevokeKey(role, id); err != nil && !errors.As(err, &tuf.ErrKeyNotFound{}) {
+				return fmt.Errorf("revoking %s key %s: %w", role, id, err)
+			}
+		}
+	}
+
+	if rotateTargets {
+		// Re-sign targets.json by writing a new version of it.
+		v, err := r.TargetsVersion()
+		if err != nil {
+			return err
+		}
+		if err := r.SetTargetsVersion(v + 1); err != nil {
+			return err
+		}
+	}
+	if err := r.CommitUpdates(dateVersioning); err != nil {
+		return err
+	}
+
+	root, err = r.rootMetadata()
+	if err != nil {
+		return err
+	}
+	for _, role := range roles {
+		if err := r.retireKeys(role, root.Roles[role].KeyIDs); err != nil {
+			return fmt.Errorf("removing old %s keys: %w", role, err)
+		}
+	}
+
+	// Reopen the TUF repository, as the key store caches the signers it has
+	// loaded.
+	r.meta = FileSystemMetadataStore(r.path)
+	repo, err := tuf.NewRepo(r.meta, "sha512")
+	if err != nil {
+		return err
+	}
+	r.Repo = repo
+	return nil
+}
+
+// retireKeys removes the private keys of the given role from the key store,
+// except for those with one of the given IDs.
+func (r *Repo) retireKeys(role string, keep []string) error {
+	path := filepath.Join(r.path, "keys", role+".json")
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var pk persistedKeys
+	if err := json.Unmarshal(b, &pk); err != nil {
+		return err
+	}
+	pass, err := passphrase(role, false)
+	if err != nil {
+		return err
+	}
+	var privateKeys []*tufData.PrivateKey
+	if pk.Encrypted {
+		err = encrypted.Unmarshal(pk.Data, &privateKeys, pass)
+	} else {
+		err = json.Unmarshal(pk.Data, &privateKeys)
+	}
+	if err != nil {
+		return err
+	}
+
+	keepIDs := map[string]struct{}{}
+	for _, id := range keep {
+		keepIDs[id] = struct{}{}
+	}
+	var kept []*tufData.PrivateKey
+	for _, key := range privateKeys {
+		signer, err := keys.GetSigner(key)
+		if err != nil {
+			return err
+		}
+		for _, id := range signer.PublicData().IDs() {
+			if _, ok := keepIDs[id]; ok {
+				kept = append(kept, key)
+				break
+			}
+		}
+	}
+	if len(kept) == 0 {
+		return fmt.Errorf("no %s key to keep in %s", role, path)
+	}
+
+	if pk.Encrypted {
+		pk.Data, err = encrypted.Marshal(kept, pass)
+	} else {
+		pk.Data, err = json.MarshalIndent(kept, "", "\t")
+	}
+	if err != nil {
+		return err
+	}
+	b, err = json.MarshalIndent(pk, "", "\t")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, append(b, '\n'), 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,223 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package repo
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// s3UnsignedPayload is the payload hash of requests whose body is not signed,
+// which S3 accepts so that uploads need not be read twice.
+const s3UnsignedPayload = "UNSIGNED-PAYLOAD"
+
+// s3Credentials authenticate requests to S3.
+type s3Credentials struct {
+	accessKeyID     string
+	secretAccessKey string
+	sessionToken    string
+}
+
+// s3Protocol is the S3 REST API, with requests signed by AWS Signature
+// Version 4. Uploads carry their CRC32C checksum, which S3 checks and returns
+// in HEAD responses.
+type s3Protocol struct {
+	region string
+	creds  s3Credentials
+	now    func() time.Time
+}
+
+func (p s3Protocol) authorize(req *http.Request) error {
+	req.Header.Set("X-Amz-Content-Sha256", s3UnsignedPayload)
+	if p.creds.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", p.creds.sessionToken)
+	}
+	signV4(req, p.creds, p.region, "s3", p.now().UTC())
+	return nil
+}
+
+func (s3Protocol) requestChecksum(req *http.Request) {
+	req.Header.Set("X-Amz-Checksum-Mode", "ENABLED")
+}
+
+// checksum returns the CRC32C of an object, or 0 for objects stored without
+// one, which are then uploaded again.
+func (s3Protocol) checksum(res *http.Response) (uint32, error) {
+	v := res.Header.Get("X-Amz-Checksum-Crc32c")
+	if v == "" {
+		return 0, nil
+	}
+	b, err := base64.StdEncoding.DecodeString(v)
+	if err != nil || len(b) != 4 {
+		return 0, fmt.Errorf("invalid x-amz-checksum-crc32c header %q", v)
+	}
+	return binary.BigEndian.Uint32(b), nil
+}
+
+func (s3Protocol) setChecksum(req *http.Request, sum uint32) {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], sum)
+	req.Header.Set("X-Amz-Checksum-Crc32c", base64.StdEncoding.EncodeToString(b[:]))
+}
+
+// NewS3Storage returns an HTTPStorage for objects in an Amazon S3 bucket, below
+// an optional prefix, for a URL of the form s3://bucket[/prefix]. As the AWS
+// tools do, it takes the credentials from AWS_ACCESS_KEY_ID,
+// AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN, and the region from AWS_REGION
+// or AWS_DEFAULT_REGION. AWS_ENDPOINT_URL replaces the S3 endpoint of the
+// region, for S3 compatible services, which are then addressed by path.
+func NewS3Storage(rawURL string, conns int) (*HTTPStorage, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "s3" || u.Host == "" {
+		return nil, fmt.Errorf("repo: %q is not an s3://bucket[/prefix] URL", rawURL)
+	}
+	creds := s3Credentials{
+		accessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		sessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if creds.accessKeyID == "" || creds.secretAccessKey == "" {
+		return nil, errors.New("repo: S3 requires AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+	}
+	region := os.Getenv("AWS_REGION")
+	if region == "" {
+		region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if region == "" {
+		region = "us-east-1"
+	}
+	return newS3Storage(u.Host, strings.Trim(u.Path, "/"), os.Getenv("AWS_ENDPOINT_URL"), region, creds, conns)
+}
+
+func newS3Storage(bucket, prefix, endpoint, region string, creds s3Credentials, conns int) (*HTTPStorage, error) {
+	var base *url.URL
+	if endpoint == "" {
+		base = &url.URL{Scheme: "https", Host: fmt.Sprintf("%s.s3.%s.amazonaws.com", bucket, region)}
+	} else {
+		var err error
+		if base, err = url.Parse(endpoint); err != nil {
+			return nil, err
+		}
+		base.Path = strings.TrimSuffix(base.Path, "/") + "/" + bucket
+	}
+	if prefix != "" {
+		base.Path += "/" + prefix
+	}
+	proto := s3Protocol{region: region, creds: creds, now: time.Now}
+	return newHTTPStorage(base, proto, conns), nil
+}
+
+// signV4 signs req for service in region at time t with AWS Signature Version
+// 4, covering the host and every header already set. The payload hash must be
+// set in the X-Amz-Content-Sha256 header.
+func signV4(req *http.Request, creds s3Credentials, region, service string, t time.Time) {
+	amzDate := t.Format("20060102T150405Z")
+	date := t.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+
+	// Send the path escaped exactly as it is signed.
+	req.URL.RawPath = s3Escape(req.URL.Path, false)
+	canonicalURI := req.URL.RawPath
+	if canonicalURI == "" {
+		canonicalURI = "/"
+	}
+
+	query := req.URL.Query()
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var params []string
+	for _, k := range keys {
+		values := query[k]
+		sort.Strings(values)
+		for _, v := range values {
+			params = append(params, s3Escape(k, true)+"="+s3Escape(v, true))
+		}
+	}
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	headers := map[string]string{"host": host}
+	for k, v := range req.Header {
+		values := make([]string, len(v))
+		for i := range v {
+			values[i] = strings.Join(strings.Fields(v[i]), " ")
+		}
+		headers[strings.ToLower(k)] = strings.Join(values, ",")
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&canonicalHeaders, "%s:%s\n", name, headers[name])
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		canonicalURI,
+		strings.Join(params, "&"),
+		canonicalHeaders.String(),
+		signedHeaders,
+		req.Header.Get("X-Amz-Content-Sha256"),
+	}, "\n")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	scope := strings.Join([]string{date, region, service, "aws4_request"}, "/")
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, hex.EncodeToString(requestHash[:])}, "\n")
+
+	key := []byte("AWS4" + creds.secretAccessKey)
+	for _, part := range []string{date, region, service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		creds.accessKeyID, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// s3Escape percent-encodes every byte of s except the unreserved characters of
+// RFC 3986, and "/" unless escapeSlash is set, as S3 signatures require.
+func s3Escape(s string, escapeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !escapeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
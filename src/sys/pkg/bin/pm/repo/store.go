@@ -0,0 +1,396 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package repo
+
+import (
+	"bytes"
+	"crypto/sha512"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	tuf "github.com/theupdateframework/go-tuf"
+	tufData "github.com/theupdateframework/go-tuf/data"
+	"github.com/theupdateframework/go-tuf/util"
+)
+
+// MetadataStore stores the TUF metadata, signing keys and staged target files
+// of a repository.
+type MetadataStore interface {
+	tuf.LocalStore
+
+	// StageTarget stages the content of the named target file, so that it
+	// can be added to the targets metadata.
+	StageTarget(name string, content io.Reader) error
+
+	// CommittedFiles returns the names of the committed metadata and target
+	// files served to clients, in order, as slash separated paths such as
+	// "timestamp.json" or "targets/<sha512>.<name>".
+	CommittedFiles() ([]string, error)
+
+	// OpenCommitted returns the content of the named committed file, or an
+	// error satisfying os.IsNotExist if there is none.
+	OpenCommitted(name string) (io.ReadCloser, error)
+}
+
+// BlobStore stores the blobs of a repository by their merkle root.
+type BlobStore interface {
+	// Stat returns the stored size of the blob, or an error satisfying
+	// os.IsNotExist if the store does not have it.
+	Stat(root string) (int64, error)
+
+	// Open returns the stored content of the blob.
+	Open(root string) (io.ReadCloser, error)
+
+	// Create returns a writer for a new blob, which is stored once the writer
+	// is committed.
+	Create() (BlobWriter, error)
+
+	// Remove removes the blob from the store.
+	Remove(root string) error
+
+	// List returns the merkle roots of all stored blobs, in order.
+	List() ([]string, error)
+}
+
+// BlobWriter writes the content of a new blob to a BlobStore.
+type BlobWriter interface {
+	io.Writer
+
+	// Commit stores the written content as the blob with the given merkle
+	// root, replacing any blob already stored with that root.
+	Commit(root string) error
+
+	// Abort discards the written content.
+	Abort() error
+}
+
+// FileSystemMetadataStore returns a MetadataStore using the standard layout of
+// the repository directory at dir: keys in dir/keys, staged metadata and
+// targets in dir/staged, and committed metadata and targets in
+// dir/repository.
+func FileSystemMetadataStore(dir string) MetadataStore {
+	return &fileSystemMetadataStore{tuf.FileSystemStore(dir, passphrase), dir}
+}
+
+type fileSystemMetadataStore struct {
+	tuf.LocalStore
+	dir string
+}
+
+// StageTarget links the target into the staging directory if content is a
+// file, and copies it otherwise.
+func (s *fileSystemMetadataStore) StageTarget(name string, content io.Reader) error {
+	path := filepath.Join(s.dir, "staged", "targets", filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+	if f, ok := content.(*os.File); ok {
+		return linkOrCopy(f.Name(), path)
+	}
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, content); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// CommittedFiles lists the files in dir/repository, except for the blobs
+// directory and hidden files.
+func (s *fileSystemMetadataStore) CommittedFiles() ([]string, error) {
+	root := filepath.Join(s.dir, "repository")
+	var names []string
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if path == root && os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		if info.IsDir() && name == "blobs" {
+			return filepath.SkipDir
+		}
+		if !info.Mode().IsRegular() || strings.HasPrefix(info.Name(), ".") {
+			return nil
+		}
+		names = append(names, name)
+		return nil
+	})
+	return names, err
+}
+
+func (s *fileSystemMetadataStore) OpenCommitted(name string) (io.ReadCloser, error) {
+	return os.Open(filepath.Join(s.dir, "repository", filepath.FromSlash(name)))
+}
+
+func (s *fileSystemMetadataStore) Commit(consistentSnapshot bool, versions map[string]int, hashes map[string]tufData.Hashes) error {
+	if err := s.LocalStore.Commit(consistentSnapshot, versions, hashes); err != nil {
+		return err
+	}
+	return s.fixupRootConsistentSnapshot()
+}
+
+// when the repository is "pre-initialized" by a root.json from the build, but
+// no root keys are available to the publishing step, the commit process does
+// not produce a consistent snapshot file for the root json manifest. This
+// method implements that production.
+func (s *fileSystemMetadataStore) fixupRootConsistentSnapshot() error {
+	b, err := ioutil.ReadFile(filepath.Join(s.dir, "repository", "root.json"))
+	if err != nil {
+		return err
+	}
+	sum512 := sha512.Sum512(b)
+	rootSnap := filepath.Join(s.dir, "repository", fmt.Sprintf("%x.root.json", sum512))
+	if _, err := os.Stat(rootSnap); os.IsNotExist(err) {
+		if err := ioutil.WriteFile(rootSnap, b, 0666); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MemoryMetadataStore returns a MetadataStore that keeps everything in memory.
+// It is intended for tests.
+func MemoryMetadataStore() MetadataStore {
+	files := map[string][]byte{}
+	return &memoryMetadataStore{tuf.MemoryStore(nil, files), files, nil}
+}
+
+type memoryMetadataStore struct {
+	tuf.LocalStore
+	files map[string][]byte
+
+	// committed is the content of the committed files, by name.
+	committed map[string][]byte
+}
+
+func (s *memoryMetadataStore) StageTarget(name string, content io.Reader) error {
+	b, err := ioutil.ReadAll(content)
+	if err != nil {
+		return err
+	}
+	s.files[name] = b
+	return nil
+}
+
+// Commit records the committed metadata, the targets it lists, and the
+// hash-named copy of root.json that fileSystemMetadataStore also writes.
+func (s *memoryMetadataStore) Commit(consistentSnapshot bool, versions map[string]int, hashes map[string]tufData.Hashes) error {
+	if err := s.LocalStore.Commit(consistentSnapshot, versions, hashes); err != nil {
+		return err
+	}
+	// Staged metadata is never discarded, so everything in the store is now
+	// committed.
+	meta, err := s.LocalStore.GetMeta()
+	if err != nil {
+		return err
+	}
+	committed := make(map[string][]byte, len(meta)+len(s.files))
+	for name, b := range meta {
+		committed[name] = b
+	}
+	if b, ok := committed["root.json"]; ok {
+		committed[fmt.Sprintf("%x.root.json", sha512.Sum512(b))] = b
+	}
+	for name, b := range s.files {
+		target := path.Join("targets", name)
+		h, ok := hashes[target]
+		if !ok {
+			continue
+		}
+		if !consistentSnapshot {
+			committed[target] = b
+			continue
+		}
+		for _, p := range util.HashedPaths(target, h) {
+			committed[p] = b
+		}
+	}
+	s.committed = committed
+	return nil
+}
+
+func (s *memoryMetadataStore) CommittedFiles() ([]string, error) {
+	names := make([]string, 0, len(s.committed))
+	for name := range s.committed {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (s *memoryMetadataStore) OpenCommitted(name string) (io.ReadCloser, error) {
+	b, ok := s.committed[name]
+	if !ok {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	return ioutil.NopCloser(bytes.NewReader(b)), nil
+}
+
+// DirBlobStore stores blobs as files named by their merkle root in a local
+// directory.
+type DirBlobStore struct {
+	Dir string
+}
+
+func (d *DirBlobStore) Stat(root string) (int64, error) {
+	fi, err := os.Stat(filepath.Join(d.Dir, root))
+	if err != nil {
+		return 0, err
+	}
+	if !fi.Mode().IsRegular() {
+		return 0, &os.PathError{Op: "stat", Path: filepath.Join(d.Dir, root), Err: os.ErrNotExist}
+	}
+	return fi.Size(), nil
+}
+
+// Open returns the blob as an *os.File.
+func (d *DirBlobStore) Open(root string) (io.ReadCloser, error) {
+	return os.Open(filepath.Join(d.Dir, root))
+}
+
+func (d *DirBlobStore) Create() (BlobWriter, error) {
+	f, err := ioutil.TempFile(d.Dir, "blob")
+	if err != nil {
+		return nil, err
+	}
+	return &dirBlobWriter{f, d.Dir}, nil
+}
+
+func (d *DirBlobStore) Remove(root string) error {
+	return os.Remove(filepath.Join(d.Dir, root))
+}
+
+// List returns the names of the files in the directory that are merkle roots,
+// ignoring e.g. temporary files left behind by interrupted writes.
+func (d *DirBlobStore) List() ([]string, error) {
+	infos, err := ioutil.ReadDir(d.Dir)
+	if err != nil {
+		return nil, err
+	}
+	var roots []string
+	for _, info := range infos {
+		if info.Mode().IsRegular() && isMerkleRoot(info.Name()) {
+			roots = append(roots, info.Name())
+		}
+	}
+	return roots, nil
+}
+
+type dirBlobWriter struct {
+	*os.File
+	dir string
+}
+
+func (w *dirBlobWriter) Commit(root string) error {
+	if err := w.File.Close(); err != nil {
+		os.Remove(w.Name())
+		return err
+	}
+	// Temporary files are only readable by their owner, but blobs, and the
+	// package targets linked to them, are served to everyone.
+	if err := os.Chmod(w.Name(), 0644); err != nil {
+		os.Remove(w.Name())
+		return err
+	}
+	return os.Rename(w.Name(), filepath.Join(w.dir, root))
+}
+
+func (w *dirBlobWriter) Abort() error {
+	w.File.Close()
+	return os.Remove(w.Name())
+}
+
+// MemoryBlobStore keeps blobs in memory. It is intended for tests.
+type MemoryBlobStore struct {
+	mu    sync.Mutex
+	blobs map[string][]byte
+}
+
+func NewMemoryBlobStore() *MemoryBlobStore {
+	return &MemoryBlobStore{blobs: map[string][]byte{}}
+}
+
+func (m *MemoryBlobStore) Stat(root string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b, ok := m.blobs[root]
+	if !ok {
+		return 0, &os.PathError{Op: "stat", Path: root, Err: os.ErrNotExist}
+	}
+	return int64(len(b)), nil
+}
+
+func (m *MemoryBlobStore) Open(root string) (io.ReadCloser, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b, ok := m.blobs[root]
+	if !ok {
+		return nil, &os.PathError{Op: "open", Path: root, Err: os.ErrNotExist}
+	}
+	return ioutil.NopCloser(bytes.NewReader(b)), nil
+}
+
+func (m *MemoryBlobStore) Create() (BlobWriter, error) {
+	return &memoryBlobWriter{store: m}, nil
+}
+
+func (m *MemoryBlobStore) Remove(root string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.blobs[root]; !ok {
+		return &os.PathError{Op: "remove", Path: root, Err: os.ErrNotExist}
+	}
+	delete(m.blobs, root)
+	return nil
+}
+
+func (m *MemoryBlobStore) List() ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	roots := make([]string, 0, len(m.blobs))
+	for root := range m.blobs {
+		roots = append(roots, root)
+	}
+	sort.Strings(roots)
+	return roots, nil
+}
+
+type memoryBlobWriter struct {
+	bytes.Buffer
+	store *MemoryBlobStore
+}
+
+func (w *memoryBlobWriter) Commit(root string) error {
+	w.store.mu.Lock()
+	defer w.store.mu.Unlock()
+	w.store.blobs[root] = w.Bytes()
+	return nil
+}
+
+func (w *memoryBlobWriter) Abort() error {
+	w.Reset()
+	return nil
+}
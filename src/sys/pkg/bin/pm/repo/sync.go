@@ -0,0 +1,287 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ErrObjectNotExist is returned by Storage.Attrs for objects that are not
+// stored.
+var ErrObjectNotExist = errors.New("repo: object does not exist")
+
+// crc32cTable is the Castagnoli table used for storage checksums.
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+// ObjectAttrs describes the content of a stored object.
+type ObjectAttrs struct {
+	Size   int64
+	CRC32C uint32
+}
+
+// Storage is a destination that a published repository can be synced to.
+// Object names are slash separated paths relative to the repository directory
+// served to clients, e.g. "timestamp.json" or "blobs/<merkle>".
+type Storage interface {
+	// Attrs returns the attributes of the named object, or ErrObjectNotExist.
+	Attrs(ctx context.Context, name string) (ObjectAttrs, error)
+
+	// Put stores the content of r as the named object. Implementations must
+	// fail if the stored content does not match attrs.
+	Put(ctx context.Context, name string, r io.Reader, attrs ObjectAttrs) error
+}
+
+// DirStorage stores objects as files below a local directory.
+type DirStorage struct {
+	Root string
+}
+
+func (d *DirStorage) Attrs(ctx context.Context, name string) (ObjectAttrs, error) {
+	attrs, err := fileAttrs(filepath.Join(d.Root, filepath.FromSlash(name)))
+	if os.IsNotExist(err) {
+		return ObjectAttrs{}, ErrObjectNotExist
+	}
+	return attrs, err
+}
+
+func (d *DirStorage) Put(ctx context.Context, name string, r io.Reader, attrs ObjectAttrs) error {
+	path := filepath.Join(d.Root, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(path), ".sync")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	h := crc32.New(crc32cTable)
+	n, err := io.Copy(io.MultiWriter(f, h), r)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if got := (ObjectAttrs{Size: n, CRC32C: h.Sum32()}); got != attrs {
+		return fmt.Errorf("repo: %s: stored %+v, want %+v", name, got, attrs)
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// fileAttrs returns the size and checksum of the file at path.
+func fileAttrs(path string) (ObjectAttrs, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return ObjectAttrs{}, err
+	}
+	defer f.Close()
+	return readerAttrs(f)
+}
+
+// readerAttrs returns the size and checksum of the content of r.
+func readerAttrs(r io.Reader) (ObjectAttrs, error) {
+	h := crc32.New(crc32cTable)
+	n, err := io.Copy(h, r)
+	if err != nil {
+		return ObjectAttrs{}, err
+	}
+	return ObjectAttrs{Size: n, CRC32C: h.Sum32()}, nil
+}
+
+// SyncResult counts the objects handled by Sync.
+type SyncResult struct {
+	Uploaded      int
+	UploadedBytes int64
+	Skipped       int
+}
+
+// topLevelMetadata lists the TUF metadata files that clients start from, in the
+// order they must be updated so that every file a client can reach is already
+// stored.
+var topLevelMetadata = []string{"root.json", "targets.json", "snapshot.json", "timestamp.json"}
+
+// Sync uploads the repository served from this Repo to dst, using up to
+// workers parallel uploads. Objects already stored with the same size and
+// checksum are skipped, so an interrupted sync can be resumed by running it
+// again. Root metadata is uploaded first, versioned files oldest first and then
+// root.json, so that a server checking uploads can follow key rotations. Blobs
+// and other versioned metadata are uploaded next, before the top-level
+// metadata that refers to them, ending with timestamp.json.
+//
+// Committed metadata and target files are read from the repository's metadata
+// store, and blobs from its blob store, wherever they are, with blobs uploaded
+// as "blobs/<merkle>". Only the blobs reachable from the committed
+// package targets are uploaded, or, with blob encryption, which keeps the
+// meta.fars from being read, every blob in the store.
+func (r *Repo) Sync(ctx context.Context, dst Storage, workers int) (SyncResult, error) {
+	names, err := r.meta.CommittedFiles()
+	if err != nil {
+		return SyncResult{}, err
+	}
+	committed := map[string]bool{}
+	for _, name := range names {
+		committed[name] = true
+	}
+
+	var roots, content, metadata []string
+	for _, name := range names {
+		if contains(topLevelMetadata, name) {
+			continue
+		}
+		if _, ok := rootVersion(name); ok {
+			roots = append(roots, name)
+			continue
+		}
+		content = append(content, name)
+	}
+	sort.Slice(roots, func(i, j int) bool {
+		vi, _ := rootVersion(roots[i])
+		vj, _ := rootVersion(roots[j])
+		return vi < vj
+	})
+	for _, name := range topLevelMetadata {
+		if !committed[name] {
+			continue
+		}
+		if name == "root.json" {
+			roots = append(roots, name)
+		} else {
+			metadata = append(metadata, name)
+		}
+	}
+	blobs, err := r.syncedBlobs()
+	if err != nil {
+		return SyncResult{}, err
+	}
+	for _, blob := range blobs {
+		content = append(content, "blobs/"+blob)
+	}
+	sort.Strings(content)
+
+	var result SyncResult
+	var mu sync.Mutex
+	upload := func(ctx context.Context, name string) error {
+		uploaded, n, err := syncObject(ctx, dst, name, func() (io.ReadCloser, error) {
+			if blob := strings.TrimPrefix(name, "blobs/"); blob != name {
+				return r.blobs.Open(blob)
+			}
+			return r.meta.OpenCommitted(name)
+		})
+		if err != nil {
+			return fmt.Errorf("syncing %s: %w", name, err)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if uploaded {
+			result.Uploaded++
+			result.UploadedBytes += n
+		} else {
+			result.Skipped++
+		}
+		return nil
+	}
+
+	for _, name := range roots {
+		if err := upload(ctx, name); err != nil {
+			return result, err
+		}
+	}
+
+	err = forEach(ctx, len(content), workers, func(ctx context.Context, i int) error {
+		return upload(ctx, content[i])
+	})
+	if err != nil {
+		return result, err
+	}
+
+	for _, name := range metadata {
+		if err := upload(ctx, name); err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// rootVersion returns the version of the versioned root metadata file name,
+// e.g. 3 for "3.root.json", and false if it is not one.
+func rootVersion(name string) (int, bool) {
+	v := strings.TrimSuffix(name, ".root.json")
+	if v == name {
+		return 0, false
+	}
+	version, err := strconv.Atoi(v)
+	return version, err == nil
+}
+
+// syncedBlobs returns the blobs that Sync uploads.
+func (r *Repo) syncedBlobs() ([]string, error) {
+	if r.encryptionKey != nil {
+		return r.blobs.List()
+	}
+	targets, err := r.committedTargets()
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	reachable := map[string]struct{}{}
+	for name, custom := range targets {
+		for _, meta := range append([]string{custom.Merkle}, custom.Subpackages...) {
+			if err := markPackage(r.blobs, meta, reachable); err != nil {
+				return nil, fmt.Errorf("%s: target %s: %w", r.path, name, err)
+			}
+		}
+	}
+	blobs := make([]string, 0, len(reachable))
+	for blob := range reachable {
+		blobs = append(blobs, blob)
+	}
+	return blobs, nil
+}
+
+// syncObject uploads the named object, read with open, to dst unless dst
+// already has identical content, returning whether it uploaded, and how many
+// bytes.
+func syncObject(ctx context.Context, dst Storage, name string, open func() (io.ReadCloser, error)) (bool, int64, error) {
+	rd, err := open()
+	if err != nil {
+		return false, 0, err
+	}
+	attrs, err := readerAttrs(rd)
+	rd.Close()
+	if err != nil {
+		return false, 0, err
+	}
+	stored, err := dst.Attrs(ctx, name)
+	if err == nil && stored == attrs {
+		return false, 0, nil
+	}
+	if err != nil && !errors.Is(err, ErrObjectNotExist) {
+		return false, 0, err
+	}
+
+	rd, err = open()
+	if err != nil {
+		return false, 0, err
+	}
+	defer rd.Close()
+	if err := dst.Put(ctx, name, rd, attrs); err != nil {
+		return false, 0, err
+	}
+	return true, attrs.Size, nil
+}
@@ -0,0 +1,291 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package repo
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"time"
+
+	tufData "github.com/theupdateframework/go-tuf/data"
+	"github.com/theupdateframework/go-tuf/util"
+	"github.com/theupdateframework/go-tuf/verify"
+
+	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/build"
+)
+
+// RoleReport describes the metadata of one role of a verified repository.
+type RoleReport struct {
+	Role      string    `json:"role"`
+	Version   int       `json:"version"`
+	Expires   time.Time `json:"expires"`
+	Keys      int       `json:"keys"`
+	Threshold int       `json:"threshold"`
+}
+
+// VerifyReport is the result of verifying a repository. The repository is
+// healthy if it has no problems.
+type VerifyReport struct {
+	Roles       []RoleReport `json:"roles"`
+	Delegations int          `json:"delegations"`
+	Targets     int          `json:"targets"`
+	Blobs       int          `json:"blobs"`
+	Problems    []string     `json:"problems"`
+}
+
+// OK returns true if verification found no problems.
+func (v *VerifyReport) OK() bool {
+	return len(v.Problems) == 0
+}
+
+func (v *VerifyReport) problem(format string, args ...interface{}) {
+	v.Problems = append(v.Problems, fmt.Sprintf(format, args...))
+}
+
+// signedMetadata is a metadata file, and the fields common to all roles.
+type signedMetadata struct {
+	signed  tufData.Signed
+	raw     []byte
+	Type    string    `json:"_type"`
+	Version int       `json:"version"`
+	Expires time.Time `json:"expires"`
+}
+
+func readSignedMetadata(path string) (*signedMetadata, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	m := &signedMetadata{raw: b}
+	if err := json.Unmarshal(b, &m.signed); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := json.Unmarshal(m.signed.Signed, m); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return m, nil
+}
+
+// VerifyRepository checks the committed metadata of the repository at dir as a
+// client would at time now: the signatures and role thresholds of all
+// metadata, including delegations, their expiration, the references between
+// them, and that every target and the blobs of every package target are
+// present and intact. The repository is not modified. An error is returned
+// only if the top-level metadata cannot be read at all; everything else is
+// reported as a problem.
+func VerifyRepository(dir string, now time.Time) (*VerifyReport, error) {
+	repoDir := filepath.Join(dir, "repository")
+	report := &VerifyReport{Problems: []string{}}
+
+	metadata := map[string]*signedMetadata{}
+	for _, role := range []string{"root", "targets", "snapshot", "timestamp"} {
+		m, err := readSignedMetadata(filepath.Join(repoDir, role+".json"))
+		if err != nil {
+			return nil, err
+		}
+		metadata[role] = m
+	}
+
+	var root tufData.Root
+	if err := json.Unmarshal(metadata["root"].signed.Signed, &root); err != nil {
+		return nil, err
+	}
+	db := verify.NewDB()
+	for id, key := range root.Keys {
+		if err := db.AddKey(id, key); err != nil {
+			report.problem("root: key %s: %s", id, err)
+		}
+	}
+	roleNames := make([]string, 0, len(root.Roles))
+	for name := range root.Roles {
+		roleNames = append(roleNames, name)
+	}
+	sort.Strings(roleNames)
+	for _, name := range roleNames {
+		role := root.Roles[name]
+		if role.Threshold < 1 {
+			report.problem("root: role %s has threshold %d", name, role.Threshold)
+		}
+		if len(role.KeyIDs) < role.Threshold {
+			report.problem("root: role %s has %d keys, fewer than its threshold %d", name, len(role.KeyIDs), role.Threshold)
+		}
+		for _, id := range role.KeyIDs {
+			if _, ok := root.Keys[id]; !ok {
+				report.problem("root: role %s refers to unknown key %s", name, id)
+			}
+		}
+		if err := db.AddRole(name, role); err != nil {
+			report.problem("root: role %s: %s", name, err)
+		}
+	}
+
+	for _, name := range []string{"root", "targets", "snapshot", "timestamp"} {
+		m := metadata[name]
+		rr := RoleReport{Role: name, Version: m.Version, Expires: m.Expires}
+		if role, ok := root.Roles[name]; ok {
+			rr.Keys = len(role.KeyIDs)
+			rr.Threshold = role.Threshold
+		} else {
+			report.problem("root: missing role %s", name)
+		}
+		report.Roles = append(report.Roles, rr)
+
+		if m.Type != name {
+			report.problem("%s.json: has type %q", name, m.Type)
+		}
+		if err := db.VerifySignatures(&m.signed, name); err != nil {
+			report.problem("%s.json: %s", name, err)
+		}
+		if !m.Expires.After(now) {
+			report.problem("%s.json: expired at %s", name, m.Expires.Format(time.RFC3339))
+		}
+	}
+
+	var timestamp tufData.Timestamp
+	if err := json.Unmarshal(metadata["timestamp"].signed.Signed, &timestamp); err != nil {
+		return nil, err
+	}
+	if expected, ok := timestamp.Meta["snapshot.json"]; !ok {
+		report.problem("timestamp.json: does not refer to snapshot.json")
+	} else if actual, err := util.GenerateTimestampFileMeta(bytes.NewReader(metadata["snapshot"].raw), expected.HashAlgorithms()...); err != nil {
+		report.problem("snapshot.json: %s", err)
+	} else if err := util.TimestampFileMetaEqual(actual, expected); err != nil {
+		report.problem("timestamp.json: snapshot.json does not match: %s", err)
+	}
+
+	var snapshot tufData.Snapshot
+	if err := json.Unmarshal(metadata["snapshot"].signed.Signed, &snapshot); err != nil {
+		return nil, err
+	}
+	if expected, ok := snapshot.Meta["targets.json"]; !ok {
+		report.problem("snapshot.json: does not refer to targets.json")
+	} else if actual, err := util.GenerateSnapshotFileMeta(bytes.NewReader(metadata["targets"].raw), expected.HashAlgorithms()...); err != nil {
+		report.problem("targets.json: %s", err)
+	} else if err := util.SnapshotFileMetaEqual(actual, expected); err != nil {
+		report.problem("snapshot.json: targets.json does not match: %s", err)
+	}
+
+	var targets tufData.Targets
+	if err := json.Unmarshal(metadata["targets"].signed.Signed, &targets); err != nil {
+		return nil, err
+	}
+	if targets.Delegations != nil {
+		verifyDelegations(report, repoDir, targets.Delegations, now)
+	}
+
+	report.Targets = len(targets.Targets)
+	names := make([]string, 0, len(targets.Targets))
+	for name := range targets.Targets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		meta := targets.Targets[name]
+		paths := []string{name}
+		if root.ConsistentSnapshot {
+			paths = util.HashedPaths(name, meta.Hashes)
+		}
+		for _, p := range paths {
+			verifyTargetFile(report, filepath.Join(repoDir, "targets", filepath.FromSlash(p)), name, meta)
+		}
+	}
+
+	pkgs, err := packageTargets(targets.Targets)
+	if err != nil {
+		report.problem("targets.json: %s", err)
+	}
+	blobs := &DirBlobStore{filepath.Join(repoDir, "blobs")}
+	reachable := map[string]struct{}{}
+	// sizes holds the sizes of the blobs the targets metadata records, which
+	// are the package meta.fars.
+	sizes := map[string]int64{}
+	for _, name := range names {
+		custom, ok := pkgs[name]
+		if !ok {
+			continue
+		}
+		sizes[custom.Merkle] = custom.Size
+		for _, meta := range append([]string{custom.Merkle}, custom.Subpackages...) {
+			if err := markPackage(blobs, meta, reachable); err != nil {
+				report.problem("target %s: %s", name, err)
+			}
+		}
+	}
+	roots := make([]string, 0, len(reachable))
+	for root := range reachable {
+		roots = append(roots, root)
+	}
+	sort.Strings(roots)
+	for _, root := range roots {
+		merkle, err := build.DecodeMerkleRoot([]byte(root))
+		if err != nil {
+			report.problem("blob %s: %s", root, err)
+			continue
+		}
+		size, ok := sizes[root]
+		if !ok {
+			size = -1
+		}
+		if err := build.VerifyBlob(filepath.Join(blobs.Dir, root), merkle, size); err != nil {
+			if os.IsNotExist(err) {
+				report.problem("blob %s is missing", root)
+			} else {
+				report.problem("blob %s: %s", root, err)
+			}
+			continue
+		}
+		report.Blobs++
+	}
+
+	return report, nil
+}
+
+// verifyTargetFile checks that the target file at p matches its metadata.
+func verifyTargetFile(report *VerifyReport, p, name string, meta tufData.TargetFileMeta) {
+	f, err := os.Open(p)
+	if err != nil {
+		report.problem("target %s: %s", name, err)
+		return
+	}
+	defer f.Close()
+	actual, err := util.GenerateTargetFileMeta(f, meta.HashAlgorithms()...)
+	if err != nil {
+		report.problem("target %s: %s", name, err)
+		return
+	}
+	if err := util.TargetFileMetaEqual(actual, meta); err != nil {
+		report.problem("target %s: %s", name, err)
+	}
+}
+
+// verifyDelegations checks the signatures and expiration of the metadata of
+// every delegated targets role.
+func verifyDelegations(report *VerifyReport, repoDir string, delegations *tufData.Delegations, now time.Time) {
+	verifier, err := verify.NewDelegationsVerifier(delegations)
+	if err != nil {
+		report.problem("targets.json: delegations: %s", err)
+		return
+	}
+	for _, role := range delegations.Roles {
+		report.Delegations++
+		m, err := readSignedMetadata(filepath.Join(repoDir, path.Base(role.Name)+".json"))
+		if err != nil {
+			report.problem("delegation %s: %s", role.Name, err)
+			continue
+		}
+		if err := verifier.DB.VerifySignatures(&m.signed, role.Name); err != nil {
+			report.problem("delegation %s: %s", role.Name, err)
+		}
+		if !m.Expires.After(now) {
+			report.problem("delegation %s: expired at %s", role.Name, m.Expires.Format(time.RFC3339))
+		}
+	}
+}
@@ -0,0 +1,12 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// Package upload holds the parts of the protocol for uploading objects to a
+// served repository that both its server, in pmhttp, and its client, in repo,
+// need.
+package upload
+
+// ChecksumHeader carries the CRC32C (Castagnoli) checksum of an uploaded
+// object, as 8 lowercase hex digits.
+const ChecksumHeader = "X-Pm-Crc32c"
@@ -4,6 +4,11 @@
 
 package build
 
+import (
+	"errors"
+	"fmt"
+)
+
 // Image represents an entry in an image manifest.
 type Image struct {
 	// Name is the canonical name of the image.
@@ -31,5 +36,119 @@ type Image struct {
 	NetbootArgs []string `json:"bootserver_netboot,omitempty"`
 }
 
+// ErrImageNotFound is wrapped by the errors returned when an image manifest
+// query matches no image.
+var ErrImageNotFound = errors.New("image not found")
+
 // ImageManifest is a JSON list of images produced by the Fuchsia build.
-type ImageManifest = []Image
+type ImageManifest []Image
+
+// ByName returns the images with the given name. A single name commonly has
+// images of several types, e.g. the "zbi" and "vbmeta" images of "zircon-a".
+func (m ImageManifest) ByName(name string) ImageManifest {
+	return m.filter(func(img Image) bool { return img.Name == name })
+}
+
+// ByType returns the images of the given type.
+func (m ImageManifest) ByType(typ string) ImageManifest {
+	return m.filter(func(img Image) bool { return img.Type == typ })
+}
+
+// Lookup returns the image with the given name and type.
+func (m ImageManifest) Lookup(name, typ string) (Image, error) {
+	for _, img := range m {
+		if img.Name == name && img.Type == typ {
+			return img, nil
+		}
+	}
+	return Image{}, fmt.Errorf("%w: %s image %q", ErrImageNotFound, typ, name)
+}
+
+func (m ImageManifest) lookupLabel(label, typ string) (Image, error) {
+	for _, img := range m {
+		if img.Label == label && img.Type == typ {
+			return img, nil
+		}
+	}
+	return Image{}, fmt.Errorf("%w: %s image with label %q", ErrImageNotFound, typ, label)
+}
+
+func (m ImageManifest) filter(keep func(Image) bool) ImageManifest {
+	var res ImageManifest
+	for _, img := range m {
+		if keep(img) {
+			res = append(res, img)
+		}
+	}
+	return res
+}
+
+// BootImages are the images used to boot a target.
+type BootImages struct {
+	// ZBI is the image the target boots.
+	ZBI Image
+
+	// Vbmeta is the verified boot metadata for ZBI. It is only set for
+	// hardware targets, and nil if the build did not produce it.
+	Vbmeta *Image
+
+	// QEMUKernel is the kernel an emulator boots ZBI with. It is only set for
+	// emulator targets.
+	QEMUKernel *Image
+
+	// Storage is the disk image attached to an emulator. It is nil if the
+	// build did not produce it.
+	Storage *Image
+}
+
+// IsEmulatorDeviceType returns whether deviceType names an emulator rather
+// than a physical device.
+func IsEmulatorDeviceType(deviceType string) bool {
+	return deviceType == "QEMU" || deviceType == "AEMU"
+}
+
+// BootImagesFor returns the images used to boot a target of the given device
+// type, after applying any image overrides. Required images that are missing
+// produce an error wrapping ErrImageNotFound.
+func (m ImageManifest) BootImagesFor(deviceType string, overrides ImageOverrides) (BootImages, error) {
+	var b BootImages
+	var err error
+	b.ZBI, err = m.bootImage(overrides, ZbiImage, "zircon-a", "zbi")
+	if err != nil {
+		return BootImages{}, err
+	}
+
+	if IsEmulatorDeviceType(deviceType) {
+		kernel, err := m.bootImage(overrides, QemuKernel, "qemu-kernel", "kernel")
+		if err != nil {
+			return BootImages{}, err
+		}
+		b.QEMUKernel = &kernel
+		if storage, err := m.Lookup("storage-full", "blk"); err == nil {
+			b.Storage = &storage
+		}
+		return b, nil
+	}
+
+	vbmeta, err := m.bootImage(overrides, VbmetaImage, "zircon-a", "vbmeta")
+	if err == nil {
+		b.Vbmeta = &vbmeta
+	} else if _, ok := overrides[VbmetaImage]; ok {
+		// A vbmeta override that doesn't resolve is a configuration error,
+		// unlike a build that doesn't produce vbmeta at all.
+		return BootImages{}, err
+	}
+	return b, nil
+}
+
+// bootImage looks up the image of the given type, using the override for
+// overrideType if there is one and the image named defaultName otherwise.
+func (m ImageManifest) bootImage(overrides ImageOverrides, overrideType ImageOverrideType, defaultName, typ string) (Image, error) {
+	if o, ok := overrides[overrideType]; ok {
+		if o.Name != "" {
+			return m.Lookup(o.Name, typ)
+		}
+		return m.lookupLabel(o.Label, typ)
+	}
+	return m.Lookup(defaultName, typ)
+}
@@ -0,0 +1,109 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package build
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestImageManifestQueries(t *testing.T) {
+	images := ImageManifest{
+		{Name: "zircon-a", Type: "zbi", Path: "zircon-a.zbi", Label: "//build/images:zbi"},
+		{Name: "zircon-a", Type: "vbmeta", Path: "zircon-a.vbmeta"},
+		{Name: "qemu-kernel", Type: "kernel", Path: "qemu-kernel.bin"},
+		{Name: "storage-full", Type: "blk", Path: "storage-full.blk"},
+		{Name: "other", Type: "zbi", Path: "other.zbi", Label: "//build/images:other"},
+	}
+
+	if got := images.ByName("zircon-a"); !reflect.DeepEqual(got, images[:2]) {
+		t.Errorf("ByName() = %v, want %v", got, images[:2])
+	}
+	if got := images.ByType("zbi"); !reflect.DeepEqual(got, ImageManifest{images[0], images[4]}) {
+		t.Errorf("ByType() = %v, want the two zbi images", got)
+	}
+	if got := images.ByName("missing"); len(got) != 0 {
+		t.Errorf("ByName() of a missing image = %v, want none", got)
+	}
+	if _, err := images.Lookup("zircon-a", "blk"); !errors.Is(err, ErrImageNotFound) {
+		t.Errorf("Lookup() of a missing image returned %v, want ErrImageNotFound", err)
+	}
+
+	testCases := []struct {
+		name       string
+		deviceType string
+		overrides  ImageOverrides
+		images     ImageManifest
+		want       BootImages
+		wantErr    bool
+	}{
+		{
+			name:       "emulator",
+			deviceType: "QEMU",
+			images:     images,
+			want: BootImages{
+				ZBI:        images[0],
+				QEMUKernel: &images[2],
+				Storage:    &images[3],
+			},
+		},
+		{
+			name:       "hardware",
+			deviceType: "NUC",
+			images:     images,
+			want: BootImages{
+				ZBI:    images[0],
+				Vbmeta: &images[1],
+			},
+		},
+		{
+			name:       "hardware without vbmeta",
+			deviceType: "NUC",
+			images:     ImageManifest{images[0]},
+			want:       BootImages{ZBI: images[0]},
+		},
+		{
+			name:       "zbi override by label",
+			deviceType: "NUC",
+			overrides:  ImageOverrides{ZbiImage: {Label: "//build/images:other"}},
+			images:     images,
+			want: BootImages{
+				ZBI:    images[4],
+				Vbmeta: &images[1],
+			},
+		},
+		{
+			name:       "missing qemu kernel",
+			deviceType: "AEMU",
+			images:     ImageManifest{images[0]},
+			wantErr:    true,
+		},
+		{
+			name:       "unresolved vbmeta override",
+			deviceType: "NUC",
+			overrides:  ImageOverrides{VbmetaImage: {Name: "missing"}},
+			images:     images,
+			wantErr:    true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := tc.images.BootImagesFor(tc.deviceType, tc.overrides)
+			if tc.wantErr {
+				if !errors.Is(err, ErrImageNotFound) {
+					t.Fatalf("got error %v, want ErrImageNotFound", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
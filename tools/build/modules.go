@@ -5,13 +5,18 @@
 package build
 
 import (
+	"fmt"
 	"path/filepath"
+	"sort"
+	"sync"
+	"time"
 
 	"go.fuchsia.dev/fuchsia/tools/lib/jsonutil"
 )
 
 const (
-	imageManifestName = "images.json"
+	imageManifestName     = "images.json"
+	toolPathsManifestName = "tool_paths.json"
 )
 
 // Modules is a convenience interface for accessing the various build API
@@ -21,6 +26,7 @@ const (
 // `build_api_module` target in //BUILD.gn.
 type Modules struct {
 	buildDir                 string
+	files                    map[string]*moduleFile
 	apis                     []string
 	archives                 []Archive
 	args                     Args
@@ -41,11 +47,35 @@ type Modules struct {
 	zbiTests                 []ZBITest
 }
 
-// NewModules returns a Modules associated with a given build directory.
+// moduleFile is a build API module file, read at most once.
+type moduleFile struct {
+	dest interface{}
+
+	mu       sync.Mutex
+	loaded   bool
+	err      error
+	duration time.Duration
+}
+
+// NewModules returns a Modules associated with a given build directory, with
+// all of its build API modules read.
 func NewModules(buildDir string) (*Modules, error) {
-	m := &Modules{buildDir: buildDir}
+	m := NewLazyModules(buildDir)
+	if err := m.Load(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
 
-	manifests := map[string]interface{}{
+// NewLazyModules returns a Modules associated with a given build directory
+// that reads each build API module only when it is first used, for tools that
+// need just a few of them. Callers should Load the modules they use to find
+// out whether they could be read; an accessor of a module that cannot be read
+// returns its zero value.
+func NewLazyModules(buildDir string) *Modules {
+	m := &Modules{buildDir: buildDir}
+	m.files = map[string]*moduleFile{}
+	for manifest, dest := range map[string]interface{}{
 		"api.json":                        &m.apis,
 		"archives.json":                   &m.archives,
 		"args.json":                       &m.args,
@@ -62,100 +92,162 @@ func NewModules(buildDir string) (*Modules, error) {
 		"tests.json":                      &m.testSpecs,
 		"test_durations.json":             &m.testDurations,
 		"test_list_location.json":         &m.testListLocation,
-		"tool_paths.json":                 &m.tools,
+		toolPathsManifestName:             &m.tools,
 		"zbi_tests.json":                  &m.zbiTests,
+	} {
+		m.files[manifest] = &moduleFile{dest: dest}
 	}
-	for manifest, dest := range manifests {
-		path := filepath.Join(buildDir, manifest)
-		if err := jsonutil.ReadFromFile(path, dest); err != nil {
-			return nil, err
+	return m
+}
+
+// Load reads the named build API modules, e.g. "tests.json", or all of them if
+// none are named, unless they have already been read. It returns the first
+// error reading any of them, including errors from earlier attempts.
+func (m *Modules) Load(manifests ...string) error {
+	if len(manifests) == 0 {
+		for manifest := range m.files {
+			manifests = append(manifests, manifest)
 		}
+		sort.Strings(manifests)
 	}
-	return m, nil
+	for _, manifest := range manifests {
+		if _, ok := m.files[manifest]; !ok {
+			return fmt.Errorf("unknown build API module %q", manifest)
+		}
+		if err := m.load(manifest); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *Modules) load(manifest string) error {
+	f := m.files[manifest]
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.loaded {
+		start := time.Now()
+		f.err = jsonutil.ReadFromFile(filepath.Join(m.buildDir, manifest), f.dest)
+		f.duration = time.Since(start)
+		f.loaded = true
+	}
+	return f.err
+}
+
+// LoadTimes returns how long reading each build API module took, for the
+// modules read so far.
+func (m *Modules) LoadTimes() map[string]time.Duration {
+	times := map[string]time.Duration{}
+	for manifest, f := range m.files {
+		f.mu.Lock()
+		if f.loaded {
+			times[manifest] = f.duration
+		}
+		f.mu.Unlock()
+	}
+	return times
 }
 
 // BuildDir returns the fuchsia build directory root.
-func (m Modules) BuildDir() string {
+func (m *Modules) BuildDir() string {
 	return m.buildDir
 }
 
 // ImageManifest returns the path to the images manifest.
-func (m Modules) ImageManifest() string {
+func (m *Modules) ImageManifest() string {
 	return filepath.Join(m.BuildDir(), imageManifestName)
 }
 
 // APIs returns the build API module of available build API modules.
-func (m Modules) APIs() []string {
+func (m *Modules) APIs() []string {
+	m.load("api.json")
 	return m.apis
 }
 
-func (m Modules) Archives() []Archive {
+func (m *Modules) Archives() []Archive {
+	m.load("archives.json")
 	return m.archives
 }
 
-func (m Modules) Args() Args {
+func (m *Modules) Args() Args {
+	m.load("args.json")
 	return m.args
 }
 
-func (m Modules) AssemblyInputArchives() []AssemblyInputArchive {
+func (m *Modules) AssemblyInputArchives() []AssemblyInputArchive {
+	m.load("assembly_input_archives.json")
 	return m.assemblyInputArchives
 }
 
-func (m Modules) Binaries() []Binary {
+func (m *Modules) Binaries() []Binary {
+	m.load("binaries.json")
 	return m.binaries
 }
 
-func (m Modules) CheckoutArtifacts() []CheckoutArtifact {
+func (m *Modules) CheckoutArtifacts() []CheckoutArtifact {
+	m.load("checkout_artifacts.json")
 	return m.checkoutArtifacts
 }
 
-func (m Modules) ClippyTargets() []ClippyTarget {
+func (m *Modules) ClippyTargets() []ClippyTarget {
+	m.load("clippy_target_mapping.json")
 	return m.clippyTargets
 }
 
-func (m Modules) GeneratedSources() []string {
+func (m *Modules) GeneratedSources() []string {
+	m.load("generated_sources.json")
 	return m.generatedSources
 }
 
-func (m Modules) Images() []Image {
+func (m *Modules) Images() []Image {
+	m.load(imageManifestName)
 	return m.images
 }
 
-func (m Modules) PackageManifestsLocation() []string {
+func (m *Modules) PackageManifestsLocation() []string {
+	m.load("all_package_manifest_paths.json")
 	return m.packageManifestsLocation
 }
 
 // Platforms returns the build API module of available platforms to test on.
-func (m Modules) Platforms() []DimensionSet {
+func (m *Modules) Platforms() []DimensionSet {
+	m.load("platforms.json")
 	return m.platforms
 }
 
 // PrebuiltBinarySets returns the build API module of prebuilt packages
 // registered in the build.
-func (m Modules) PrebuiltBinarySets() []PrebuiltBinarySet {
+func (m *Modules) PrebuiltBinarySets() []PrebuiltBinarySet {
+	m.load("prebuilt_binaries.json")
 	return m.prebuiltBinarySets
 }
 
-func (m Modules) SDKArchives() []SDKArchive {
+func (m *Modules) SDKArchives() []SDKArchive {
+	m.load("sdk_archives.json")
 	return m.sdkArchives
 }
 
-func (m Modules) TestDurations() []TestDuration {
+func (m *Modules) TestDurations() []TestDuration {
+	m.load("test_durations.json")
 	return m.testDurations
 }
 
-func (m Modules) TestListLocation() []string {
+func (m *Modules) TestListLocation() []string {
+	m.load("test_list_location.json")
 	return m.testListLocation
 }
 
-func (m Modules) TestSpecs() []TestSpec {
+func (m *Modules) TestSpecs() []TestSpec {
+	m.load("tests.json")
 	return m.testSpecs
 }
 
-func (m Modules) Tools() Tools {
+func (m *Modules) Tools() Tools {
+	m.load(toolPathsManifestName)
 	return m.tools
 }
 
-func (m Modules) ZBITests() []ZBITest {
+func (m *Modules) ZBITests() []ZBITest {
+	m.load("zbi_tests.json")
 	return m.zbiTests
 }
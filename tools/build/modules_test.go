@@ -0,0 +1,48 @@
+// Copyright 2022 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package build
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestLazyModules(t *testing.T) {
+	buildDir := t.TempDir()
+	tests := `[{"test": {"name": "foo", "os": "linux", "cpu": "x64", "path": "foo"}, "environments": []}]`
+	if err := ioutil.WriteFile(filepath.Join(buildDir, "tests.json"), []byte(tests), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewModules(buildDir); err == nil {
+		t.Error("NewModules: expected an error for missing modules")
+	}
+
+	m := NewLazyModules(buildDir)
+	if times := m.LoadTimes(); len(times) != 0 {
+		t.Errorf("got load times %v before any module was used", times)
+	}
+	if err := m.Load("tests.json"); err != nil {
+		t.Fatal(err)
+	}
+	if specs := m.TestSpecs(); len(specs) != 1 || specs[0].Name != "foo" {
+		t.Errorf("got test specs %+v", specs)
+	}
+	if times := m.LoadTimes(); len(times) != 1 {
+		t.Errorf("got load times %v, want only tests.json", times)
+	}
+
+	// A module that cannot be read is empty, and its error is kept.
+	if apis := m.APIs(); apis != nil {
+		t.Errorf("got APIs %v, want none", apis)
+	}
+	if err := m.Load("api.json"); err == nil {
+		t.Error("expected an error loading a missing module")
+	}
+	if err := m.Load("bogus.json"); err == nil {
+		t.Error("expected an error loading an unknown module")
+	}
+}
@@ -6,14 +6,45 @@ package build
 
 import (
 	"encoding/json"
+	"math"
 	"time"
 )
 
 // TestDuration encodes information about a test's running time.
 // It implements the json.RawMessage interface for custom JSON decoding.
+//
+// Only the median is always present. The other statistics are optional, and
+// zero if the durations file does not provide them.
 type TestDuration struct {
-	Name           string `json:"name"`
+	Name string `json:"name"`
+	// MedianDuration is the 50th percentile of the test's running times.
 	MedianDuration time.Duration
+	// P90Duration is the 90th percentile of the test's running times.
+	P90Duration time.Duration `json:"-"`
+	// P99Duration is the 99th percentile of the test's running times.
+	P99Duration time.Duration `json:"-"`
+	// MeanDuration is the mean of the test's running times.
+	MeanDuration time.Duration `json:"-"`
+	// VarianceMS2 is the variance of the test's running times, in
+	// milliseconds squared.
+	VarianceMS2 float64 `json:"duration_variance_ms2,omitempty"`
+	// SampleCount is the number of runs the statistics were computed from.
+	SampleCount int `json:"sample_count,omitempty"`
+}
+
+// StdDev returns the standard deviation of the test's running times, or zero
+// if the variance is unknown.
+func (d TestDuration) StdDev() time.Duration {
+	return time.Duration(math.Sqrt(d.VarianceMS2) * float64(time.Millisecond))
+}
+
+// ConservativeDuration returns a running time the test is unlikely to exceed:
+// the 90th percentile if known, and the median otherwise.
+func (d TestDuration) ConservativeDuration() time.Duration {
+	if d.P90Duration > 0 {
+		return d.P90Duration
+	}
+	return d.MedianDuration
 }
 
 type testDurationAlias TestDuration
@@ -28,6 +59,9 @@ type testDurationAlias TestDuration
 type rawTestDuration struct {
 	*testDurationAlias
 	MedianDurationMS int64 `json:"median_duration_ms"`
+	P90DurationMS    int64 `json:"p90_duration_ms,omitempty"`
+	P99DurationMS    int64 `json:"p99_duration_ms,omitempty"`
+	MeanDurationMS   int64 `json:"mean_duration_ms,omitempty"`
 }
 
 func (d *TestDuration) MarshalJSON() ([]byte, error) {
@@ -35,6 +69,9 @@ func (d *TestDuration) MarshalJSON() ([]byte, error) {
 		testDurationAlias: (*testDurationAlias)(d),
 	}
 	raw.MedianDurationMS = int64(d.MedianDuration / time.Millisecond)
+	raw.P90DurationMS = int64(d.P90Duration / time.Millisecond)
+	raw.P99DurationMS = int64(d.P99Duration / time.Millisecond)
+	raw.MeanDurationMS = int64(d.MeanDuration / time.Millisecond)
 	return json.Marshal(raw)
 }
 
@@ -46,5 +83,8 @@ func (d *TestDuration) UnmarshalJSON(data []byte) error {
 		return err
 	}
 	d.MedianDuration = time.Duration(raw.MedianDurationMS) * time.Millisecond
+	d.P90Duration = time.Duration(raw.P90DurationMS) * time.Millisecond
+	d.P99Duration = time.Duration(raw.P99DurationMS) * time.Millisecond
+	d.MeanDuration = time.Duration(raw.MeanDurationMS) * time.Millisecond
 	return nil
 }
@@ -40,3 +40,59 @@ func TestUnmarshalTestDurations(t *testing.T) {
 		t.Fatalf("got durations %#v, expected %#v", actual, expected)
 	}
 }
+
+func TestUnmarshalTestDurationStatistics(t *testing.T) {
+	data := `{
+		"name": "/path/to/foo",
+		"median_duration_ms": 100,
+		"p90_duration_ms": 250,
+		"p99_duration_ms": 900,
+		"mean_duration_ms": 140,
+		"duration_variance_ms2": 1600,
+		"sample_count": 42
+	}`
+	expected := TestDuration{
+		Name:           "/path/to/foo",
+		MedianDuration: 100 * time.Millisecond,
+		P90Duration:    250 * time.Millisecond,
+		P99Duration:    900 * time.Millisecond,
+		MeanDuration:   140 * time.Millisecond,
+		VarianceMS2:    1600,
+		SampleCount:    42,
+	}
+	var actual TestDuration
+	if err := json.Unmarshal([]byte(data), &actual); err != nil {
+		t.Fatalf("error unmarshalling test duration: %v", err)
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("got duration %#v, expected %#v", actual, expected)
+	}
+	if got := actual.StdDev(); got != 40*time.Millisecond {
+		t.Errorf("StdDev() = %s, expected 40ms", got)
+	}
+	if got := actual.ConservativeDuration(); got != actual.P90Duration {
+		t.Errorf("ConservativeDuration() = %s, expected the p90 %s", got, actual.P90Duration)
+	}
+
+	b, err := json.Marshal(&actual)
+	if err != nil {
+		t.Fatalf("error marshalling test duration: %v", err)
+	}
+	var roundTripped TestDuration
+	if err := json.Unmarshal(b, &roundTripped); err != nil {
+		t.Fatalf("error unmarshalling marshalled test duration: %v", err)
+	}
+	if !reflect.DeepEqual(roundTripped, expected) {
+		t.Fatalf("round trip produced %#v, expected %#v", roundTripped, expected)
+	}
+}
+
+func TestConservativeDurationFallsBackToMedian(t *testing.T) {
+	d := TestDuration{Name: "foo", MedianDuration: time.Second}
+	if got := d.ConservativeDuration(); got != time.Second {
+		t.Errorf("ConservativeDuration() = %s, expected the median 1s", got)
+	}
+	if got := d.StdDev(); got != 0 {
+		t.Errorf("StdDev() = %s, expected 0 without a variance", got)
+	}
+}
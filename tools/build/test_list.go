@@ -5,10 +5,11 @@
 package build
 
 import (
+	"bufio"
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
-
-	"go.fuchsia.dev/fuchsia/tools/lib/jsonutil"
 )
 
 // TestList contains the list of tests in the build along with
@@ -54,21 +55,112 @@ type TestTag struct {
 // LoadTestList loads test-list.json and returns a map of test names to
 // testListEntries.
 func LoadTestList(testListPath string) (map[string]TestListEntry, error) {
-	var testList TestList
-	if err := jsonutil.ReadFromFile(testListPath, &testList); err != nil {
+	m := make(map[string]TestListEntry)
+	err := ForEachTestListEntry(testListPath, func(entry TestListEntry) error {
+		m[entry.Name] = entry
+		return nil
+	})
+	if err != nil {
 		if os.IsNotExist(err) {
 			return nil, nil
 		}
 		return nil, err
 	}
+	return m, nil
+}
 
-	if testList.SchemaID != TestListSchemaIDExperimental {
-		return nil, fmt.Errorf(`"schema_id" must be %q, found %q`, TestListSchemaIDExperimental, testList.SchemaID)
+// ForEachTestListEntry streams the entries of the test-list.json at
+// testListPath to fn without holding the full list in memory. See
+// ReadTestList.
+func ForEachTestListEntry(testListPath string, fn func(TestListEntry) error) error {
+	f, err := os.Open(testListPath)
+	if err != nil {
+		return err
 	}
+	defer f.Close()
+	return ReadTestList(bufio.NewReader(f), fn)
+}
 
-	m := make(map[string]TestListEntry)
-	for _, entry := range testList.Data {
-		m[entry.Name] = entry
+// ReadTestList decodes a test list from r, calling fn on each entry as it is
+// read. If fn returns an error, decoding stops and that error is returned.
+//
+// The schema ID is validated as soon as it is read, so a mismatch is reported
+// before any entries are delivered when "schema_id" precedes "data", as it
+// does in files written by the build. Otherwise entries may be delivered
+// before the schema error is returned.
+func ReadTestList(r io.Reader, fn func(TestListEntry) error) error {
+	dec := json.NewDecoder(r)
+	if err := expectDelim(dec, '{'); err != nil {
+		return err
 	}
-	return m, nil
+	var schemaID string
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		switch tok {
+		case "schema_id":
+			if err := dec.Decode(&schemaID); err != nil {
+				return err
+			}
+			if err := checkTestListSchemaID(schemaID); err != nil {
+				return err
+			}
+		case "data":
+			if err := readTestListData(dec, fn); err != nil {
+				return err
+			}
+		default:
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return err
+			}
+		}
+	}
+	if err := expectDelim(dec, '}'); err != nil {
+		return err
+	}
+	return checkTestListSchemaID(schemaID)
+}
+
+func readTestListData(dec *json.Decoder, fn func(TestListEntry) error) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok == nil {
+		return nil
+	}
+	if tok != json.Delim('[') {
+		return fmt.Errorf(`"data" must be an array, found %v`, tok)
+	}
+	for dec.More() {
+		var entry TestListEntry
+		if err := dec.Decode(&entry); err != nil {
+			return err
+		}
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+	return expectDelim(dec, ']')
+}
+
+func expectDelim(dec *json.Decoder, want json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok != want {
+		return fmt.Errorf("malformed test list: expected %q, found %v", want, tok)
+	}
+	return nil
+}
+
+func checkTestListSchemaID(schemaID string) error {
+	if schemaID != TestListSchemaIDExperimental {
+		return fmt.Errorf(`"schema_id" must be %q, found %q`, TestListSchemaIDExperimental, schemaID)
+	}
+	return nil
 }
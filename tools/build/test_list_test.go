@@ -5,10 +5,12 @@
 package build
 
 import (
+	"errors"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -137,3 +139,77 @@ func TestLoadTestListVersionMissing(t *testing.T) {
 		t.Fatalf(`got error %q, expected %q`, err, expected)
 	}
 }
+
+func TestReadTestListStreaming(t *testing.T) {
+	manifest := `{
+	  "schema_id": "experimental",
+	  "unknown_field": {"ignored": [1, 2, 3]},
+	  "data": [
+	    {"name": "a", "labels": ["//a"]},
+	    {"name": "b", "labels": ["//b"]},
+	    {"name": "c", "labels": ["//c"]}
+	  ]
+	}`
+
+	t.Run("delivers each entry in order", func(t *testing.T) {
+		var names []string
+		err := ReadTestList(strings.NewReader(manifest), func(entry TestListEntry) error {
+			names = append(names, entry.Name)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("error reading test list: %s", err)
+		}
+		if !reflect.DeepEqual(names, []string{"a", "b", "c"}) {
+			t.Fatalf("got entries %v, expected [a b c]", names)
+		}
+	})
+
+	t.Run("stops when the callback fails", func(t *testing.T) {
+		errStop := errors.New("stop")
+		var count int
+		err := ReadTestList(strings.NewReader(manifest), func(entry TestListEntry) error {
+			count++
+			if entry.Name == "b" {
+				return errStop
+			}
+			return nil
+		})
+		if !errors.Is(err, errStop) {
+			t.Fatalf("got error %v, expected %v", err, errStop)
+		}
+		if count != 2 {
+			t.Fatalf("callback called %d times, expected 2", count)
+		}
+	})
+
+	t.Run("rejects a bad schema before delivering entries", func(t *testing.T) {
+		bad := strings.Replace(manifest, `"experimental"`, `"1234"`, 1)
+		err := ReadTestList(strings.NewReader(bad), func(TestListEntry) error {
+			t.Fatalf("unexpected entry delivered for an unknown schema_id")
+			return nil
+		})
+		expected := `"schema_id" must be "experimental", found "1234"`
+		if err == nil || err.Error() != expected {
+			t.Fatalf("got error %v, expected %q", err, expected)
+		}
+	})
+
+	t.Run("rejects malformed data", func(t *testing.T) {
+		err := ReadTestList(strings.NewReader(`{"schema_id": "experimental", "data": {}}`), func(TestListEntry) error {
+			return nil
+		})
+		if err == nil {
+			t.Fatalf("expected an error for a non-array data field")
+		}
+	})
+}
+
+func TestForEachTestListEntryMissingFile(t *testing.T) {
+	err := ForEachTestListEntry(filepath.Join(t.TempDir(), "test-list.json"), func(TestListEntry) error {
+		return nil
+	})
+	if !os.IsNotExist(err) {
+		t.Fatalf("got error %v, expected a not-exist error", err)
+	}
+}
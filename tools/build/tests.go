@@ -4,7 +4,11 @@
 
 package build
 
-import "strings"
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
 
 const (
 	componentV2Suffix = ".cm"
@@ -145,3 +149,107 @@ type DimensionSet struct {
 	// Pool denotes the swarming pool to run a test in.
 	Pool string `json:"pool,omitempty"`
 }
+
+// TestSpecError describes a missing or malformed field of a test spec.
+type TestSpecError struct {
+	// Label is the GN label of the offending test, or its name if it has no
+	// label.
+	Label string
+	// Field is the JSON path of the offending field within the spec, e.g.
+	// "test.cpu" or "environments[1].dimensions".
+	Field string
+	// Reason says what is wrong with the field.
+	Reason string
+}
+
+func (e TestSpecError) Error() string {
+	return fmt.Sprintf("%s: %s: %s", e.Label, e.Field, e.Reason)
+}
+
+// TestSpecErrors aggregates the errors found in one or more test specs, so
+// that all of them can be fixed in one pass.
+type TestSpecErrors []TestSpecError
+
+func (e TestSpecErrors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Validate checks that the spec has the fields the testsharder relies on, and
+// that its environments are well formed. It returns TestSpecErrors naming
+// every offending field, or nil.
+func (s TestSpec) Validate() error {
+	label := s.Label
+	if label == "" {
+		label = s.Name
+	}
+	var errs TestSpecErrors
+	add := func(field, reason string) {
+		errs = append(errs, TestSpecError{Label: label, Field: field, Reason: reason})
+	}
+
+	if s.Name == "" {
+		add("test.name", "must not be empty")
+	}
+	if s.Label == "" {
+		add("test.label", "must not be empty")
+	}
+	if s.OS == "" {
+		add("test.os", "must not be empty")
+	}
+	if s.CPU == "" {
+		add("test.cpu", "must not be empty")
+	}
+	if s.Path == "" && s.PackageURL == "" {
+		add("test.path", "either path or package_url must be set")
+	}
+	if s.TimeoutSecs < 0 {
+		add("test.timeout_secs", fmt.Sprintf("must not be negative, got %d", s.TimeoutSecs))
+	}
+
+	for i, env := range s.Envs {
+		field := fmt.Sprintf("environments[%d]", i)
+		d := env.Dimensions
+		if d.DeviceType == "" && d.OS == "" && d.Testbed == "" {
+			add(field+".dimensions", "must set at least one of device_type, os or testbed")
+		}
+		types := make([]string, 0, len(env.ImageOverrides))
+		for t := range env.ImageOverrides {
+			types = append(types, string(t))
+		}
+		sort.Strings(types)
+		for _, t := range types {
+			switch ImageOverrideType(t) {
+			case ZbiImage, VbmetaImage, QemuKernel:
+			default:
+				add(field+".image_overrides", fmt.Sprintf("unknown image type %q", t))
+			}
+			if m := env.ImageOverrides[ImageOverrideType(t)]; m.Name == "" && m.Label == "" {
+				add(fmt.Sprintf("%s.image_overrides.%s", field, t), "must set name or label")
+			}
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// ValidateTestSpecs validates every spec, as in TestSpec.Validate, and returns
+// the errors of all of them together, or nil.
+func ValidateTestSpecs(specs []TestSpec) error {
+	var errs TestSpecErrors
+	for _, spec := range specs {
+		if err := spec.Validate(); err != nil {
+			errs = append(errs, err.(TestSpecErrors)...)
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
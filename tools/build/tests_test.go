@@ -146,3 +146,50 @@ func TestIsComponentV2(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateTestSpecs(t *testing.T) {
+	valid := TestSpec{
+		Test: Test{
+			Name:  "foo_tests",
+			Label: "//src/foo:foo_tests(//build/toolchain/fuchsia:x64)",
+			Path:  "/bin/foo_tests",
+			OS:    "fuchsia",
+			CPU:   "x64",
+		},
+		Envs: []Environment{
+			{Dimensions: DimensionSet{DeviceType: "QEMU"}},
+		},
+	}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("valid spec: %s", err)
+	}
+
+	invalid := TestSpec{
+		Test: Test{
+			Name:  "bar_tests",
+			Label: "//src/bar:bar_tests(//build/toolchain/fuchsia:x64)",
+			OS:    "fuchsia",
+		},
+		Envs: []Environment{
+			{Dimensions: DimensionSet{DeviceType: "QEMU"}},
+			{
+				Dimensions:     DimensionSet{},
+				ImageOverrides: ImageOverrides{"kernel": {Name: "k"}},
+			},
+		},
+	}
+	label := invalid.Label
+	want := TestSpecErrors{
+		{Label: label, Field: "test.cpu", Reason: "must not be empty"},
+		{Label: label, Field: "test.path", Reason: "either path or package_url must be set"},
+		{Label: label, Field: "environments[1].dimensions", Reason: "must set at least one of device_type, os or testbed"},
+		{Label: label, Field: "environments[1].image_overrides", Reason: `unknown image type "kernel"`},
+	}
+	err := ValidateTestSpecs([]TestSpec{valid, invalid})
+	if !reflect.DeepEqual(err, want) {
+		t.Errorf("got %#v, want %#v", err, want)
+	}
+	if err := ValidateTestSpecs([]TestSpec{valid}); err != nil {
+		t.Errorf("valid specs: %s", err)
+	}
+}
@@ -25,8 +25,50 @@ type Tool struct {
 	CPU string `json:"cpu"`
 }
 
+// Tools is the list of host tools in tool_paths.json.
 type Tools []Tool
 
+// LoadTools reads tool_paths.json from the given build directory, without
+// reading any other build API module.
+func LoadTools(buildDir string) (Tools, error) {
+	m := NewLazyModules(buildDir)
+	if err := m.Load(toolPathsManifestName); err != nil {
+		return nil, err
+	}
+	return m.Tools(), nil
+}
+
+// ByName returns the builds of the named tool for every platform.
+func (t Tools) ByName(name string) Tools {
+	var res Tools
+	for _, tool := range t {
+		if tool.Name == name {
+			res = append(res, tool)
+		}
+	}
+	return res
+}
+
+// Lookup returns the named tool built for the given OS and CPU, as spelled in
+// tool_paths.json (e.g. "linux" and "x64").
+func (t Tools) Lookup(name, os, cpu string) (Tool, error) {
+	for _, tool := range t {
+		if tool.Name == name && tool.OS == os && tool.CPU == cpu {
+			return tool, nil
+		}
+	}
+	return Tool{}, fmt.Errorf("no tool with os %q, cpu %q and name %q", os, cpu, name)
+}
+
+// LookupHostPath is like LookupPath for the platform the caller is running on.
+func (t Tools) LookupHostPath(name string) (string, error) {
+	platform, err := hostplatform.Name()
+	if err != nil {
+		return "", err
+	}
+	return t.LookupPath(platform, name)
+}
+
 // LookupPath returns the path (relative to the build directory) of the named tool
 // built for the specified platform. It will return an error if the
 // platform/tool combination cannot be found, generally because the platform is
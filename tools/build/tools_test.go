@@ -5,6 +5,9 @@
 package build
 
 import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
 	"testing"
 )
 
@@ -77,3 +80,46 @@ func TestLookupPath(t *testing.T) {
 		})
 	}
 }
+
+func TestLookup(t *testing.T) {
+	tools := Tools{
+		{Name: "foo", OS: "linux", CPU: "x64", Path: "linux_x64/foo"},
+		{Name: "foo", OS: "mac", CPU: "x64", Path: "mac_x64/foo"},
+		{Name: "bar", OS: "linux", CPU: "x64", Path: "linux_x64/bar"},
+	}
+
+	if got := tools.ByName("foo"); !reflect.DeepEqual(got, tools[:2]) {
+		t.Errorf("ByName() = %v, want %v", got, tools[:2])
+	}
+
+	tool, err := tools.Lookup("foo", "mac", "x64")
+	if err != nil {
+		t.Fatalf("Lookup() failed: %s", err)
+	}
+	if tool != tools[1] {
+		t.Errorf("Lookup() = %v, want %v", tool, tools[1])
+	}
+	if _, err := tools.Lookup("bar", "mac", "x64"); err == nil {
+		t.Error("Lookup() of an unsupported platform succeeded")
+	}
+}
+
+func TestLoadTools(t *testing.T) {
+	buildDir := t.TempDir()
+	manifest := `[{"name": "zbi", "os": "linux", "cpu": "x64", "path": "host_x64/zbi"}]`
+	if err := ioutil.WriteFile(filepath.Join(buildDir, "tool_paths.json"), []byte(manifest), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	tools, err := LoadTools(buildDir)
+	if err != nil {
+		t.Fatalf("LoadTools() failed: %s", err)
+	}
+	want := Tools{{Name: "zbi", OS: "linux", CPU: "x64", Path: "host_x64/zbi"}}
+	if !reflect.DeepEqual(tools, want) {
+		t.Errorf("LoadTools() = %v, want %v", tools, want)
+	}
+
+	if _, err := LoadTools(t.TempDir()); err == nil {
+		t.Error("LoadTools() of a build directory without tool_paths.json succeeded")
+	}
+}
@@ -30,7 +30,7 @@ func TestTestDurationsMap(t *testing.T) {
 	assertDurationEquals := func(name string, expected time.Duration) {
 		duration := m.Get(Test{Test: build.Test{Name: name}})
 		if duration.MedianDuration != expected {
-			t.Fatalf("wrong duration for test %q: got %s, want %s", name, duration, expected)
+			t.Fatalf("wrong duration for test %q: got %s, want %s", name, duration.MedianDuration, expected)
 		}
 	}
 
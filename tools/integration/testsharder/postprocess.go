@@ -167,7 +167,7 @@ func MultiplyShards(
 					// we want to keep the total runs to a reasonable number
 					// in case the test takes longer than expected. We're conservative because
 					// if a shard exceeds its timeout, it's really painful for users.
-					expectedDuration := testDurations.Get(test).MedianDuration
+					expectedDuration := testDurations.Get(test).ConservativeDuration()
 					match.test.Runs = min(
 						int(float64(targetDuration)/float64(expectedDuration)),
 						multipliedTestMaxRuns,
@@ -429,10 +429,7 @@ func WithTargetDuration(
 	for _, shard := range shards {
 		numNewShards := 0
 		if targetDuration > 0 {
-			var total time.Duration
-			for _, t := range shard.Tests {
-				total += testDurations.Get(t).MedianDuration * time.Duration(t.minRequiredRuns())
-			}
+			total := shard.TotalExpectedDuration(testDurations)
 			numNewShards = divRoundUp(int(total), int(targetDuration))
 		} else {
 			var total int
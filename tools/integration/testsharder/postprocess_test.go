@@ -29,7 +29,7 @@ func affectedShard(env build.Environment, os string, ids ...int) *Shard {
 		tests = append(tests, test)
 	}
 	return &Shard{
-		Name:  AffectedShardPrefix + environmentName(env),
+		Name:  AffectedShardPrefix + DefaultEnvironmentName(env),
 		Tests: tests,
 		Env:   env,
 	}
@@ -63,7 +63,7 @@ func TestMultiplyShards(t *testing.T) {
 		test.RunAlgorithm = StopOnFailure
 		test.StopRepeatingAfterSecs = timeoutSecs
 		return &Shard{
-			Name:  MultipliedShardPrefix + environmentName(env) + "-" + normalizeTestName(test.Name),
+			Name:  MultipliedShardPrefix + DefaultEnvironmentName(env) + "-" + normalizeTestName(test.Name),
 			Tests: []Test{test},
 			Env:   env,
 		}
@@ -11,7 +11,9 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"go.fuchsia.dev/fuchsia/src/sys/pkg/bin/pm/repo"
 	"go.fuchsia.dev/fuchsia/tools/build"
@@ -47,6 +49,77 @@ type Shard struct {
 	Summary runtests.TestSummary `json:"summary,omitempty"`
 }
 
+// TestCount returns the number of tests in the shard.
+func (s *Shard) TestCount() int {
+	return len(s.Tests)
+}
+
+// TotalExpectedDuration returns how long the shard's tests are expected to
+// take, computed the same way the sharder balances shards: each test's median
+// duration times the number of runs it is guaranteed to need. If
+// testDurations is nil, the durations come from the tests' expected duration
+// tags instead, as in a shard read back from the sharder's output.
+func (s *Shard) TotalExpectedDuration(testDurations TestDurationsMap) time.Duration {
+	var total time.Duration
+	for _, t := range s.Tests {
+		total += expectedDuration(t, testDurations) * time.Duration(t.minRequiredRuns())
+	}
+	return total
+}
+
+// expectedDuration returns the median duration of a test, from testDurations
+// or, if it is nil, from the test's expected duration tag.
+func expectedDuration(t Test, testDurations TestDurationsMap) time.Duration {
+	if testDurations != nil {
+		return testDurations.Get(t).MedianDuration
+	}
+	for _, tag := range t.Tags {
+		if tag.Key == expectedDurationTagKey {
+			ms, err := strconv.ParseInt(tag.Value, 10, 64)
+			if err != nil {
+				return 0
+			}
+			return time.Duration(ms) * time.Millisecond
+		}
+	}
+	return 0
+}
+
+// MaxTimeout returns the longest per-run timeout of any of the shard's tests,
+// or zero if none of them has a timeout.
+func (s *Shard) MaxTimeout() time.Duration {
+	var max time.Duration
+	for _, t := range s.Tests {
+		if t.Timeout > max {
+			max = t.Timeout
+		}
+	}
+	return max
+}
+
+// DepsSize returns the total size in bytes of the shard's runtime
+// dependencies, resolved relative to the given build directory. Dependencies
+// that are directories, like the shard's package repository, count the size
+// of all the files within them.
+func (s *Shard) DepsSize(buildDir string) (int64, error) {
+	var total int64
+	for _, dep := range s.Deps {
+		err := filepath.Walk(filepath.Join(buildDir, dep), func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.Mode().IsRegular() {
+				total += info.Size()
+			}
+			return nil
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+	return total, nil
+}
+
 // CreatePackageRepo creates a package repository for the given shard.
 func (s *Shard) CreatePackageRepo() error {
 	// Aggregate the package manifests used by the shard. We do this first
@@ -136,6 +209,11 @@ type ShardOptions struct {
 	// Tags is the list of tags that the sharded Environments must match; those
 	// that don't match all tags will be ignored.
 	Tags []string
+
+	// EnvironmentName names the shards of an environment. The shard of an
+	// isolated test appends the test's name to it. If nil,
+	// DefaultEnvironmentName is used.
+	EnvironmentName func(build.Environment) string
 }
 
 // MakeShards returns the list of shards associated with a given build.
@@ -168,6 +246,11 @@ func MakeShards(specs []build.TestSpec, testListEntries map[string]build.TestLis
 		}
 	}
 
+	envName := opts.EnvironmentName
+	if envName == nil {
+		envName = DefaultEnvironmentName
+	}
+
 	shards := make([]*Shard, 0, len(envs))
 	for _, env := range envs {
 		specs, _ := envToSuites.get(env)
@@ -183,7 +266,7 @@ func MakeShards(specs []build.TestSpec, testListEntries map[string]build.TestLis
 			}
 			if spec.Test.Isolated {
 				shards = append(shards, &Shard{
-					Name:  fmt.Sprintf("%s-%s", environmentName(env), normalizeTestName(spec.Test.Name)),
+					Name:  fmt.Sprintf("%s-%s", envName(env), normalizeTestName(spec.Test.Name)),
 					Tests: []Test{test},
 					Env:   env,
 				})
@@ -193,7 +276,7 @@ func MakeShards(specs []build.TestSpec, testListEntries map[string]build.TestLis
 		}
 		if len(tests) > 0 {
 			shards = append(shards, &Shard{
-				Name:  environmentName(env),
+				Name:  envName(env),
 				Tests: tests,
 				Env:   env,
 			})
@@ -202,8 +285,9 @@ func MakeShards(specs []build.TestSpec, testListEntries map[string]build.TestLis
 	return shards
 }
 
-// EnvironmentName returns a name for an environment.
-func environmentName(env build.Environment) string {
+// DefaultEnvironmentName returns the name the sharder gives an environment,
+// made of its dimensions, service account and other distinguishing keys.
+func DefaultEnvironmentName(env build.Environment) string {
 	tokens := []string{}
 	addToken := func(s string) {
 		if s != "" {
@@ -6,7 +6,12 @@ package testsharder
 
 import (
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 
@@ -57,7 +62,7 @@ func shard(env build.Environment, os string, ids ...int) *Shard {
 		tests = append(tests, makeTest(id, os))
 	}
 	return &Shard{
-		Name:  environmentName(env),
+		Name:  DefaultEnvironmentName(env),
 		Tests: tests,
 		Env:   env,
 	}
@@ -84,7 +89,7 @@ func TestMakeShards(t *testing.T) {
 	t.Run("environments have nonempty names", func(t *testing.T) {
 		envs := []build.Environment{env1, env2, env3}
 		for _, env := range envs {
-			if environmentName(env) == "" {
+			if DefaultEnvironmentName(env) == "" {
 				t.Fatalf("build.Environment\n%+v\n has an empty name", env)
 			}
 		}
@@ -110,6 +115,21 @@ func TestMakeShards(t *testing.T) {
 		assertEqual(t, expected, actual)
 	})
 
+	t.Run("environment naming can be overridden", func(t *testing.T) {
+		opts := &ShardOptions{
+			Tags: []string{},
+			EnvironmentName: func(env build.Environment) string {
+				return "custom-" + strings.ToLower(env.Dimensions.DeviceType)
+			},
+		}
+		actual := MakeShards([]build.TestSpec{spec(1, env1), spec(2, env2)}, nil, opts)
+		shard1 := fuchsiaShard(env1, 1)
+		shard1.Name = "custom-qemu"
+		shard2 := fuchsiaShard(env2, 2)
+		shard2.Name = "custom-nuc"
+		assertEqual(t, []*Shard{shard1, shard2}, actual)
+	})
+
 	// Ensure that the order of the shards is the order in which their
 	// corresponding environments appear in the input. This is the simplest
 	// deterministic order we can produce for the shards.
@@ -284,11 +304,11 @@ func TestMakeShards(t *testing.T) {
 		}
 		expected := []*Shard{
 			{
-				Name:  environmentName(env1),
+				Name:  DefaultEnvironmentName(env1),
 				Tests: []Test{makeTestWithTags(1, testListEntry.Tags), makeTest(2, "fuchsia")},
 				Env:   env1,
 			}, {
-				Name:  environmentName(env2),
+				Name:  DefaultEnvironmentName(env2),
 				Tests: []Test{makeTestWithTags(1, testListEntry.Tags), makeTest(3, "fuchsia")},
 				Env:   env2,
 			},
@@ -296,3 +316,66 @@ func TestMakeShards(t *testing.T) {
 		assertEqual(t, expected, actual)
 	})
 }
+
+func TestShardAccounting(t *testing.T) {
+	env := build.Environment{Dimensions: build.DimensionSet{DeviceType: "QEMU"}}
+	s := fuchsiaShard(env, 1, 2, 3)
+	s.Tests[0].Timeout = 5 * time.Minute
+	s.Tests[1].Timeout = 10 * time.Minute
+	s.Tests[1].Runs = 3
+	s.Tests[1].RunAlgorithm = StopOnFailure
+
+	if got := s.TestCount(); got != 3 {
+		t.Errorf("TestCount() = %d, want 3", got)
+	}
+	if got := s.MaxTimeout(); got != 10*time.Minute {
+		t.Errorf("MaxTimeout() = %s, want 10m", got)
+	}
+
+	testDurations := TestDurationsMap{
+		"*":                  {MedianDuration: time.Second},
+		s.Tests[1].Test.Name: {MedianDuration: 2 * time.Second},
+	}
+	// 1s + 3 runs * 2s + 1s.
+	wantDuration := 8 * time.Second
+	if got := s.TotalExpectedDuration(testDurations); got != wantDuration {
+		t.Errorf("TotalExpectedDuration() = %s, want %s", got, wantDuration)
+	}
+	// The expected duration tags written by the sharder give the same total.
+	tagged := AddExpectedDurationTags([]*Shard{s}, testDurations)[0]
+	if got := tagged.TotalExpectedDuration(nil); got != wantDuration {
+		t.Errorf("TotalExpectedDuration(nil) = %s, want %s", got, wantDuration)
+	}
+
+	buildDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(buildDir, "repo", "blobs"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]int{
+		"host_x64/dep":     10,
+		"repo/blobs/blob1": 100,
+		"repo/blobs/blob2": 1000,
+	}
+	for name, size := range files {
+		path := filepath.Join(buildDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, make([]byte, size), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.AddDeps([]string{"host_x64/dep", "repo"})
+	size, err := s.DepsSize(buildDir)
+	if err != nil {
+		t.Fatalf("DepsSize() failed: %s", err)
+	}
+	if size != 1110 {
+		t.Errorf("DepsSize() = %d, want 1110", size)
+	}
+
+	s.AddDeps([]string{"missing"})
+	if _, err := s.DepsSize(buildDir); err == nil {
+		t.Error("DepsSize() with a missing dependency succeeded")
+	}
+}
@@ -5,9 +5,11 @@
 package testsharder
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"path"
 	"strings"
 
 	"go.fuchsia.dev/fuchsia/tools/build"
@@ -62,17 +64,90 @@ func LoadTestModifiers(manifestPath string) ([]TestModifier, error) {
 	return specs, nil
 }
 
+// LoadAffectedTests reads the names of the tests affected by a change from a
+// file. See ParseAffectedTests for the accepted formats.
+func LoadAffectedTests(path string) ([]string, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseAffectedTests(b)
+}
+
+// ParseAffectedTests parses a list of affected test names. The list is either
+// plain text with one test name per line, or a JSON array whose elements are
+// test names or objects with a "name" field. Blank lines are ignored.
+//
+// Names are normalized to match the names in tests.json: package URLs lose any
+// package variant and query, e.g. "fuchsia-pkg://fuchsia.com/foo/0?hash=abc#meta/foo.cm"
+// becomes "fuchsia-pkg://fuchsia.com/foo#meta/foo.cm", and host test paths
+// are cleaned, e.g. "./host_x64/foo_test" becomes "host_x64/foo_test". Other
+// names, such as "fuchsia-boot:///#meta/foo.cm" or "//src/foo:bar", are
+// left as they are.
+func ParseAffectedTests(b []byte) ([]string, error) {
+	var raw []string
+	if trimmed := bytes.TrimSpace(b); len(trimmed) > 0 && trimmed[0] == '[' {
+		var entries []json.RawMessage
+		if err := json.Unmarshal(trimmed, &entries); err != nil {
+			return nil, err
+		}
+		for i, entry := range entries {
+			var name string
+			if err := json.Unmarshal(entry, &name); err != nil {
+				var obj struct {
+					Name string `json:"name"`
+				}
+				if err := json.Unmarshal(entry, &obj); err != nil {
+					return nil, fmt.Errorf("affected test %d must be a string or an object with a name: %w", i, err)
+				}
+				name = obj.Name
+			}
+			raw = append(raw, name)
+		}
+	} else {
+		raw = strings.Split(string(b), "\n")
+	}
+
+	var names []string
+	for _, name := range raw {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, normalizeAffectedTestName(name))
+		}
+	}
+	return names, nil
+}
+
+func normalizeAffectedTestName(name string) string {
+	if !strings.HasPrefix(name, "fuchsia-pkg://") {
+		// Only relative host test paths are cleaned; URLs of other schemes
+		// and GN labels are significant as written.
+		if !strings.Contains(name, ":") && !strings.HasPrefix(name, "/") {
+			return path.Clean(name)
+		}
+		return name
+	}
+	pkg, resource := name, ""
+	if i := strings.Index(name, "#"); i >= 0 {
+		pkg, resource = name[:i], name[i:]
+	}
+	if i := strings.Index(pkg, "?"); i >= 0 {
+		pkg = pkg[:i]
+	}
+	pkg = strings.TrimSuffix(pkg, "/0")
+	return pkg + resource
+}
+
 // AffectedModifiers returns modifiers for tests that are in both testSpecs and
 // affectedTestsPath.
-// affectedTestsPath is the path to a file containing test names separated by `\n`.
+// affectedTestsPath is the path to a file of test names as accepted by
+// LoadAffectedTests.
 // maxAttempts will be applied to any test that is not multiplied.
 // Tests will be considered for multiplication only if num affected tests <= multiplyThreshold.
 func AffectedModifiers(testSpecs []build.TestSpec, affectedTestsPath string, maxAttempts, multiplyThreshold int) ([]TestModifier, error) {
-	affectedTestBytes, err := ioutil.ReadFile(affectedTestsPath)
+	affectedTestNames, err := LoadAffectedTests(affectedTestsPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read affectedTestsPath (%s): %w", affectedTestsPath, err)
 	}
-	affectedTestNames := strings.Split(strings.TrimSpace(string(affectedTestBytes)), "\n")
 
 	ret := []TestModifier{}
 	// Names of tests to which we'll apply maxAttempts (i.e. we didn't multiply them).
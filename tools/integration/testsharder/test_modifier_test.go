@@ -153,6 +153,67 @@ func TestAffectedModifiers(t *testing.T) {
 	})
 }
 
+func TestParseAffectedTests(t *testing.T) {
+	want := []string{
+		"fuchsia-pkg://fuchsia.com/foo#meta/foo.cm",
+		"fuchsia-pkg://fuchsia.com/bar#meta/bar.cm",
+		"host_x64/baz_test",
+	}
+	testCases := []struct {
+		name    string
+		input   string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:  "plain text",
+			input: "fuchsia-pkg://fuchsia.com/foo#meta/foo.cm\nfuchsia-pkg://fuchsia.com/bar#meta/bar.cm\nhost_x64/baz_test\n",
+			want:  want,
+		},
+		{
+			name:  "plain text with blank lines and unnormalized names",
+			input: "\nfuchsia-pkg://fuchsia.com/foo/0#meta/foo.cm\n\n  fuchsia-pkg://fuchsia.com/bar?hash=abcdef#meta/bar.cm\n./host_x64/baz_test\n",
+			want:  want,
+		},
+		{
+			name:  "json",
+			input: `["fuchsia-pkg://fuchsia.com/foo#meta/foo.cm", {"name": "fuchsia-pkg://fuchsia.com/bar/0#meta/bar.cm"}, {"name": "host_x64//baz_test"}]`,
+			want:  want,
+		},
+		{
+			name:  "boot URLs and labels are left alone",
+			input: "fuchsia-boot:///#meta/foo.cm\n//src/foo:bar\n/abs/host_x64/foo_test\n",
+			want:  []string{"fuchsia-boot:///#meta/foo.cm", "//src/foo:bar", "/abs/host_x64/foo_test"},
+		},
+		{
+			name:  "empty",
+			input: "\n",
+		},
+		{
+			name:    "malformed json",
+			input:   `["foo", 1]`,
+			wantErr: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := ParseAffectedTests([]byte(tc.input))
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseAffectedTests() failed: %s", err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("ParseAffectedTests() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
 // mkTempFile returns a new temporary file with the specified content that will
 // be cleaned up automatically.
 func mkTempFile(t *testing.T, content string) string {